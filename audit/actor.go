@@ -0,0 +1,172 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/nojyerac/go-lib/auth"
+)
+
+// Actor types.
+const (
+	// ActorUser is a person, identified by a UUID or an email address.
+	ActorUser = "user"
+	// ActorService is a service account or API client.
+	ActorService = "service"
+	// ActorSystem is work the service does on its own, such as a scheduled job.
+	ActorSystem = "system"
+	// ActorAnonymous is an unauthenticated caller. It has no ID.
+	ActorAnonymous = "anonymous"
+)
+
+// Actor identifies who performed an audited action. Event.ActorID repeats ID.
+type Actor struct {
+	Type      string `json:"type" validate:"oneof=user service system anonymous"`
+	ID        string `json:"id,omitempty"`
+	IP        string `json:"ip,omitempty" validate:"omitempty,ip"`
+	UserAgent string `json:"userAgent,omitempty" validate:"max=512"`
+}
+
+// defaultActorRules are the validator tags applied to Actor.ID by type.
+var defaultActorRules = map[string]string{
+	ActorUser:      "required,uuid|email",
+	ActorService:   "required,printascii,max=256",
+	ActorSystem:    "required,printascii,max=256",
+	ActorAnonymous: "isdefault",
+}
+
+type (
+	ctxActorKeyType   struct{}
+	ctxAddressKeyType struct{}
+)
+
+var (
+	ctxActorKey   = ctxActorKeyType{}
+	ctxAddressKey = ctxAddressKeyType{}
+)
+
+type address struct {
+	ip, userAgent string
+}
+
+// WithActor records the actor of events logged with ctx. It takes precedence
+// over the claims on ctx but not over an actor ID passed to Log.
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, ctxActorKey, actor)
+}
+
+// WithActorAddress records the network address and user agent of the caller,
+// used when the actor does not carry its own. The HTTP and gRPC transports set
+// it from the request.
+func WithActorAddress(ctx context.Context, ip, userAgent string) context.Context {
+	return context.WithValue(ctx, ctxAddressKey, address{ip: ip, userAgent: userAgent})
+}
+
+// WithAnonymousFallback marks events logged with ctx as anonymous when ctx
+// carries neither a WithActor actor nor claims with a subject. Without it such
+// events fail with ErrInvalidEventActorID. The HTTP and gRPC audit middleware
+// use it for unauthenticated requests.
+func WithAnonymousFallback(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(ctxActorKey).(Actor); ok {
+		return ctx
+	}
+	if claims, ok := auth.FromContext(ctx); ok && claims.Subject != "" {
+		return ctx
+	}
+	return WithActor(ctx, Actor{Type: ActorAnonymous})
+}
+
+// ActorIDType returns ActorUser for IDs that are UUIDs or email addresses and
+// ActorService for any other ID, such as the client ID of a client
+// credentials token.
+func ActorIDType(id string) string {
+	if uuid.Validate(id) == nil {
+		return ActorUser
+	}
+	if addr, err := mail.ParseAddress(id); err == nil && addr.Address == id {
+		return ActorUser
+	}
+	return ActorService
+}
+
+// ClaimsActorType returns the ActorIDType of the claims subject. It is the
+// default for WithClaimsActorType.
+func ClaimsActorType(claims *auth.Claims) string {
+	return ActorIDType(claims.Subject)
+}
+
+// actorResolver determines and validates the actor of an event.
+type actorResolver struct {
+	v          *validator.Validate
+	claimsType func(*auth.Claims) string
+	rules      map[string]string
+}
+
+func newActorResolver(o *options) actorResolver {
+	r := actorResolver{v: o.validator, claimsType: o.claimsActorType, rules: defaultActorRules}
+	if r.claimsType == nil {
+		r.claimsType = ClaimsActorType
+	}
+	if len(o.actorRules) > 0 {
+		r.rules = make(map[string]string, len(defaultActorRules))
+		for actorType, rule := range defaultActorRules {
+			r.rules[actorType] = rule
+		}
+		for actorType, rule := range o.actorRules {
+			r.rules[actorType] = rule
+		}
+	}
+	return r
+}
+
+// resolve returns the actor for an event logged with actorID. An actorID that
+// matches neither the WithActor actor nor the claims subject gets its
+// ActorIDType. An empty one falls back to the WithActor actor, then to the
+// claims; with neither, the event has no actor and is rejected.
+func (r actorResolver) resolve(ctx context.Context, actorID string) (*Actor, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var actor Actor
+	ctxActor, hasActor := ctx.Value(ctxActorKey).(Actor)
+	claims, hasClaims := auth.FromContext(ctx)
+	switch {
+	case actorID != "" && hasActor && ctxActor.ID == actorID:
+		actor = ctxActor
+	case actorID != "" && hasClaims && claims.Subject == actorID:
+		actor = Actor{Type: r.claimsType(claims), ID: actorID}
+	case actorID != "":
+		actor = Actor{Type: ActorIDType(actorID), ID: actorID}
+	case hasActor:
+		actor = ctxActor
+	case hasClaims && claims.Subject != "":
+		actor = Actor{Type: r.claimsType(claims), ID: claims.Subject}
+	default:
+		return nil, fmt.Errorf("%w: no actor ID, context actor or claims subject", ErrInvalidEventActorID)
+	}
+	if addr, ok := ctx.Value(ctxAddressKey).(address); ok {
+		if actor.IP == "" {
+			actor.IP = addr.ip
+		}
+		if actor.UserAgent == "" {
+			actor.UserAgent = addr.userAgent
+		}
+	}
+	return &actor, nil
+}
+
+// validateID checks the actor ID against the rule for its type. The type
+// itself is checked with the rest of the event.
+func (r actorResolver) validateID(actor *Actor) error {
+	rule, ok := r.rules[actor.Type]
+	if !ok {
+		return nil
+	}
+	if err := r.v.Var(actor.ID, rule); err != nil {
+		return fmt.Errorf("%w: %s actor %q", ErrInvalidEventActorID, actor.Type, actor.ID)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package audit_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"github.com/google/uuid"
+	. "github.com/nojyerac/go-lib/audit"
+	"github.com/nojyerac/go-lib/auth"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Actor", func() {
+	var (
+		out    bytes.Buffer
+		opts   []Option
+		logger AuditLogger
+		userID = uuid.NewString()
+	)
+
+	BeforeEach(func() {
+		out.Reset()
+		opts = nil
+	})
+
+	JustBeforeEach(func() {
+		cfg := NewConfiguration()
+		cfg.AuditLoggerType = "stdout"
+		var err error
+		logger, err = NewAuditLogger(cfg, append([]Option{WithOutput(&out)}, opts...)...)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	decode := func() Event {
+		var evt Event
+		Expect(json.Unmarshal(out.Bytes(), &evt)).To(Succeed())
+		return evt
+	}
+
+	withClaims := func(subject string) context.Context {
+		return auth.WithClaims(context.Background(), &auth.Claims{Subject: subject})
+	}
+
+	DescribeTable("resolves the actor",
+		func(ctx func() context.Context, actorID string, expected Actor) {
+			Expect(logger.Log(ctx(), actorID, "user.update", map[string]any{})).To(Succeed())
+			evt := decode()
+			Expect(*evt.Actor).To(Equal(expected))
+			Expect(evt.ActorID).To(Equal(expected.ID))
+		},
+		Entry("from an explicit ID", context.Background, userID, Actor{Type: ActorUser, ID: userID}),
+		Entry("from an explicit email", context.Background, "ada@example.com",
+			Actor{Type: ActorUser, ID: "ada@example.com"}),
+		Entry("from an explicit service ID", context.Background, "svc-billing",
+			Actor{Type: ActorService, ID: "svc-billing"}),
+		Entry("from a UUID subject", func() context.Context { return withClaims(userID) }, "",
+			Actor{Type: ActorUser, ID: userID}),
+		Entry("from an email subject", func() context.Context { return withClaims("ada@example.com") }, "",
+			Actor{Type: ActorUser, ID: "ada@example.com"}),
+		Entry("from a client ID subject", func() context.Context { return withClaims("billing-api") }, "",
+			Actor{Type: ActorService, ID: "billing-api"}),
+		Entry("from an explicit ID matching the subject", func() context.Context {
+			return withClaims("billing-api")
+		}, "billing-api", Actor{Type: ActorService, ID: "billing-api"}),
+		Entry("from the context actor", func() context.Context {
+			return WithActor(withClaims(userID), Actor{Type: ActorSystem, ID: "cron:cleanup"})
+		}, "", Actor{Type: ActorSystem, ID: "cron:cleanup"}),
+		Entry("as anonymous when set on the context", func() context.Context {
+			return WithActor(context.Background(), Actor{Type: ActorAnonymous})
+		}, "", Actor{Type: ActorAnonymous}),
+		Entry("as anonymous with the fallback and no claims", func() context.Context {
+			return WithAnonymousFallback(context.Background())
+		}, "", Actor{Type: ActorAnonymous}),
+		Entry("from the claims despite the fallback", func() context.Context {
+			return WithAnonymousFallback(withClaims(userID))
+		}, "", Actor{Type: ActorUser, ID: userID}),
+		Entry("with the caller's address", func() context.Context {
+			return WithActorAddress(withClaims(userID), "10.0.0.1", "curl/8.0")
+		}, "", Actor{Type: ActorUser, ID: userID, IP: "10.0.0.1", UserAgent: "curl/8.0"}),
+	)
+
+	DescribeTable("rejects invalid actors",
+		func(ctx context.Context, actorID string, expected error) {
+			Expect(logger.Log(ctx, actorID, "user.update", map[string]any{})).To(MatchError(expected))
+			Expect(out.Len()).To(BeZero())
+		},
+		Entry("no actor", context.Background(), "", ErrInvalidEventActorID),
+		Entry("claims without a subject", auth.WithClaims(context.Background(), &auth.Claims{}), "",
+			ErrInvalidEventActorID),
+		Entry("service with a non-printable ID", context.Background(), "svc\tbilling", ErrInvalidEventActorID),
+		Entry("user without a UUID or email", WithActor(context.Background(), Actor{Type: ActorUser, ID: "bob"}), "",
+			ErrInvalidEventActorID),
+		Entry("service without an ID", WithActor(context.Background(), Actor{Type: ActorService}), "",
+			ErrInvalidEventActorID),
+		Entry("anonymous with an ID", WithActor(context.Background(), Actor{Type: ActorAnonymous, ID: "x"}), "",
+			ErrInvalidEventActorID),
+		Entry("unknown type", WithActor(context.Background(), Actor{Type: "robot", ID: "r2"}), "",
+			ErrInvalidEventActor),
+		Entry("invalid IP", WithActorAddress(context.Background(), "not-an-ip", ""), userID, ErrInvalidEventActor),
+	)
+
+	Context("with custom rules", func() {
+		BeforeEach(func() {
+			opts = append(opts,
+				WithActorIDRule(ActorUser, "required,uuid4"),
+				WithClaimsActorType(func(*auth.Claims) string { return ActorSystem }),
+			)
+		})
+
+		It("applies them", func() {
+			Expect(logger.Log(context.Background(), "ada@example.com", "user.update", map[string]any{})).
+				To(MatchError(ErrInvalidEventActorID))
+
+			Expect(logger.Log(withClaims("scheduler"), "", "user.update", map[string]any{})).To(Succeed())
+			Expect(decode().Actor.Type).To(Equal(ActorSystem))
+		})
+	})
+})
@@ -0,0 +1,214 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/nojyerac/go-lib/log"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+var (
+	ErrQueueFull    = errors.New("audit queue is full")
+	ErrLoggerClosed = errors.New("audit logger is closed")
+)
+
+const (
+	batchFormatNDJSON = "ndjson"
+
+	overflowBlock      = "block"
+	overflowDropNewest = "drop_newest"
+	overflowFail       = "fail"
+)
+
+// asyncHTTPAuditLogger queues events in memory and POSTs them in batches from
+// a background goroutine, keeping the sink off the caller's request path.
+type asyncHTTPAuditLogger struct {
+	eventBuilder
+	sink          *httpSink
+	batchSize     int
+	flushInterval time.Duration
+	format        string
+	overflow      string
+
+	// mu guards closed and the registration of senders; it is never held
+	// while a sender waits for room in the queue.
+	mu      sync.RWMutex
+	closed  bool
+	senders sync.WaitGroup
+	queue   chan Message
+	stop    chan struct{}
+	done    chan struct{}
+
+	// flushCtx is cancelled when Close gives up, which abandons the batch in
+	// flight and the rest of the queue.
+	flushCtx context.Context
+	abort    context.CancelFunc
+}
+
+func newAsyncHTTPAuditLogger(cfg *Configuration, builder eventBuilder, sink *httpSink) *asyncHTTPAuditLogger {
+	flushCtx, abort := context.WithCancel(context.Background())
+	a := &asyncHTTPAuditLogger{
+		eventBuilder:  builder,
+		sink:          sink,
+		batchSize:     cfg.HTTPBatchSize,
+		flushInterval: cfg.HTTPFlushInterval,
+		format:        cfg.HTTPBatchFormat,
+		overflow:      cfg.HTTPOverflowPolicy,
+		queue:         make(chan Message, cfg.HTTPQueueSize),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+		flushCtx:      flushCtx,
+		abort:         abort,
+	}
+	go a.run()
+	return a
+}
+
+func (a *asyncHTTPAuditLogger) LogChange(ctx context.Context, actorID, action string, before, after any) error {
+	details, err := a.diff(before, after)
+	if err != nil {
+		return err
+	}
+	return a.record(ctx, a, actorID, action, details, true)
+}
+
+// Log validates the event and queues it. Delivery errors are not returned;
+// they are logged and counted in audit_http_dropped.
+func (a *asyncHTTPAuditLogger) Log(ctx context.Context, actorID, action string, details map[string]any) error {
+	return a.record(ctx, a, actorID, action, details, false)
+}
+
+func (a *asyncHTTPAuditLogger) writeEvent(ctx context.Context, evt Event) error {
+	payload, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+	return a.enqueue(ctx, Message{EventID: evt.EventID, Payload: payload})
+}
+
+func (a *asyncHTTPAuditLogger) enqueue(ctx context.Context, msg Message) error {
+	a.mu.RLock()
+	if a.closed {
+		a.mu.RUnlock()
+		return ErrLoggerClosed
+	}
+	a.senders.Add(1)
+	a.mu.RUnlock()
+	defer a.senders.Done()
+
+	m := asyncMetrics()
+	switch a.overflow {
+	case overflowDropNewest, overflowFail:
+		select {
+		case a.queue <- msg:
+		default:
+			m.dropped.Add(ctx, 1, metric.WithAttributes(attribute.String("reason", "queue_full")))
+			if a.overflow == overflowFail {
+				return ErrQueueFull
+			}
+			return nil
+		}
+	default:
+		select {
+		case a.queue <- msg:
+		case <-a.stop:
+			return ErrLoggerClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	m.depth.Add(ctx, 1)
+	return nil
+}
+
+// Close stops accepting events, releasing senders blocked on a full queue,
+// and waits until the queue has been flushed. When ctx is done first, the
+// batch in flight is abandoned and the events still queued are dropped and
+// counted.
+func (a *asyncHTTPAuditLogger) Close(ctx context.Context) error {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.stop)
+	}
+	a.mu.Unlock()
+
+	select {
+	case <-a.done:
+		return nil
+	case <-ctx.Done():
+		a.abort()
+		<-a.done
+		return ctx.Err()
+	}
+}
+
+func (a *asyncHTTPAuditLogger) run() {
+	defer close(a.done)
+	defer a.abort()
+	ticker := time.NewTicker(a.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Message, 0, a.batchSize)
+	for {
+		select {
+		case msg := <-a.queue:
+			batch = a.add(batch, msg)
+		case <-ticker.C:
+			a.flush(batch)
+			batch = batch[:0]
+		case <-a.stop:
+			// no sender can start after stop; wait for those in flight so
+			// their events are drained too
+			a.senders.Wait()
+			for {
+				select {
+				case msg := <-a.queue:
+					batch = a.add(batch, msg)
+				default:
+					a.flush(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+// add appends msg to batch and flushes it when full.
+func (a *asyncHTTPAuditLogger) add(batch []Message, msg Message) []Message {
+	batch = append(batch, msg)
+	if len(batch) < a.batchSize {
+		return batch
+	}
+	a.flush(batch)
+	return batch[:0]
+}
+
+func (a *asyncHTTPAuditLogger) flush(batch []Message) {
+	if len(batch) == 0 {
+		return
+	}
+	ctx := a.flushCtx
+	m := asyncMetrics()
+	m.depth.Add(context.Background(), -int64(len(batch)))
+	if ctx.Err() != nil {
+		m.dropped.Add(context.Background(), int64(len(batch)), metric.WithAttributes(attribute.String("reason", "closed")))
+		return
+	}
+	if err := a.sink.PublishBatch(ctx, batch, a.format); err != nil {
+		reason := "send_failed"
+		if ctx.Err() != nil {
+			reason = "closed"
+		}
+		m.dropped.Add(context.Background(), int64(len(batch)), metric.WithAttributes(attribute.String("reason", reason)))
+		log.FromContext(ctx).WithError(err).WithFields(logrus.Fields{
+			"events": len(batch),
+		}).Warn("failed to send audit batch")
+	}
+}
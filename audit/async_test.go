@@ -0,0 +1,234 @@
+package audit_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	. "github.com/nojyerac/go-lib/audit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// batchSink records the batches posted to /api/auditlog/batch.
+type batchSink struct {
+	mu      sync.Mutex
+	batches [][]map[string]any
+	types   []string
+	release chan struct{}
+	started int
+}
+
+func (s *batchSink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defer GinkgoRecover()
+	s.mu.Lock()
+	s.started++
+	s.mu.Unlock()
+	if s.release != nil {
+		<-s.release
+	}
+	Expect(r.URL.Path).To(Equal("/api/auditlog/batch"))
+	body, err := io.ReadAll(r.Body)
+	Expect(err).NotTo(HaveOccurred())
+
+	var batch []map[string]any
+	if r.Header.Get("Content-Type") == "application/x-ndjson" {
+		scanner := bufio.NewScanner(bytes.NewReader(body))
+		for scanner.Scan() {
+			var evt map[string]any
+			Expect(json.Unmarshal(scanner.Bytes(), &evt)).To(Succeed())
+			batch = append(batch, evt)
+		}
+	} else {
+		Expect(json.Unmarshal(body, &batch)).To(Succeed())
+	}
+
+	s.mu.Lock()
+	s.batches = append(s.batches, batch)
+	s.types = append(s.types, r.Header.Get("Content-Type"))
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *batchSink) requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.started
+}
+
+func (s *batchSink) events() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, b := range s.batches {
+		n += len(b)
+	}
+	return n
+}
+
+var _ = Describe("Async HTTP Logger", func() {
+	var (
+		ctx     context.Context
+		cfg     *Configuration
+		sink    *batchSink
+		server  *httptest.Server
+		logger  AuditLogger
+		actorID = uuid.NewString()
+	)
+
+	BeforeEach(func() {
+		useMetricReader()
+		ctx = context.Background()
+		sink = &batchSink{}
+		cfg = NewConfiguration()
+		cfg.AuditLoggerType = "http"
+		cfg.HTTPAsync = true
+		cfg.HTTPBatchSize = 3
+		cfg.HTTPFlushInterval = time.Hour
+	})
+
+	JustBeforeEach(func() {
+		server = httptest.NewServer(sink)
+		DeferCleanup(server.Close)
+		cfg.AuditLoggerURL = server.URL
+		var err error
+		logger, err = NewAuditLogger(cfg)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	logN := func(n int) {
+		for i := range n {
+			Expect(logger.Log(ctx, actorID, "user.update", map[string]any{"seq": i})).To(Succeed())
+		}
+	}
+
+	It("posts full batches as JSON arrays and flushes the rest on Close", func() {
+		logN(4)
+		Eventually(sink.events).Should(Equal(3))
+
+		Expect(Close(ctx, logger)).To(Succeed())
+		Expect(sink.events()).To(Equal(4))
+		Expect(sink.batches[0]).To(HaveLen(3))
+		Expect(sink.batches[0][0]["details"]).To(Equal(map[string]any{"seq": float64(0)}))
+		Expect(sink.types).To(HaveEach("application/json"))
+
+		Expect(logger.Log(ctx, actorID, "user.update", map[string]any{})).To(MatchError(ErrLoggerClosed))
+	})
+
+	Context("with ndjson batches", func() {
+		BeforeEach(func() {
+			cfg.HTTPBatchFormat = "ndjson"
+		})
+
+		It("posts newline-delimited events", func() {
+			logN(2)
+			Expect(Close(ctx, logger)).To(Succeed())
+			Expect(sink.batches).To(HaveLen(1))
+			Expect(sink.batches[0]).To(HaveLen(2))
+			Expect(sink.types).To(Equal([]string{"application/x-ndjson"}))
+		})
+	})
+
+	It("flushes on the interval", func() {
+		cfg.HTTPFlushInterval = 10 * time.Millisecond
+		logger, err := NewAuditLogger(cfg)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(Close, ctx, logger)
+
+		Expect(logger.Log(ctx, actorID, "user.update", map[string]any{})).To(Succeed())
+		Eventually(sink.events).Should(Equal(1))
+	})
+
+	Context("when the queue overflows", func() {
+		BeforeEach(func() {
+			cfg.HTTPQueueSize = 1
+			cfg.HTTPBatchSize = 1
+			sink.release = make(chan struct{})
+		})
+
+		fill := func() {
+			// the first event is taken by the sender, which then blocks on the
+			// sink; the second fills the queue
+			logN(1)
+			Eventually(sink.requests).Should(Equal(1))
+			logN(1)
+		}
+
+		Context("with drop_newest", func() {
+			BeforeEach(func() {
+				cfg.HTTPOverflowPolicy = "drop_newest"
+			})
+
+			It("drops the event and counts it", func() {
+				before := counterValue("audit_http_dropped", "reason", "queue_full")
+				fill()
+				Expect(logger.Log(ctx, actorID, "user.update", map[string]any{})).To(Succeed())
+				Expect(counterValue("audit_http_dropped", "reason", "queue_full") - before).To(Equal(int64(1)))
+
+				close(sink.release)
+				Expect(Close(ctx, logger)).To(Succeed())
+				Expect(sink.events()).To(Equal(2))
+			})
+		})
+
+		Context("with fail", func() {
+			BeforeEach(func() {
+				cfg.HTTPOverflowPolicy = "fail"
+			})
+
+			It("returns ErrQueueFull", func() {
+				fill()
+				Expect(logger.Log(ctx, actorID, "user.update", map[string]any{})).To(MatchError(ErrQueueFull))
+				close(sink.release)
+				Expect(Close(ctx, logger)).To(Succeed())
+			})
+		})
+
+		Context("with block", func() {
+			It("waits for room until the context is done", func() {
+				fill()
+				timeoutCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+				defer cancel()
+				err := logger.Log(timeoutCtx, actorID, "user.update", map[string]any{})
+				Expect(err).To(MatchError(context.DeadlineExceeded))
+				close(sink.release)
+				Expect(Close(ctx, logger)).To(Succeed())
+			})
+
+			It("releases a waiting sender on Close", func() {
+				fill()
+				logged := make(chan error, 1)
+				go func() { logged <- logger.Log(ctx, actorID, "user.update", map[string]any{}) }()
+				Consistently(logged, 20*time.Millisecond).ShouldNot(Receive())
+
+				closed := make(chan error, 1)
+				go func() { closed <- Close(ctx, logger) }()
+				Eventually(logged).Should(Receive(MatchError(ErrLoggerClosed)))
+				close(sink.release)
+				Eventually(closed).Should(Receive(BeNil()))
+				Expect(sink.events()).To(Equal(2))
+			})
+		})
+	})
+
+	It("gives up waiting on Close when the context is done", func() {
+		sink.release = make(chan struct{})
+		DeferCleanup(func() { close(sink.release) })
+		before := counterValue("audit_http_dropped", "reason", "closed")
+		// one batch in flight and one event still queued
+		logN(4)
+		Eventually(sink.requests).Should(Equal(1))
+
+		closeCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		Expect(Close(closeCtx, logger)).To(MatchError(context.DeadlineExceeded))
+		Expect(counterValue("audit_http_dropped", "reason", "closed") - before).To(Equal(int64(4)))
+	})
+})
@@ -0,0 +1,137 @@
+// Command auditctl inspects audit logs written by the audit package.
+//
+// Usage:
+//
+//	go run ./audit/auditctl verify [--hmac-key-file f | --ed25519-public-key-file f] [--allow-restarts] audit.jsonl
+//	go run ./audit/auditctl query [filters] audit.jsonl audit.jsonl.*.gz
+//	go run ./audit/auditctl query [filters] --dsn postgres://... --table audit_outbox_dlq
+//	go run ./audit/auditctl replay [filters] --url https://audit.example.com [--dry-run] audit.jsonl
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/nojyerac/go-lib/audit"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: auditctl <command> [flags] [args]\n\nCommands:\n")
+		fmt.Fprintf(os.Stderr, "  verify   check the hash chain (and signatures) of a JSONL audit file\n")
+		fmt.Fprintf(os.Stderr, "  query    print matching events from audit files or outbox tables as JSONL\n")
+		fmt.Fprintf(os.Stderr, "  replay   re-publish matching events to an HTTP audit sink\n")
+	}
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	var err error
+	switch cmd, args := flag.Arg(0), flag.Args()[1:]; cmd {
+	case "verify":
+		err = verify(args)
+	case "query":
+		err = query(args)
+	case "replay":
+		err = replay(args)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", cmd)
+		flag.Usage()
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func verify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	var (
+		hmacKeyFile = fs.String("hmac-key-file", "", "file holding the HMAC-SHA256 signing key")
+		ed25519File = fs.String("ed25519-public-key-file", "", "PEM (PKIX) or base64 Ed25519 public key file")
+		restarts    = fs.Bool("allow-restarts", false, "accept chains started again with an empty prevHash")
+	)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: auditctl verify [flags] [file]\n\n"+
+			"Reads stdin when no file is given. Files ending in .gz are decompressed.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	var opts []audit.VerifyOption
+	switch {
+	case *hmacKeyFile != "" && *ed25519File != "":
+		return errors.New("--hmac-key-file and --ed25519-public-key-file are mutually exclusive")
+	case *hmacKeyFile != "":
+		key, err := os.ReadFile(*hmacKeyFile)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, audit.WithSignatureVerifier(audit.HMACSigner{Key: []byte(strings.TrimSpace(string(key)))}))
+	case *ed25519File != "":
+		key, err := readEd25519PublicKey(*ed25519File)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, audit.WithSignatureVerifier(audit.Ed25519Verifier{Key: key}))
+	}
+
+	if *restarts {
+		opts = append(opts, audit.WithRestarts())
+	}
+
+	var in io.Reader = os.Stdin
+	if fs.NArg() > 0 {
+		f, err := audit.OpenFile(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	report, err := audit.VerifyChain(in, opts...)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("ok: %d records in %d chains verified (%d restarts)\n", report.Records, report.Chains, report.Restarts)
+	return nil
+}
+
+func readEd25519PublicKey(path string) (ed25519.PublicKey, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if block, _ := pem.Decode(raw); block != nil {
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := pub.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("%s: not an Ed25519 public key", path)
+		}
+		return key, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(raw)))
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("%s: invalid Ed25519 public key size %d", path, len(key))
+	}
+	return ed25519.PublicKey(key), nil
+}
@@ -0,0 +1,222 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// FieldType is the JSON type a detail field must have.
+type FieldType string
+
+const (
+	FieldString FieldType = "string"
+	FieldNumber FieldType = "number"
+	FieldBool   FieldType = "bool"
+	FieldObject FieldType = "object"
+	FieldArray  FieldType = "array"
+	// FieldAny accepts any value, including nil.
+	FieldAny FieldType = "any"
+)
+
+// Field declares one top-level key of an action's details.
+type Field struct {
+	Name        string    `json:"name"`
+	Type        FieldType `json:"type"`
+	Required    bool      `json:"required,omitempty"`
+	Sensitive   bool      `json:"sensitive,omitempty"`
+	Description string    `json:"description,omitempty"`
+}
+
+// ActionSpec declares an audit action and the schema of its details.
+type ActionSpec struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description,omitempty"`
+	Fields      []Field `json:"fields"`
+}
+
+// Catalog is a registry of known audit actions. Loggers created with
+// WithActionCatalog check the details of every cataloged action against its
+// spec and redact its sensitive fields. Its JSON form lists every action,
+// sorted by name, for review outside the code.
+type Catalog struct {
+	actions map[string]*catalogEntry
+}
+
+type catalogEntry struct {
+	spec   ActionSpec
+	fields map[string]Field
+	redact *redactor
+}
+
+// NewCatalog builds a Catalog from specs. Action names and the field names of
+// each action must be non-empty and unique, and field types must be one of
+// the FieldType constants.
+func NewCatalog(specs ...ActionSpec) (*Catalog, error) {
+	c := &Catalog{actions: make(map[string]*catalogEntry, len(specs))}
+	for _, spec := range specs {
+		entry, err := newCatalogEntry(spec)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := c.actions[spec.Name]; ok {
+			return nil, fmt.Errorf("audit action %q is declared twice", spec.Name)
+		}
+		c.actions[spec.Name] = entry
+	}
+	return c, nil
+}
+
+func newCatalogEntry(spec ActionSpec) (*catalogEntry, error) {
+	if spec.Name == "" {
+		return nil, errors.New("audit action name is required")
+	}
+	entry := &catalogEntry{spec: spec, fields: make(map[string]Field, len(spec.Fields))}
+	var sensitive []string
+	for _, field := range spec.Fields {
+		if field.Name == "" || strings.Contains(field.Name, ".") {
+			return nil, fmt.Errorf("audit action %q: invalid field name %q", spec.Name, field.Name)
+		}
+		switch field.Type {
+		case FieldString, FieldNumber, FieldBool, FieldObject, FieldArray, FieldAny:
+		default:
+			return nil, fmt.Errorf("audit action %q: field %q has unsupported type %q",
+				spec.Name, field.Name, field.Type)
+		}
+		if _, ok := entry.fields[field.Name]; ok {
+			return nil, fmt.Errorf("audit action %q: field %q is declared twice", spec.Name, field.Name)
+		}
+		entry.fields[field.Name] = field
+		if field.Sensitive {
+			sensitive = append(sensitive, field.Name)
+		}
+	}
+	if len(sensitive) > 0 {
+		entry.redact = newRedactor([]RedactionRule{{Name: "catalog:" + spec.Name, Paths: sensitive}})
+	}
+	return entry, nil
+}
+
+// Lookup returns the spec of action.
+func (c *Catalog) Lookup(action string) (ActionSpec, bool) {
+	entry, ok := c.actions[action]
+	if !ok {
+		return ActionSpec{}, false
+	}
+	return entry.spec, true
+}
+
+// Actions returns every spec, sorted by name.
+func (c *Catalog) Actions() []ActionSpec {
+	specs := make([]ActionSpec, 0, len(c.actions))
+	for _, entry := range c.actions {
+		specs = append(specs, entry.spec)
+	}
+	sort.Slice(specs, func(i, j int) bool { return specs[i].Name < specs[j].Name })
+	return specs
+}
+
+// MarshalJSON exports the catalog with the event schema version it applies to.
+func (c *Catalog) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		SchemaVersion string       `json:"schemaVersion"`
+		Actions       []ActionSpec `json:"actions"`
+	}{SchemaVersion: SchemaVersion, Actions: c.Actions()})
+}
+
+// check validates details against the spec of action. Unknown actions and
+// undeclared fields are rejected only when strict is set. fromDiff marks
+// LogChange details, which map changed dotted paths to changes: unchanged
+// required fields are absent and only the changed values can be checked.
+func (c *Catalog) check(action string, details map[string]any, strict, fromDiff bool) (*catalogEntry, error) {
+	entry, ok := c.actions[action]
+	if !ok {
+		if strict {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownAction, action)
+		}
+		return nil, nil
+	}
+	if err := entry.check(details, strict, fromDiff); err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrInvalidEventDetails, action, err)
+	}
+	return entry, nil
+}
+
+func (e *catalogEntry) check(details map[string]any, strict, fromDiff bool) error {
+	for key, value := range details {
+		name, _, nested := strings.Cut(key, ".")
+		field, ok := e.fields[name]
+		if !ok {
+			if strict {
+				return fmt.Errorf("undeclared field %q", name)
+			}
+			continue
+		}
+		if nested {
+			continue
+		}
+		if err := field.check(value); err != nil {
+			return err
+		}
+	}
+	if fromDiff {
+		return nil
+	}
+	for _, field := range e.spec.Fields {
+		if _, ok := details[field.Name]; field.Required && !ok {
+			return fmt.Errorf("missing required field %q", field.Name)
+		}
+	}
+	return nil
+}
+
+func (f Field) check(value any) error {
+	if c, ok := value.(change); ok {
+		// a nil side means the field was added or removed
+		for _, side := range []any{c.OldValue, c.NewValue} {
+			if side == nil {
+				continue
+			}
+			if err := f.check(side); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if f.Type == FieldAny || (value == nil && !f.Required) {
+		return nil
+	}
+	if got := fieldTypeOf(value); got != f.Type {
+		return fmt.Errorf("field %q must be %s, got %s", f.Name, f.Type, got)
+	}
+	return nil
+}
+
+// fieldTypeOf returns the JSON type value is serialized as, so that e.g.
+// []byte is a string and a time.Time, whose MarshalJSON writes a string, is
+// not an object.
+func fieldTypeOf(value any) FieldType {
+	if _, ok := value.(json.Number); ok {
+		return FieldNumber
+	}
+	raw, err := json.Marshal(value)
+	if err != nil || len(raw) == 0 {
+		return "unserializable"
+	}
+	switch raw[0] {
+	case '"':
+		return FieldString
+	case '{':
+		return FieldObject
+	case '[':
+		return FieldArray
+	case 't', 'f':
+		return FieldBool
+	case 'n':
+		return "null"
+	default:
+		return FieldNumber
+	}
+}
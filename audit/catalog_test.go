@@ -0,0 +1,171 @@
+package audit_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	. "github.com/nojyerac/go-lib/audit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Action catalog", func() {
+	var (
+		out     bytes.Buffer
+		catalog *Catalog
+		opts    []Option
+		logger  AuditLogger
+		ctx     = context.Background()
+		actorID = uuid.NewString()
+	)
+
+	BeforeEach(func() {
+		out.Reset()
+		opts = nil
+		var err error
+		catalog, err = NewCatalog(
+			ActionSpec{
+				Name:        "user.update",
+				Description: "A user's profile was changed.",
+				Fields: []Field{
+					{Name: "user_id", Type: FieldString, Required: true},
+					{Name: "email", Type: FieldString, Sensitive: true},
+					{Name: "age", Type: FieldNumber},
+					{Name: "roles", Type: FieldArray},
+					{Name: "address", Type: FieldObject},
+				},
+			},
+			ActionSpec{Name: "user.login", Fields: []Field{{Name: "mfa", Type: FieldBool, Required: true}}},
+		)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	JustBeforeEach(func() {
+		cfg := NewConfiguration()
+		cfg.AuditLoggerType = "stdout"
+		var err error
+		logger, err = NewAuditLogger(cfg, append([]Option{WithOutput(&out), WithActionCatalog(catalog)}, opts...)...)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	details := func() map[string]any {
+		var evt Event
+		Expect(json.Unmarshal(out.Bytes(), &evt)).To(Succeed())
+		return evt.Details
+	}
+
+	It("accepts details matching the spec and redacts sensitive fields", func() {
+		Expect(logger.Log(ctx, actorID, "user.update", map[string]any{
+			"user_id":    "u1",
+			"email":      "ada@example.com",
+			"age":        36,
+			"roles":      []string{"admin"},
+			"address":    struct{ City string }{City: "Paris"},
+			"changed_at": time.Now(),
+		})).To(Succeed())
+
+		Expect(details()).To(HaveKeyWithValue("email", RedactedValue))
+		Expect(details()).To(HaveKeyWithValue("user_id", "u1"))
+	})
+
+	DescribeTable("rejects details that do not match the spec",
+		func(action string, d map[string]any, msg string) {
+			err := logger.Log(ctx, actorID, action, d)
+			Expect(err).To(MatchError(ErrInvalidEventDetails))
+			Expect(err).To(MatchError(ContainSubstring(msg)))
+			Expect(out.Len()).To(BeZero())
+		},
+		Entry("missing required field", "user.update", map[string]any{"email": "a"},
+			`missing required field "user_id"`),
+		Entry("wrong type", "user.update", map[string]any{"user_id": "u1", "age": "36"},
+			`field "age" must be number, got string`),
+		Entry("nil required field", "user.login", map[string]any{"mfa": nil},
+			`field "mfa" must be bool, got null`),
+		Entry("bytes, which marshal to a string", "user.update", map[string]any{"user_id": "u1", "roles": []byte("admin")},
+			`field "roles" must be array, got string`),
+		Entry("JSON marshalers of a struct type", "user.update", map[string]any{"user_id": "u1", "address": time.Now()},
+			`field "address" must be object, got string`),
+	)
+
+	It("logs unknown actions unchecked", func() {
+		Expect(logger.Log(ctx, actorID, "user.delete", map[string]any{"x": 1})).To(Succeed())
+	})
+
+	It("checks the changed values of LogChange", func() {
+		Expect(logger.LogChange(ctx, actorID, "user.update",
+			map[string]any{"email": "a@example.com", "address": map[string]any{"city": "Paris"}},
+			map[string]any{"email": "b@example.com", "address": map[string]any{"city": "Rome"}},
+		)).To(Succeed())
+		Expect(details()).To(HaveKeyWithValue("email", map[string]any{
+			"old_value": RedactedValue, "new_value": RedactedValue,
+		}))
+
+		err := logger.LogChange(ctx, actorID, "user.update", map[string]any{"age": 1}, map[string]any{"age": "2"})
+		Expect(err).To(MatchError(ContainSubstring(`field "age" must be number, got string`)))
+	})
+
+	It("does not require fields in a LogChange that changes nothing", func() {
+		state := map[string]any{"user_id": "u1", "age": 36}
+		Expect(logger.LogChange(ctx, actorID, "user.update", state, state)).To(Succeed())
+		Expect(details()).To(BeEmpty())
+	})
+
+	Context("when strict", func() {
+		BeforeEach(func() {
+			opts = append(opts, WithStrictCatalog())
+		})
+
+		It("rejects unknown actions", func() {
+			err := logger.Log(ctx, actorID, "user.delete", map[string]any{})
+			Expect(err).To(MatchError(ErrUnknownAction))
+		})
+
+		It("rejects undeclared fields", func() {
+			err := logger.Log(ctx, actorID, "user.login", map[string]any{"mfa": true, "ip": "10.0.0.1"})
+			Expect(err).To(MatchError(ContainSubstring(`undeclared field "ip"`)))
+		})
+	})
+
+	Describe("NewCatalog", func() {
+		DescribeTable("rejects invalid specs",
+			func(specs []ActionSpec, msg string) {
+				_, err := NewCatalog(specs...)
+				Expect(err).To(MatchError(ContainSubstring(msg)))
+			},
+			Entry("unnamed action", []ActionSpec{{}}, "audit action name is required"),
+			Entry("duplicate action", []ActionSpec{{Name: "a"}, {Name: "a"}}, `audit action "a" is declared twice`),
+			Entry("dotted field", []ActionSpec{{Name: "a", Fields: []Field{{Name: "x.y", Type: FieldAny}}}},
+				`invalid field name "x.y"`),
+			Entry("unknown type", []ActionSpec{{Name: "a", Fields: []Field{{Name: "x", Type: "date"}}}},
+				`unsupported type "date"`),
+			Entry("duplicate field", []ActionSpec{{Name: "a", Fields: []Field{
+				{Name: "x", Type: FieldAny}, {Name: "x", Type: FieldAny},
+			}}}, `field "x" is declared twice`),
+		)
+	})
+
+	It("exports the catalog sorted by action", func() {
+		spec, ok := catalog.Lookup("user.login")
+		Expect(ok).To(BeTrue())
+		Expect(spec.Fields).To(HaveLen(1))
+
+		payload, err := json.Marshal(catalog)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(payload).To(MatchJSON(`{
+			"schemaVersion": "` + SchemaVersion + `",
+			"actions": [
+				{"name": "user.login", "fields": [{"name": "mfa", "type": "bool", "required": true}]},
+				{"name": "user.update", "description": "A user's profile was changed.", "fields": [
+					{"name": "user_id", "type": "string", "required": true},
+					{"name": "email", "type": "string", "sensitive": true},
+					{"name": "age", "type": "number"},
+					{"name": "roles", "type": "array"},
+					{"name": "address", "type": "object"}
+				]}
+			]
+		}`))
+	})
+})
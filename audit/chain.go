@@ -0,0 +1,292 @@
+package audit
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+var ErrInvalidSignature = errors.New("invalid audit event signature")
+
+// Signer signs the hash of a chained event. Signatures are base64 encoded.
+type Signer interface {
+	Sign(digest []byte) (string, error)
+}
+
+// SignatureVerifier checks signatures produced by a Signer.
+type SignatureVerifier interface {
+	Verify(digest []byte, signature string) error
+}
+
+// HMACSigner signs and verifies with HMAC-SHA256 over a shared key.
+type HMACSigner struct {
+	Key []byte
+}
+
+func (s HMACSigner) Sign(digest []byte) (string, error) {
+	return base64.StdEncoding.EncodeToString(s.mac(digest)), nil
+}
+
+func (s HMACSigner) Verify(digest []byte, signature string) error {
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(sig, s.mac(digest)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func (s HMACSigner) mac(digest []byte) []byte {
+	mac := hmac.New(sha256.New, s.Key)
+	mac.Write(digest)
+	return mac.Sum(nil)
+}
+
+// Ed25519Signer signs with an Ed25519 private key.
+type Ed25519Signer struct {
+	Key ed25519.PrivateKey
+}
+
+func (s Ed25519Signer) Sign(digest []byte) (string, error) {
+	if len(s.Key) != ed25519.PrivateKeySize {
+		return "", fmt.Errorf("ed25519 signer: invalid private key size %d", len(s.Key))
+	}
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(s.Key, digest)), nil
+}
+
+// Ed25519Verifier verifies signatures with an Ed25519 public key.
+type Ed25519Verifier struct {
+	Key ed25519.PublicKey
+}
+
+func (v Ed25519Verifier) Verify(digest []byte, signature string) error {
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || len(v.Key) != ed25519.PublicKeySize || !ed25519.Verify(v.Key, digest, sig) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// hashChain links each event to the previous one in the same partition.
+type hashChain struct {
+	mu        sync.Mutex
+	partition func(Event) string
+	signer    Signer
+	last      map[string]string
+}
+
+func newHashChain(enabled bool, partition func(Event) string, signer Signer) *hashChain {
+	if !enabled && signer == nil {
+		return nil
+	}
+	return &hashChain{
+		partition: partition,
+		signer:    signer,
+		last:      make(map[string]string),
+	}
+}
+
+// append seals evt onto its partition's chain and calls write. The chain only
+// advances when write succeeds, so a failed write does not leave a gap.
+func (c *hashChain) append(evt *Event, write func() error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.partition != nil {
+		evt.ChainID = c.partition(*evt)
+	}
+	evt.PrevHash = c.last[evt.ChainID]
+	evt.Hash, evt.Signature = "", ""
+
+	payload, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+	digest, err := chainDigest(payload)
+	if err != nil {
+		return err
+	}
+	evt.Hash = hex.EncodeToString(digest)
+	if c.signer != nil {
+		if evt.Signature, err = c.signer.Sign(digest); err != nil {
+			return err
+		}
+	}
+
+	if err := write(); err != nil {
+		return err
+	}
+	c.last[evt.ChainID] = evt.Hash
+	return nil
+}
+
+// seed continues chainID from hash, the last hash written to it before the
+// logger started.
+func (c *hashChain) seed(chainID, hash string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.last[chainID] = hash
+}
+
+// chainDigest hashes the canonical form of a serialized event: the JSON
+// re-encoded with sorted keys and exact numbers, without hash and signature.
+// Using the canonical form lets a verifier recompute the digest from any
+// serialization of the record, pretty-printed or not.
+func chainDigest(payload []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	var record map[string]any
+	if err := dec.Decode(&record); err != nil {
+		return nil, err
+	}
+	delete(record, "hash")
+	delete(record, "signature")
+	canonical, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(canonical)
+	return sum[:], nil
+}
+
+// ChainBreakError reports the first record that fails chain verification.
+type ChainBreakError struct {
+	// Record is the 1-based position of the record in the input.
+	Record  int
+	EventID string
+	Reason  string
+}
+
+func (e *ChainBreakError) Error() string {
+	return fmt.Sprintf("audit chain broken at record %d (event %s): %s", e.Record, e.EventID, e.Reason)
+}
+
+// VerifyReport summarizes a successful verification.
+type VerifyReport struct {
+	Records int
+	Chains  int
+	// Restarts counts records accepted with WithRestarts.
+	Restarts int
+}
+
+type VerifyOption func(*verifyOptions)
+
+type verifyOptions struct {
+	verifier SignatureVerifier
+	restarts bool
+}
+
+// WithRestarts accepts a record with an empty prevHash after earlier records
+// of its chain as the start of a new run of the chain, such as the first
+// record of a stdout logger after a restart, and counts it in
+// VerifyReport.Restarts. Records removed just before a restart are not
+// detected, so compare the count with the service's known restarts.
+func WithRestarts() VerifyOption {
+	return func(o *verifyOptions) {
+		o.restarts = true
+	}
+}
+
+// WithSignatureVerifier requires every record to carry a valid signature.
+func WithSignatureVerifier(verifier SignatureVerifier) VerifyOption {
+	return func(o *verifyOptions) {
+		o.verifier = verifier
+	}
+}
+
+// VerifyChain reads a stream of audit events (JSON Lines or concatenated JSON
+// objects) and checks that every record's hash matches its content and links
+// to the previous record of the same chain. It returns a *ChainBreakError for
+// the first broken record.
+//
+// The first record of each chain is accepted as an anchor whatever its
+// prevHash, so rotated files can be verified on their own. Any later record
+// with an empty prevHash is a break unless WithRestarts is given. Records
+// removed from the end of a stream cannot be detected from the stream alone.
+func VerifyChain(r io.Reader, opts ...VerifyOption) (VerifyReport, error) {
+	o := &verifyOptions{}
+	for _, applyOpt := range opts {
+		applyOpt(o)
+	}
+
+	var (
+		report VerifyReport
+		last   = make(map[string]string)
+		dec    = json.NewDecoder(r)
+	)
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				report.Chains = len(last)
+				return report, nil
+			}
+			return report, fmt.Errorf("read record %d: %w", report.Records+1, err)
+		}
+		report.Records++
+
+		restart, err := verifyRecord(raw, last, o)
+		if err != nil {
+			err.Record = report.Records
+			return report, err
+		}
+		if restart {
+			report.Restarts++
+		}
+	}
+}
+
+// verifyRecord checks one record against the last hash of its chain and
+// reports whether it restarts a chain seen before.
+func verifyRecord(raw json.RawMessage, last map[string]string, o *verifyOptions) (bool, *ChainBreakError) {
+	var header struct {
+		EventID   string `json:"eventID"`
+		ChainID   string `json:"chainID"`
+		PrevHash  string `json:"prevHash"`
+		Hash      string `json:"hash"`
+		Signature string `json:"signature"`
+	}
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return false, &ChainBreakError{Reason: err.Error()}
+	}
+	broken := func(reason string) *ChainBreakError {
+		return &ChainBreakError{EventID: header.EventID, Reason: reason}
+	}
+
+	if header.Hash == "" {
+		return false, broken("missing hash")
+	}
+	prev, seen := last[header.ChainID]
+	restart := seen && header.PrevHash == ""
+	if restart && !o.restarts {
+		return false, broken("chain restarted with an empty prevHash")
+	}
+	if seen && !restart && prev != header.PrevHash {
+		return false, broken("prevHash does not match the previous record")
+	}
+	digest, err := chainDigest(raw)
+	if err != nil {
+		return false, broken(err.Error())
+	}
+	if hex.EncodeToString(digest) != header.Hash {
+		return false, broken("hash does not match record content")
+	}
+	if o.verifier != nil {
+		if header.Signature == "" {
+			return false, broken("missing signature")
+		}
+		if err := o.verifier.Verify(digest, header.Signature); err != nil {
+			return false, broken(err.Error())
+		}
+	}
+
+	last[header.ChainID] = header.Hash
+	return restart, nil
+}
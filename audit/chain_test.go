@@ -0,0 +1,208 @@
+package audit_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/google/uuid"
+	. "github.com/nojyerac/go-lib/audit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Hash chain", func() {
+	var (
+		out     bytes.Buffer
+		opts    []Option
+		logger  AuditLogger
+		actorID = uuid.NewString()
+	)
+
+	BeforeEach(func() {
+		out.Reset()
+		opts = []Option{WithHashChain(nil)}
+	})
+
+	JustBeforeEach(func() {
+		cfg := NewConfiguration()
+		cfg.AuditLoggerType = "stdout"
+		var err error
+		logger, err = NewAuditLogger(cfg, append([]Option{WithOutput(&out), WithTimeNow(timeNow)}, opts...)...)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	logN := func(n int) {
+		for i := range n {
+			Expect(logger.Log(context.Background(), actorID, "user.update",
+				map[string]any{"seq": i, "big": uint64(12345678901234567890)})).To(Succeed())
+		}
+	}
+
+	// records re-encodes the pretty-printed output as compact JSON Lines.
+	records := func() []map[string]any {
+		dec := json.NewDecoder(&out)
+		dec.UseNumber()
+		var recs []map[string]any
+		for dec.More() {
+			var rec map[string]any
+			Expect(dec.Decode(&rec)).To(Succeed())
+			recs = append(recs, rec)
+		}
+		return recs
+	}
+
+	jsonl := func(recs []map[string]any) string {
+		var b strings.Builder
+		for _, rec := range recs {
+			line, err := json.Marshal(rec)
+			Expect(err).NotTo(HaveOccurred())
+			b.Write(line)
+			b.WriteByte('\n')
+		}
+		return b.String()
+	}
+
+	It("links each event to the previous one", func() {
+		logN(3)
+		recs := records()
+		Expect(recs).To(HaveLen(3))
+		Expect(recs[0]).NotTo(HaveKey("prevHash"))
+		Expect(recs[1]["prevHash"]).To(Equal(recs[0]["hash"]))
+		Expect(recs[2]["prevHash"]).To(Equal(recs[1]["hash"]))
+
+		report, err := VerifyChain(strings.NewReader(jsonl(recs)))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report).To(Equal(VerifyReport{Records: 3, Chains: 1}))
+	})
+
+	It("reports a chain started again by a restarted logger, unless restarts are allowed", func() {
+		logN(2)
+		before := records()
+		// a new logger writing to the same stream, as after a restart
+		cfg := NewConfiguration()
+		cfg.AuditLoggerType = "stdout"
+		restarted, err := NewAuditLogger(cfg, append([]Option{WithOutput(&out), WithTimeNow(timeNow)}, opts...)...)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(restarted.Log(context.Background(), actorID, "user.update", map[string]any{"seq": 2})).To(Succeed())
+		recs := append(before, records()...)
+		Expect(recs[2]).NotTo(HaveKey("prevHash"))
+
+		_, err = VerifyChain(strings.NewReader(jsonl(recs)))
+		var chainErr *ChainBreakError
+		Expect(errors.As(err, &chainErr)).To(BeTrue())
+		Expect(chainErr.Record).To(Equal(3))
+		Expect(chainErr.Reason).To(ContainSubstring("restarted"))
+
+		report, err := VerifyChain(strings.NewReader(jsonl(recs)), WithRestarts())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report).To(Equal(VerifyReport{Records: 3, Chains: 1, Restarts: 1}))
+
+		// a restart cannot hide records removed before it
+		_, err = VerifyChain(strings.NewReader(jsonl([]map[string]any{recs[0], recs[2]})))
+		Expect(err).To(MatchError(ContainSubstring("restarted")))
+	})
+
+	It("verifies the pretty-printed stream as written", func() {
+		logN(2)
+		report, err := VerifyChain(&out)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Records).To(Equal(2))
+	})
+
+	It("reports the first altered record", func() {
+		logN(3)
+		recs := records()
+		recs[1]["action"] = "user.delete"
+
+		_, err := VerifyChain(strings.NewReader(jsonl(recs)))
+		var chainErr *ChainBreakError
+		Expect(errors.As(err, &chainErr)).To(BeTrue())
+		Expect(chainErr.Record).To(Equal(2))
+		Expect(chainErr.EventID).To(Equal(recs[1]["eventID"]))
+		Expect(chainErr.Reason).To(ContainSubstring("hash does not match"))
+	})
+
+	It("reports a removed record", func() {
+		logN(3)
+		recs := records()
+
+		_, err := VerifyChain(strings.NewReader(jsonl([]map[string]any{recs[0], recs[2]})))
+		var chainErr *ChainBreakError
+		Expect(errors.As(err, &chainErr)).To(BeTrue())
+		Expect(chainErr.Record).To(Equal(2))
+		Expect(chainErr.Reason).To(ContainSubstring("prevHash"))
+	})
+
+	It("accepts a stream that starts mid-chain", func() {
+		logN(3)
+		recs := records()
+
+		_, err := VerifyChain(strings.NewReader(jsonl(recs[1:])))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	Context("with partitions", func() {
+		BeforeEach(func() {
+			opts = []Option{WithHashChain(func(e Event) string { return e.Details["tenant"].(string) })}
+		})
+
+		It("keeps an independent chain per partition", func() {
+			for _, tenant := range []string{"a", "b", "a"} {
+				Expect(logger.Log(context.Background(), actorID, "user.update",
+					map[string]any{"tenant": tenant})).To(Succeed())
+			}
+			recs := records()
+			Expect(recs[0]["chainID"]).To(Equal("a"))
+			Expect(recs[1]).NotTo(HaveKey("prevHash"))
+			Expect(recs[2]["prevHash"]).To(Equal(recs[0]["hash"]))
+
+			report, err := VerifyChain(strings.NewReader(jsonl(recs)))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(report.Chains).To(Equal(2))
+		})
+	})
+
+	Context("with an HMAC signer", func() {
+		signer := HMACSigner{Key: []byte("chain-key")}
+
+		BeforeEach(func() {
+			opts = []Option{WithSigner(signer)}
+		})
+
+		It("signs every event", func() {
+			logN(2)
+			recs := records()
+			Expect(recs[0]).To(HaveKey("signature"))
+
+			_, err := VerifyChain(strings.NewReader(jsonl(recs)), WithSignatureVerifier(signer))
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = VerifyChain(strings.NewReader(jsonl(recs)),
+				WithSignatureVerifier(HMACSigner{Key: []byte("other-key")}))
+			Expect(err).To(MatchError(ContainSubstring(ErrInvalidSignature.Error())))
+		})
+	})
+
+	Context("with an Ed25519 signer", func() {
+		pub, priv, _ := ed25519.GenerateKey(nil)
+
+		BeforeEach(func() {
+			opts = []Option{WithSigner(Ed25519Signer{Key: priv})}
+		})
+
+		It("detects a re-hashed record without a valid signature", func() {
+			logN(1)
+			recs := records()
+			_, err := VerifyChain(strings.NewReader(jsonl(recs)), WithSignatureVerifier(Ed25519Verifier{Key: pub}))
+			Expect(err).NotTo(HaveOccurred())
+
+			delete(recs[0], "signature")
+			_, err = VerifyChain(strings.NewReader(jsonl(recs)), WithSignatureVerifier(Ed25519Verifier{Key: pub}))
+			Expect(err).To(MatchError(ContainSubstring("missing signature")))
+		})
+	})
+})
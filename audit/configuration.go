@@ -6,28 +6,99 @@ import (
 	"time"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/nojyerac/go-lib/auth"
 )
 
 type Configuration struct {
-	AuditLoggerType string `config:"audit_logger_type" validate:"required,oneof=noop stdout http"`
+	AuditLoggerType string `config:"audit_logger_type" validate:"required,oneof=noop stdout http outbox file"`
 	AuditLoggerURL  string `config:"audit_logger_url" validate:"required_if=AuditLoggerType http,omitempty,url"`
 	MaxPayloadBytes int    `config:"audit_max_payload_bytes" validate:"gte=0"`
+
+	DispatchInterval    time.Duration `config:"audit_dispatch_interval" validate:"gt=0"`
+	DispatchBatchSize   int           `config:"audit_dispatch_batch_size" validate:"gt=0"`
+	DispatchLease       time.Duration `config:"audit_dispatch_lease" validate:"gt=0"`
+	DispatchMaxAttempts int           `config:"audit_dispatch_max_attempts" validate:"gt=0"`
+	DispatchBaseBackoff time.Duration `config:"audit_dispatch_base_backoff" validate:"gt=0"`
+	DispatchMaxBackoff  time.Duration `config:"audit_dispatch_max_backoff" validate:"gtefield=DispatchBaseBackoff"`
+
+	HTTPPath          string `config:"audit_http_path" validate:"startswith=/"`
+	HTTPBatchPath     string `config:"audit_http_batch_path" validate:"startswith=/"`
+	HTTPTLSCert       string `config:"audit_http_tls_cert" validate:"required_with=HTTPTLSKey"`
+	HTTPTLSKey        string `config:"audit_http_tls_key" validate:"required_with=HTTPTLSCert"`
+	HTTPTLSRootCA     string `config:"audit_http_tls_root_ca"`
+	HTTPSigningSecret string `config:"audit_http_signing_secret" sensitive:"true"`
+
+	HTTPAsync          bool          `config:"audit_http_async"`
+	HTTPQueueSize      int           `config:"audit_http_queue_size" validate:"gt=0"`
+	HTTPBatchSize      int           `config:"audit_http_batch_size" validate:"gt=0"`
+	HTTPFlushInterval  time.Duration `config:"audit_http_flush_interval" validate:"gt=0"`
+	HTTPBatchFormat    string        `config:"audit_http_batch_format" validate:"oneof=json ndjson"`
+	HTTPOverflowPolicy string        `config:"audit_http_overflow_policy" validate:"oneof=block drop_newest fail"`
+	HTTPMaxRetries     int           `config:"audit_http_max_retries" validate:"gte=0"`
+	HTTPRetryBaseDelay time.Duration `config:"audit_http_retry_base_delay" validate:"gt=0"`
+	HTTPRetryMaxDelay  time.Duration `config:"audit_http_retry_max_delay" validate:"gtefield=HTTPRetryBaseDelay"`
+
+	FilePath         string        `config:"audit_file_path" validate:"required_if=AuditLoggerType file"`
+	FileMaxSizeBytes int64         `config:"audit_file_max_size_bytes" validate:"gte=0"`
+	FileMaxAge       time.Duration `config:"audit_file_max_age" validate:"gte=0"`
+	FileMaxBackups   int           `config:"audit_file_max_backups" validate:"gte=0"`
+	FileCompress     bool          `config:"audit_file_compress"`
+	FileSyncPolicy   string        `config:"audit_file_sync_policy" validate:"oneof=always interval never"`
+	FileSyncInterval time.Duration `config:"audit_file_sync_interval" validate:"gt=0"`
 }
 
 func NewConfiguration() *Configuration {
 	return &Configuration{
 		AuditLoggerType: "noop",
 		MaxPayloadBytes: 4096, // 4 KB default max payload size
+
+		DispatchInterval:    time.Second,
+		DispatchBatchSize:   100,
+		DispatchLease:       time.Minute,
+		DispatchMaxAttempts: 10,
+		DispatchBaseBackoff: time.Second,
+		DispatchMaxBackoff:  5 * time.Minute,
+
+		HTTPPath:      "/api/auditlog",
+		HTTPBatchPath: "/api/auditlog/batch",
+
+		HTTPQueueSize:      1000,
+		HTTPBatchSize:      100,
+		HTTPFlushInterval:  time.Second,
+		HTTPBatchFormat:    "json",
+		HTTPOverflowPolicy: "block",
+		HTTPMaxRetries:     3,
+		HTTPRetryBaseDelay: 200 * time.Millisecond,
+		HTTPRetryMaxDelay:  5 * time.Second,
+
+		FileMaxSizeBytes: 100 << 20, // 100 MiB
+		FileMaxAge:       24 * time.Hour,
+		FileMaxBackups:   7,
+		FileCompress:     true,
+		FileSyncPolicy:   "interval",
+		FileSyncInterval: time.Second,
 	}
 }
 
 type Option func(*options)
 
 type options struct {
-	validator  *validator.Validate
-	output     io.Writer
-	now        func() time.Time
-	httpClient *http.Client
+	validator       *validator.Validate
+	output          io.Writer
+	now             func() time.Time
+	httpClient      *http.Client
+	jitter          func() float64
+	newID           func() string
+	redaction       []RedactionRule
+	ignoredFields   []string
+	chain           bool
+	partition       func(Event) string
+	signer          Signer
+	tokens          TokenSource
+	catalog         *Catalog
+	strictCatalog   bool
+	claimsActorType func(*auth.Claims) string
+	actorRules      map[string]string
 }
 
 // WithOutput sets the destination writer for logger output.
@@ -49,6 +120,114 @@ func WithTimeNow(now func() time.Time) Option {
 	}
 }
 
+// WithEventIDFunc sets the generator for Event.EventID. Defaults to random
+// UUIDs; mostly useful for testing.
+func WithEventIDFunc(newID func() string) Option {
+	return func(options *options) {
+		if options == nil {
+			return
+		}
+		options.newID = newID
+	}
+}
+
+// WithRedaction adds rules applied to event details by Log and LogChange
+// before the payload size check. Rules are evaluated in order.
+func WithRedaction(rules ...RedactionRule) Option {
+	return func(options *options) {
+		if options == nil {
+			return
+		}
+		options.redaction = append(options.redaction, rules...)
+	}
+}
+
+// WithIgnoredFields excludes paths from LogChange diffs. Patterns are dotted
+// paths where "*" matches any segment; a pattern without dots, such as
+// "updated_at", matches that key at any depth.
+func WithIgnoredFields(patterns ...string) Option {
+	return func(options *options) {
+		if options == nil {
+			return
+		}
+		options.ignoredFields = append(options.ignoredFields, patterns...)
+	}
+}
+
+// WithHashChain makes each event carry the hash of the previous event written
+// by the same logger, so removed or altered records can be detected with
+// VerifyChain. partition, when not nil, splits the stream into independent
+// chains keyed by its result (recorded in Event.ChainID).
+func WithHashChain(partition func(Event) string) Option {
+	return func(options *options) {
+		if options == nil {
+			return
+		}
+		options.chain = true
+		options.partition = partition
+	}
+}
+
+// WithSigner signs the hash of every event. It enables the hash chain.
+func WithSigner(signer Signer) Option {
+	return func(options *options) {
+		if options == nil {
+			return
+		}
+		options.signer = signer
+	}
+}
+
+// WithActionCatalog checks the details of cataloged actions against their
+// spec: required fields must be present and declared fields must have the
+// declared type. Sensitive fields are redacted before any WithRedaction rule
+// runs. Other actions are logged unchecked unless WithStrictCatalog is set.
+func WithActionCatalog(catalog *Catalog) Option {
+	return func(options *options) {
+		if options == nil {
+			return
+		}
+		options.catalog = catalog
+	}
+}
+
+// WithStrictCatalog makes the action catalog reject actions it does not
+// declare (ErrUnknownAction) and detail fields their spec does not declare.
+func WithStrictCatalog() Option {
+	return func(options *options) {
+		if options == nil {
+			return
+		}
+		options.strictCatalog = true
+	}
+}
+
+// WithClaimsActorType sets how the actor type of an event is derived from the
+// claims on its context. Defaults to ClaimsActorType.
+func WithClaimsActorType(actorType func(*auth.Claims) string) Option {
+	return func(options *options) {
+		if options == nil {
+			return
+		}
+		options.claimsActorType = actorType
+	}
+}
+
+// WithActorIDRule replaces the validator tag applied to the IDs of actors of
+// actorType, e.g. WithActorIDRule(ActorUser, "required,uuid4") to accept only
+// random UUIDs for users.
+func WithActorIDRule(actorType, rule string) Option {
+	return func(options *options) {
+		if options == nil {
+			return
+		}
+		if options.actorRules == nil {
+			options.actorRules = make(map[string]string)
+		}
+		options.actorRules[actorType] = rule
+	}
+}
+
 // WithHTTPClient sets the HTTP client used by the http logger.
 func WithHTTPClient(client *http.Client) Option {
 	return func(options *options) {
@@ -58,3 +237,25 @@ func WithHTTPClient(client *http.Client) Option {
 		options.httpClient = client
 	}
 }
+
+// WithTokenSource sends a bearer token from tokens with every http logger and
+// HTTP publisher request.
+func WithTokenSource(tokens TokenSource) Option {
+	return func(options *options) {
+		if options == nil {
+			return
+		}
+		options.tokens = tokens
+	}
+}
+
+// WithJitter sets the source of random values in [0, 1) used to jitter
+// dispatcher retry delays. Defaults to math/rand.
+func WithJitter(jitter func() float64) Option {
+	return func(options *options) {
+		if options == nil {
+			return
+		}
+		options.jitter = jitter
+	}
+}
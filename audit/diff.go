@@ -0,0 +1,158 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidChange is returned by LogChange when before or after cannot be
+// represented as a JSON object.
+var ErrInvalidChange = errors.New("invalid audit change")
+
+type change struct {
+	OldValue any `json:"old_value,omitempty"`
+	NewValue any `json:"new_value,omitempty"`
+}
+
+// differ computes the structural difference between two values as a flat map
+// from dotted path (e.g. "address.city", "tags.1") to change.
+type differ struct {
+	ignored [][]string
+}
+
+func newDiffer(ignored []string) differ {
+	d := differ{ignored: make([][]string, 0, len(ignored))}
+	for _, pattern := range ignored {
+		d.ignored = append(d.ignored, strings.Split(pattern, "."))
+	}
+	return d
+}
+
+// diff normalizes before and after through their JSON form, so structs are
+// compared field by field using their json tags, and returns every changed
+// leaf. A nil side is treated as an empty object.
+func (d differ) diff(before, after any) (map[string]any, error) {
+	b, err := normalizeChangeSide(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := normalizeChangeSide(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]any)
+	d.walk(changes, nil, b, a)
+	return changes, nil
+}
+
+func normalizeChangeSide(v any) (map[string]any, error) {
+	if v == nil {
+		return map[string]any{}, nil
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer && rv.IsNil() {
+		return map[string]any{}, nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidChange, err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	// keep numbers exact so 1 and 1.0000000000000001 are not reported equal
+	dec.UseNumber()
+	var out map[string]any
+	if err := dec.Decode(&out); err != nil {
+		return nil, fmt.Errorf("%w: %T is not an object", ErrInvalidChange, v)
+	}
+	if out == nil {
+		out = map[string]any{}
+	}
+	return out, nil
+}
+
+func (d differ) walk(changes map[string]any, path []string, before, after any) {
+	if d.isIgnored(path) {
+		return
+	}
+
+	switch b := before.(type) {
+	case map[string]any:
+		if a, ok := after.(map[string]any); ok {
+			d.walkMap(changes, path, b, a)
+			return
+		}
+	case []any:
+		if a, ok := after.([]any); ok {
+			d.walkSlice(changes, path, b, a)
+			return
+		}
+	}
+
+	if !reflect.DeepEqual(before, after) {
+		changes[strings.Join(path, ".")] = change{OldValue: before, NewValue: after}
+	}
+}
+
+func (d differ) walkMap(changes map[string]any, path []string, before, after map[string]any) {
+	for key, b := range before {
+		childPath := append(path[:len(path):len(path)], key)
+		a, ok := after[key]
+		if !ok {
+			if !d.isIgnored(childPath) {
+				changes[strings.Join(childPath, ".")] = change{OldValue: b}
+			}
+			continue
+		}
+		d.walk(changes, childPath, b, a)
+	}
+	for key, a := range after {
+		if _, ok := before[key]; ok {
+			continue
+		}
+		childPath := append(path[:len(path):len(path)], key)
+		if !d.isIgnored(childPath) {
+			changes[strings.Join(childPath, ".")] = change{NewValue: a}
+		}
+	}
+}
+
+func (d differ) walkSlice(changes map[string]any, path []string, before, after []any) {
+	for i := 0; i < len(before) || i < len(after); i++ {
+		childPath := append(path[:len(path):len(path)], strconv.Itoa(i))
+		switch {
+		case i >= len(after):
+			if !d.isIgnored(childPath) {
+				changes[strings.Join(childPath, ".")] = change{OldValue: before[i]}
+			}
+		case i >= len(before):
+			if !d.isIgnored(childPath) {
+				changes[strings.Join(childPath, ".")] = change{NewValue: after[i]}
+			}
+		default:
+			d.walk(changes, childPath, before[i], after[i])
+		}
+	}
+}
+
+// isIgnored reports whether path matches an ignored pattern. Patterns are
+// dotted paths where "*" matches any segment; a pattern without dots matches
+// that key at any depth.
+func (d differ) isIgnored(path []string) bool {
+	if len(path) == 0 {
+		return false
+	}
+	for _, pattern := range d.ignored {
+		if len(pattern) == 1 && pattern[0] == path[len(path)-1] {
+			return true
+		}
+		if matchPath(pattern, path) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,141 @@
+package audit_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"github.com/google/uuid"
+	. "github.com/nojyerac/go-lib/audit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type address struct {
+	Street string `json:"street"`
+	City   string `json:"city"`
+}
+
+type account struct {
+	Name      string   `json:"name"`
+	Address   address  `json:"address"`
+	Tags      []string `json:"tags"`
+	UpdatedAt string   `json:"updated_at"`
+	internal  string
+}
+
+var _ = Describe("LogChange diff", func() {
+	var (
+		out     bytes.Buffer
+		opts    []Option
+		logger  AuditLogger
+		actorID = uuid.NewString()
+	)
+
+	BeforeEach(func() {
+		out.Reset()
+		opts = nil
+	})
+
+	JustBeforeEach(func() {
+		cfg := NewConfiguration()
+		cfg.AuditLoggerType = "stdout"
+		var err error
+		logger, err = NewAuditLogger(cfg, append([]Option{WithOutput(&out)}, opts...)...)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	details := func() string {
+		var evt struct {
+			Details json.RawMessage `json:"details"`
+		}
+		Expect(json.Unmarshal(out.Bytes(), &evt)).To(Succeed())
+		return string(evt.Details)
+	}
+
+	It("reports nested map and slice changes as dotted paths", func() {
+		before := map[string]any{
+			"name":    "Ada",
+			"address": map[string]any{"city": "London", "zip": "N1"},
+			"roles":   []any{"admin", "dev"},
+			"meta":    map[string]any{"a": []any{map[string]any{"b": 1}}},
+		}
+		after := map[string]any{
+			"name":    "Ada",
+			"address": map[string]any{"city": "Paris", "zip": "N1"},
+			"roles":   []any{"admin", "ops", "qa"},
+			"meta":    map[string]any{"a": []any{map[string]any{"b": 2}}},
+			"email":   "ada@example.com",
+		}
+
+		Expect(logger.LogChange(context.Background(), actorID, "user.update", before, after)).To(Succeed())
+		Expect(details()).To(MatchJSON(`{
+			"address.city": {"old_value": "London", "new_value": "Paris"},
+			"roles.1": {"old_value": "dev", "new_value": "ops"},
+			"roles.2": {"new_value": "qa"},
+			"meta.a.0.b": {"old_value": 1, "new_value": 2},
+			"email": {"new_value": "ada@example.com"}
+		}`))
+	})
+
+	It("accepts structs using their json tags", func() {
+		before := account{Name: "Ada", Address: address{Street: "1 Main", City: "London"}, internal: "x"}
+		after := &account{Name: "Ada", Address: address{Street: "1 Main", City: "Paris"}, Tags: []string{"vip"}}
+
+		Expect(logger.LogChange(context.Background(), actorID, "user.update", before, after)).To(Succeed())
+		Expect(details()).To(MatchJSON(`{
+			"address.city": {"old_value": "London", "new_value": "Paris"},
+			"tags": {"new_value": ["vip"]}
+		}`))
+	})
+
+	It("treats a nil side as an empty object", func() {
+		Expect(logger.LogChange(context.Background(), actorID, "user.create", nil,
+			account{Name: "Ada"})).To(Succeed())
+		Expect(details()).To(MatchJSON(`{
+			"name": {"new_value": "Ada"},
+			"address": {"new_value": {"street": "", "city": ""}},
+			"tags": {},
+			"updated_at": {"new_value": ""}
+		}`))
+	})
+
+	It("rejects values that are not objects", func() {
+		err := logger.LogChange(context.Background(), actorID, "user.update", []string{"a"}, nil)
+		Expect(err).To(MatchError(ErrInvalidChange))
+	})
+
+	Context("with ignored fields", func() {
+		BeforeEach(func() {
+			opts = []Option{WithIgnoredFields("updated_at", "address.street")}
+		})
+
+		It("omits ignored paths", func() {
+			before := account{Name: "Ada", Address: address{Street: "1 Main"}, UpdatedAt: "2026-01-01"}
+			after := account{Name: "Bob", Address: address{Street: "2 Main"}, UpdatedAt: "2026-01-02"}
+
+			Expect(logger.LogChange(context.Background(), actorID, "user.update", before, after)).To(Succeed())
+			Expect(details()).To(MatchJSON(`{"name": {"old_value": "Ada", "new_value": "Bob"}}`))
+		})
+	})
+
+	Context("with redaction", func() {
+		BeforeEach(func() {
+			opts = []Option{WithRedaction(
+				RedactionRule{Keys: []string{"city"}},
+				RedactionRule{Paths: []string{"profile"}},
+			)}
+		})
+
+		It("redacts flattened paths", func() {
+			before := map[string]any{"address": map[string]any{"city": "London"}, "profile": map[string]any{"ssn": "1"}}
+			after := map[string]any{"address": map[string]any{"city": "Paris"}, "profile": map[string]any{"ssn": "2"}}
+
+			Expect(logger.LogChange(context.Background(), actorID, "user.update", before, after)).To(Succeed())
+			Expect(details()).To(MatchJSON(`{
+				"address.city": {"old_value": "[REDACTED]", "new_value": "[REDACTED]"},
+				"profile.ssn": {"old_value": "[REDACTED]", "new_value": "[REDACTED]"}
+			}`))
+		})
+	})
+})
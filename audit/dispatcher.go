@@ -0,0 +1,242 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/nojyerac/go-lib/db"
+	"github.com/nojyerac/go-lib/log"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// claimOutboxQuery leases due rows by pushing available_at past the end
+	// of the run, so the publishes happen outside any transaction and other
+	// dispatchers skip the rows until the lease expires.
+	claimOutboxQuery = `UPDATE ` + OutboxTable + ` SET available_at = $1 WHERE id IN (` +
+		`SELECT id FROM ` + OutboxTable + ` WHERE available_at <= $2 ORDER BY available_at, id LIMIT $3 ` +
+		`FOR UPDATE SKIP LOCKED) RETURNING id, event_id, payload, attempts`
+	// the statements settling a claimed row only apply while the lease is
+	// still held; a row whose lease expired may have been claimed again
+	deleteOutboxQuery     = `DELETE FROM ` + OutboxTable + ` WHERE id = $1 AND available_at = $2`
+	rescheduleOutboxQuery = `UPDATE ` + OutboxTable +
+		` SET attempts = $3, available_at = $4, last_error = $5 WHERE id = $1 AND available_at = $2`
+	deadLetterOutboxQuery = `INSERT INTO ` + DeadLetterTable +
+		` (event_id, payload, created_at, failed_at, attempts, last_error)` +
+		` SELECT event_id, payload, created_at, $3, $4, $5 FROM ` + OutboxTable +
+		` WHERE id = $1 AND available_at = $2`
+)
+
+// Dispatcher relays events staged by the outbox logger to a Publisher.
+//
+// Each run leases a batch of due rows, publishes them outside any
+// transaction, and then settles them in a short transaction. Leases are
+// claimed with FOR UPDATE SKIP LOCKED, so several dispatchers can share one
+// outbox. Delivered rows are deleted; failed rows are rescheduled with capped
+// exponential backoff and jitter until DispatchMaxAttempts is reached, after
+// which they move to the dead-letter table.
+type Dispatcher struct {
+	database    db.Database
+	publisher   Publisher
+	interval    time.Duration
+	batchSize   int
+	lease       time.Duration
+	maxAttempts int
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+	now         func() time.Time
+	jitter      func() float64
+}
+
+type outboxRow struct {
+	ID       int64  `db:"id"`
+	EventID  string `db:"event_id"`
+	Payload  []byte `db:"payload"`
+	Attempts int    `db:"attempts"`
+}
+
+// singleAttemptPublisher is implemented by publishers that retry on their
+// own. The Dispatcher makes a single attempt per run instead, so that retries
+// happen in one layer: its rescheduling.
+type singleAttemptPublisher interface {
+	publishOnce(ctx context.Context, msg Message) error
+}
+
+// NewDispatcher returns a Dispatcher that reads the outbox through database and
+// delivers events with publisher.
+func NewDispatcher(database db.Database, publisher Publisher, cfg *Configuration, opts ...Option) *Dispatcher {
+	if cfg == nil {
+		cfg = NewConfiguration()
+	}
+	o := newOptions(opts)
+	return &Dispatcher{
+		database:    database,
+		publisher:   publisher,
+		interval:    cfg.DispatchInterval,
+		batchSize:   cfg.DispatchBatchSize,
+		lease:       cfg.DispatchLease,
+		maxAttempts: cfg.DispatchMaxAttempts,
+		baseBackoff: cfg.DispatchBaseBackoff,
+		maxBackoff:  cfg.DispatchMaxBackoff,
+		now:         o.now,
+		jitter:      o.jitter,
+	}
+}
+
+// Start dispatches outbox events every DispatchInterval until ctx is done.
+// A run that fills a whole batch is followed immediately by another so a
+// backlog drains without waiting for the next tick.
+func (d *Dispatcher) Start(ctx context.Context) error {
+	l := log.FromContext(ctx)
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		for {
+			n, err := d.RunOnce(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					l.WithError(err).Warn("audit outbox dispatch failed")
+				}
+				break
+			}
+			if n < d.batchSize {
+				break
+			}
+		}
+		select {
+		case <-ticker.C:
+			continue
+		case <-ctx.Done():
+		}
+		return ctx.Err()
+	}
+}
+
+// dispatchResult is the outcome of publishing one claimed row.
+type dispatchResult struct {
+	row outboxRow
+	err error
+}
+
+// RunOnce leases and processes a single batch of due outbox rows and returns
+// the number of rows claimed. Publishing stops when the lease expires; rows
+// not attempted by then become due again with the lease. Publish failures are
+// recorded on the rows and are not returned as errors.
+func (d *Dispatcher) RunOnce(ctx context.Context) (int, error) {
+	// timestamps are stored with microsecond precision; the lease must
+	// compare equal once read back
+	now := d.now()
+	leaseUntil := now.Add(d.lease).Truncate(time.Microsecond)
+	var rows []outboxRow
+	if err := d.database.Select(ctx, &rows, claimOutboxQuery, leaseUntil, now, d.batchSize); err != nil {
+		return 0, err
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].ID < rows[j].ID })
+
+	pubCtx, cancel := context.WithTimeout(ctx, d.lease)
+	results := make([]dispatchResult, 0, len(rows))
+	for _, row := range rows {
+		if pubCtx.Err() != nil {
+			break
+		}
+		results = append(results, dispatchResult{row: row, err: d.publish(pubCtx, row)})
+	}
+	cancel()
+
+	if err := d.settle(ctx, leaseUntil, results); err != nil {
+		return 0, err
+	}
+	return len(rows), nil
+}
+
+func (d *Dispatcher) publish(ctx context.Context, row outboxRow) error {
+	msg := Message{EventID: row.EventID, Payload: row.Payload}
+	if p, ok := d.publisher.(singleAttemptPublisher); ok {
+		return p.publishOnce(ctx, msg)
+	}
+	return d.publisher.Publish(ctx, msg)
+}
+
+// settle deletes, reschedules or dead-letters the published rows in one
+// transaction.
+func (d *Dispatcher) settle(ctx context.Context, leaseUntil time.Time, results []dispatchResult) (err error) {
+	tx, err := d.database.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			err = errors.Join(err, tx.Rollback(ctx))
+		}
+	}()
+	for _, res := range results {
+		if err = d.settleRow(ctx, tx, leaseUntil, res); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+func (d *Dispatcher) settleRow(ctx context.Context, tx db.Tx, leaseUntil time.Time, res dispatchResult) error {
+	m := outboxMetrics()
+	row := res.row
+	if res.err == nil {
+		if _, err := tx.Exec(ctx, deleteOutboxQuery, row.ID, leaseUntil); err != nil {
+			return err
+		}
+		m.published.Add(ctx, 1)
+		return nil
+	}
+
+	m.failed.Add(ctx, 1)
+	attempts := row.Attempts + 1
+	l := log.FromContext(ctx).WithFields(logrus.Fields{
+		"event_id": row.EventID,
+		"attempts": attempts,
+	}).WithError(res.err)
+
+	if attempts >= d.maxAttempts {
+		if _, err := tx.Exec(ctx, deadLetterOutboxQuery,
+			row.ID, leaseUntil, d.now(), attempts, res.err.Error()); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, deleteOutboxQuery, row.ID, leaseUntil); err != nil {
+			return err
+		}
+		m.dlq.Add(ctx, 1)
+		l.Error("audit event moved to dead-letter table")
+		return nil
+	}
+
+	availableAt := d.now().Add(d.backoff(attempts))
+	if _, err := tx.Exec(ctx, rescheduleOutboxQuery,
+		row.ID, leaseUntil, attempts, availableAt, res.err.Error()); err != nil {
+		return err
+	}
+	m.retried.Add(ctx, 1)
+	l.Warn("audit event publish failed; rescheduled")
+	return nil
+}
+
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	return backoffDelay(d.baseBackoff, d.maxBackoff, attempts, d.jitter)
+}
+
+// backoffDelay returns the delay before the given attempt (counting from 1):
+// base * 2^(attempts-1), capped at maxDelay, with the upper half jittered so
+// the delay falls in [d/2, d).
+func backoffDelay(base, maxDelay time.Duration, attempts int, jitter func() float64) time.Duration {
+	delay := maxDelay
+	if shift := attempts - 1; shift >= 0 && shift < 32 {
+		if exp := base << shift; exp > 0 && exp < maxDelay {
+			delay = exp
+		}
+	}
+	half := delay / 2
+	return half + time.Duration(jitter()*float64(delay-half))
+}
@@ -0,0 +1,217 @@
+package audit_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	. "github.com/nojyerac/go-lib/audit"
+	"github.com/nojyerac/go-lib/db"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type publisherFunc func(context.Context, Message) error
+
+func (f publisherFunc) Publish(ctx context.Context, msg Message) error {
+	return f(ctx, msg)
+}
+
+var _ = Describe("Dispatcher", func() {
+	var (
+		ctx       context.Context
+		database  db.Database
+		sqlMock   sqlmock.Sqlmock
+		cfg       *Configuration
+		publisher Publisher
+		eventID   string
+	)
+
+	outboxColumns := []string{"id", "event_id", "payload", "attempts"}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		database, sqlMock = openMockDatabase(ctx)
+		cfg = NewConfiguration()
+		cfg.DispatchBatchSize = 10
+		cfg.DispatchMaxAttempts = 3
+		cfg.DispatchBaseBackoff = time.Second
+		cfg.DispatchMaxBackoff = 3 * time.Second
+		eventID = uuid.NewString()
+	})
+
+	newDispatcher := func() *Dispatcher {
+		return NewDispatcher(database, publisher, cfg, WithTimeNow(timeNow), WithJitter(func() float64 { return 0.5 }))
+	}
+
+	lease := func() time.Time { return timeNow().Add(time.Minute).Truncate(time.Microsecond) }
+
+	expectClaim := func(rows *sqlmock.Rows) {
+		sqlMock.ExpectQuery(`UPDATE audit_outbox SET available_at = \$1 WHERE id IN \(`+
+			`SELECT id FROM audit_outbox WHERE available_at <= \$2 ORDER BY available_at, id LIMIT \$3 `+
+			`FOR UPDATE SKIP LOCKED\) RETURNING id, event_id, payload, attempts`).
+			WithArgs(lease(), timeNow(), 10).
+			WillReturnRows(rows)
+	}
+
+	It("publishes claimed rows to an http sink and deletes them", func() {
+		var (
+			mu       sync.Mutex
+			received []string
+		)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := io.ReadAll(r.Body)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.URL.Path).To(Equal("/api/auditlog"))
+			mu.Lock()
+			received = append(received, string(body))
+			mu.Unlock()
+			w.WriteHeader(http.StatusAccepted)
+		}))
+		defer server.Close()
+
+		cfg.AuditLoggerURL = server.URL
+		var err error
+		publisher, err = NewHTTPPublisher(cfg)
+		Expect(err).NotTo(HaveOccurred())
+
+		expectClaim(sqlmock.NewRows(outboxColumns).AddRow(7, eventID, []byte(`{"action":"user.update"}`), 0))
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectExec(`DELETE FROM audit_outbox WHERE id = \$1 AND available_at = \$2`).
+			WithArgs(7, lease()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		sqlMock.ExpectCommit()
+
+		n, err := newDispatcher().RunOnce(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(1))
+		Expect(received).To(Equal([]string{`{"action":"user.update"}`}))
+	})
+
+	It("reschedules failed rows with capped exponential backoff", func() {
+		publisher = publisherFunc(func(context.Context, Message) error { return errors.New("sink down") })
+
+		expectClaim(sqlmock.NewRows(outboxColumns).
+			AddRow(1, eventID, []byte(`{}`), 0).
+			AddRow(2, uuid.NewString(), []byte(`{}`), 1))
+		sqlMock.ExpectBegin()
+		// first retry: base 1s, jittered into [0.5s, 1s)
+		sqlMock.ExpectExec(`UPDATE audit_outbox SET attempts = \$3, available_at = \$4, last_error = \$5 `+
+			`WHERE id = \$1 AND available_at = \$2`).
+			WithArgs(1, lease(), 1, timeNow().Add(750*time.Millisecond), "sink down").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		// second retry: 2s, jittered into [1s, 2s)
+		sqlMock.ExpectExec(`UPDATE audit_outbox SET`).
+			WithArgs(2, lease(), 2, timeNow().Add(1500*time.Millisecond), "sink down").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		sqlMock.ExpectCommit()
+
+		n, err := newDispatcher().RunOnce(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(2))
+	})
+
+	It("moves rows that exhaust their attempts to the dead-letter table", func() {
+		publisher = publisherFunc(func(context.Context, Message) error { return errors.New("rejected") })
+
+		expectClaim(sqlmock.NewRows(outboxColumns).AddRow(3, eventID, []byte(`{}`), 2))
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectExec(`INSERT INTO audit_outbox_dlq \(event_id, payload, created_at, failed_at, attempts, last_error\) `+
+			`SELECT event_id, payload, created_at, \$3, \$4, \$5 FROM audit_outbox WHERE id = \$1 AND available_at = \$2`).
+			WithArgs(3, lease(), timeNow(), 3, "rejected").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		sqlMock.ExpectExec(`DELETE FROM audit_outbox WHERE id = \$1`).
+			WithArgs(3, lease()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		sqlMock.ExpectCommit()
+
+		_, err := newDispatcher().RunOnce(ctx)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("rolls back when the outbox cannot be updated", func() {
+		publisher = publisherFunc(func(context.Context, Message) error { return nil })
+
+		expectClaim(sqlmock.NewRows(outboxColumns).AddRow(4, eventID, []byte(`{}`), 0))
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectExec(`DELETE FROM audit_outbox`).WillReturnError(errors.New("db gone"))
+		sqlMock.ExpectRollback()
+
+		_, err := newDispatcher().RunOnce(ctx)
+		Expect(err).To(MatchError(ContainSubstring("db gone")))
+	})
+
+	It("makes a single attempt per run with an http publisher", func() {
+		var calls int
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+
+		cfg.AuditLoggerURL = server.URL
+		cfg.HTTPMaxRetries = 3
+		var err error
+		publisher, err = NewHTTPPublisher(cfg)
+		Expect(err).NotTo(HaveOccurred())
+
+		expectClaim(sqlmock.NewRows(outboxColumns).AddRow(5, eventID, []byte(`{}`), 0))
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectExec(`UPDATE audit_outbox SET`).
+			WithArgs(5, lease(), 1, timeNow().Add(750*time.Millisecond), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		sqlMock.ExpectCommit()
+
+		_, err = newDispatcher().RunOnce(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(calls).To(Equal(1))
+	})
+
+	It("leaves rows it did not publish before the lease ends", func() {
+		cfg.DispatchLease = 10 * time.Millisecond
+		published := 0
+		publisher = publisherFunc(func(ctx context.Context, _ Message) error {
+			published++
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		leaseUntil := timeNow().Add(cfg.DispatchLease).Truncate(time.Microsecond)
+
+		sqlMock.ExpectQuery(`UPDATE audit_outbox SET available_at`).
+			WithArgs(leaseUntil, timeNow(), 10).
+			WillReturnRows(sqlmock.NewRows(outboxColumns).
+				AddRow(1, eventID, []byte(`{}`), 0).
+				AddRow(2, uuid.NewString(), []byte(`{}`), 0))
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectExec(`UPDATE audit_outbox SET`).
+			WithArgs(1, leaseUntil, 1, sqlmock.AnyArg(), context.DeadlineExceeded.Error()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		sqlMock.ExpectCommit()
+
+		n, err := newDispatcher().RunOnce(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(2))
+		Expect(published).To(Equal(1))
+		Expect(sqlMock.ExpectationsWereMet()).To(Succeed())
+	})
+
+	It("runs until the context is cancelled", func() {
+		publisher = publisherFunc(func(context.Context, Message) error { return nil })
+		cfg.DispatchInterval = time.Hour
+
+		expectClaim(sqlmock.NewRows(outboxColumns))
+
+		runCtx, cancel := context.WithCancel(ctx)
+		done := make(chan error)
+		go func() { done <- newDispatcher().Start(runCtx) }()
+		Eventually(sqlMock.ExpectationsWereMet).Should(Succeed())
+		cancel()
+		Eventually(done).Should(Receive(MatchError(context.Canceled)))
+	})
+})
@@ -1,78 +1,146 @@
 package audit
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/nojyerac/go-lib/version"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
-	ErrInvalidEventActorID   = errors.New("invalid audit event actor ID")
+	ErrInvalidEventActor = errors.New("invalid audit event actor")
+	// ErrInvalidEventActorID also matches ErrInvalidEventActor.
+	ErrInvalidEventActorID   = fmt.Errorf("%w ID", ErrInvalidEventActor)
 	ErrInvalidEventAction    = errors.New("invalid audit event action")
 	ErrInvalidEventTimestamp = errors.New("invalid audit event timestamp")
 	ErrInvalidEventDetails   = errors.New("invalid audit event details")
 	ErrPayloadTooLarge       = errors.New("audit payload too large")
+	ErrUnknownAction         = errors.New("unknown audit action")
 )
 
-type change struct {
-	OldValue any `json:"old_value,omitempty"`
-	NewValue any `json:"new_value,omitempty"`
+// SchemaVersion is the version of the Event envelope written by this package.
+//
+// Compatibility contract: within a major version (the number before the dot)
+// fields are only ever added, and the minor version is bumped when they are.
+// Existing fields are never removed, renamed, or given a different type or
+// meaning. Consumers should ignore fields they do not recognize and can rely
+// on every field present in the minor version they were written against. Any
+// breaking change bumps the major version.
+//
+// 1.1 added chainID, prevHash, hash, and signature.
+// 2.0 added actor. actorID, a required UUID in 1.x, now repeats actor.id: it
+// is empty for anonymous actors and may be an email address or a service or
+// system ID.
+const SchemaVersion = "2.0"
+
+// Recommended values for Event.Outcome.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+	OutcomeDenied  = "denied"
+)
+
+// Event is the versioned envelope every logger writes. See SchemaVersion for
+// the compatibility contract.
+type Event struct {
+	EventID       string         `json:"eventID" validate:"required,uuid"`
+	SchemaVersion string         `json:"schemaVersion" validate:"required"`
+	ActorID       string         `json:"actorID"`
+	Actor         *Actor         `json:"actor,omitempty" validate:"required"`
+	Timestamp     time.Time      `json:"timestamp" validate:"required"`
+	Action        string         `json:"action" validate:"required"`
+	ResourceType  string         `json:"resourceType,omitempty"`
+	ResourceID    string         `json:"resourceID,omitempty"`
+	Outcome       string         `json:"outcome,omitempty"`
+	Source        Source         `json:"source"`
+	RequestID     string         `json:"requestID,omitempty"`
+	TraceID       string         `json:"traceID,omitempty"`
+	SpanID        string         `json:"spanID,omitempty"`
+	Details       map[string]any `json:"details" validate:"required"`
+	ChainID       string         `json:"chainID,omitempty"`
+	PrevHash      string         `json:"prevHash,omitempty"`
+	Hash          string         `json:"hash,omitempty"`
+	Signature     string         `json:"signature,omitempty"`
 }
 
-func processDetails(before, after map[string]any) map[string]any {
-	changes := make(map[string]any)
+// Source identifies the service that emitted an Event.
+type Source struct {
+	Service string `json:"service,omitempty"`
+	Version string `json:"version,omitempty"`
+	GitSHA  string `json:"gitSHA,omitempty"`
+}
 
-	keys := make(map[string]struct{})
-	for key := range before {
-		keys[key] = struct{}{}
-	}
-	for key := range after {
-		keys[key] = struct{}{}
-	}
+type (
+	ctxResourceKeyType  struct{}
+	ctxRequestIDKeyType struct{}
+	ctxOutcomeKeyType   struct{}
+)
 
-	for key := range keys {
-		beforeValue, beforeExists := before[key]
-		afterValue, afterExists := after[key]
+var (
+	ctxResourceKey  = ctxResourceKeyType{}
+	ctxRequestIDKey = ctxRequestIDKeyType{}
+	ctxOutcomeKey   = ctxOutcomeKeyType{}
+)
 
-		if !beforeExists {
-			changes[key] = change{
-				NewValue: afterValue,
-			}
-			continue
-		}
+type resource struct {
+	typ, id string
+}
 
-		if !afterExists {
-			changes[key] = change{
-				OldValue: beforeValue,
-			}
-			continue
-		}
+// WithResource records the type and ID of the resource events logged with ctx
+// refer to.
+func WithResource(ctx context.Context, resourceType, resourceID string) context.Context {
+	return context.WithValue(ctx, ctxResourceKey, resource{typ: resourceType, id: resourceID})
+}
 
-		if beforeValue != afterValue {
-			changes[key] = change{
-				OldValue: beforeValue,
-				NewValue: afterValue,
-			}
-		}
-	}
+// WithRequestID records the request ID events logged with ctx belong to.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, ctxRequestIDKey, requestID)
+}
 
-	return changes
+// WithOutcome records the outcome of the operation events logged with ctx
+// describe, e.g. OutcomeSuccess.
+func WithOutcome(ctx context.Context, outcome string) context.Context {
+	return context.WithValue(ctx, ctxOutcomeKey, outcome)
 }
 
-type event struct {
-	ActorID   string         `json:"actorID" validate:"required,uuid4"`
-	Timestamp time.Time      `json:"timestamp" validate:"required"`
-	Action    string         `json:"action" validate:"required"`
-	Details   map[string]any `json:"details" validate:"required"`
+// populate fills the envelope fields carried by ctx: resource, request ID,
+// outcome, and trace and span IDs.
+func (e *Event) populate(ctx context.Context) {
+	if ctx == nil {
+		return
+	}
+	if r, ok := ctx.Value(ctxResourceKey).(resource); ok {
+		e.ResourceType, e.ResourceID = r.typ, r.id
+	}
+	if id, ok := ctx.Value(ctxRequestIDKey).(string); ok {
+		e.RequestID = id
+	}
+	if outcome, ok := ctx.Value(ctxOutcomeKey).(string); ok {
+		e.Outcome = outcome
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		e.TraceID = sc.TraceID().String()
+		e.SpanID = sc.SpanID().String()
+	}
+}
+
+func currentSource() Source {
+	v := version.GetVersion()
+	return Source{Service: v.Name, Version: v.SemVer, GitSHA: v.GitSHA}
 }
 
 func validationErr(err error) error {
 	if validationErrors, ok := err.(validator.ValidationErrors); ok {
 		for _, fieldErr := range validationErrors {
+			if strings.HasPrefix(fieldErr.StructNamespace(), "Event.Actor") {
+				return ErrInvalidEventActor
+			}
 			switch fieldErr.StructField() {
-			case "ActorID":
-				return ErrInvalidEventActorID
 			case "Action":
 				return ErrInvalidEventAction
 			case "Timestamp":
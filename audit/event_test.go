@@ -0,0 +1,85 @@
+package audit_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"github.com/google/uuid"
+	. "github.com/nojyerac/go-lib/audit"
+	"github.com/nojyerac/go-lib/auth"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var _ = Describe("Event", func() {
+	var (
+		out    bytes.Buffer
+		logger AuditLogger
+	)
+
+	BeforeEach(func() {
+		out.Reset()
+		cfg := NewConfiguration()
+		cfg.AuditLoggerType = "stdout"
+		var err error
+		logger, err = NewAuditLogger(cfg, WithOutput(&out), WithTimeNow(timeNow))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	decode := func() Event {
+		var evt Event
+		Expect(json.Unmarshal(out.Bytes(), &evt)).To(Succeed())
+		return evt
+	}
+
+	It("assigns a unique event ID and the schema version", func() {
+		actorID := uuid.NewString()
+		Expect(logger.Log(context.Background(), actorID, "user.login", map[string]any{})).To(Succeed())
+		first := decode()
+		out.Reset()
+		Expect(logger.Log(context.Background(), actorID, "user.login", map[string]any{})).To(Succeed())
+		second := decode()
+
+		Expect(uuid.Validate(first.EventID)).To(Succeed())
+		Expect(first.EventID).NotTo(Equal(second.EventID))
+		Expect(first.SchemaVersion).To(Equal(SchemaVersion))
+	})
+
+	It("populates the envelope from the context", func() {
+		subject := uuid.NewString()
+		traceID := trace.TraceID{
+			0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08,
+			0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10,
+		}
+		spanID := trace.SpanID{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}
+		ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID: traceID,
+			SpanID:  spanID,
+		}))
+		ctx = auth.WithClaims(ctx, &auth.Claims{Subject: subject})
+		ctx = WithResource(ctx, "user", "u-1")
+		ctx = WithRequestID(ctx, "req-42")
+		ctx = WithOutcome(ctx, OutcomeSuccess)
+
+		Expect(logger.Log(ctx, "", "user.update", map[string]any{"field": "email"})).To(Succeed())
+
+		evt := decode()
+		Expect(evt.ActorID).To(Equal(subject))
+		Expect(evt.ResourceType).To(Equal("user"))
+		Expect(evt.ResourceID).To(Equal("u-1"))
+		Expect(evt.RequestID).To(Equal("req-42"))
+		Expect(evt.Outcome).To(Equal(OutcomeSuccess))
+		Expect(evt.TraceID).To(Equal(traceID.String()))
+		Expect(evt.SpanID).To(Equal(spanID.String()))
+	})
+
+	It("prefers an explicit actor over the authenticated subject", func() {
+		actorID := uuid.NewString()
+		ctx := auth.WithClaims(context.Background(), &auth.Claims{Subject: uuid.NewString()})
+
+		Expect(logger.Log(ctx, actorID, "user.update", map[string]any{})).To(Succeed())
+		Expect(decode().ActorID).To(Equal(actorID))
+	})
+})
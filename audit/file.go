@@ -0,0 +1,377 @@
+package audit
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nojyerac/go-lib/log"
+)
+
+const (
+	syncAlways   = "always"
+	syncInterval = "interval"
+
+	rotatedTimeFormat = "20060102T150405.000000000"
+)
+
+// fileAuditLogger appends compact JSON Lines to a local file, rotating it by
+// size and age. Rotated files are named <path>.<UTC timestamp>, optionally
+// gzipped, and pruned to the newest FileMaxBackups.
+type fileAuditLogger struct {
+	eventBuilder
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+	compress   bool
+	syncPolicy string
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	dirty    bool
+	closed   bool
+
+	// maintenance compresses and prunes rotated files off the write path.
+	maintenance sync.WaitGroup
+	maintMu     sync.Mutex
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newFileAuditLogger(cfg *Configuration, builder eventBuilder) (*fileAuditLogger, error) {
+	if strings.TrimSpace(cfg.FilePath) == "" {
+		return nil, fmt.Errorf("audit file path is required for file logger")
+	}
+	f := &fileAuditLogger{
+		eventBuilder: builder,
+		path:         cfg.FilePath,
+		maxSize:      cfg.FileMaxSizeBytes,
+		maxAge:       cfg.FileMaxAge,
+		maxBackups:   cfg.FileMaxBackups,
+		compress:     cfg.FileCompress,
+		syncPolicy:   cfg.FileSyncPolicy,
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	if f.chain != nil {
+		f.seedChain()
+	}
+	if f.syncPolicy == syncInterval {
+		go f.syncLoop(cfg.FileSyncInterval)
+	} else {
+		close(f.done)
+	}
+	return f, nil
+}
+
+func (f *fileAuditLogger) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.path), 0o750); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	f.file, f.size, f.openedAt = file, info.Size(), f.now()
+	if info.Size() > 0 {
+		f.openedAt = startedAt(f.path, info.ModTime())
+	}
+	return nil
+}
+
+// seedChain continues the hash chains from the records already written, so a
+// restarted logger does not start them again. The newest rotated file is read
+// too, for chains with no records since the last rotation.
+func (f *fileAuditLogger) seedChain() {
+	paths := []string{f.path}
+	if matches, err := filepath.Glob(f.path + ".*"); err == nil {
+		var rotated []string
+		for _, name := range matches {
+			if isRotatedFile(f.path, name) {
+				rotated = append(rotated, name)
+			}
+		}
+		sort.Strings(rotated)
+		if len(rotated) > 0 {
+			paths = []string{rotated[len(rotated)-1], f.path}
+		}
+	}
+	for _, path := range paths {
+		if err := f.seedChainFrom(path); err != nil {
+			log.FromContext(context.Background()).WithError(err).WithField("file", path).
+				Warn("failed to read the hash chain from the audit file")
+		}
+	}
+}
+
+func (f *fileAuditLogger) seedChainFrom(path string) error {
+	in, err := OpenFile(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	dec := json.NewDecoder(in)
+	for {
+		var record struct {
+			ChainID string `json:"chainID"`
+			Hash    string `json:"hash"`
+		}
+		if err := dec.Decode(&record); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if record.Hash != "" {
+			f.chain.seed(record.ChainID, record.Hash)
+		}
+	}
+}
+
+// startedAt returns when an existing file was started, so age rotation
+// survives a restart: the timestamp of its first event, or its modification
+// time when that cannot be read.
+func startedAt(path string, modTime time.Time) time.Time {
+	in, err := os.Open(path) //nolint:gosec // path is the configured audit file
+	if err != nil {
+		return modTime
+	}
+	defer in.Close()
+	var first struct {
+		Timestamp time.Time `json:"timestamp"`
+	}
+	if err := json.NewDecoder(in).Decode(&first); err != nil || first.Timestamp.IsZero() {
+		return modTime
+	}
+	return first.Timestamp
+}
+
+func (f *fileAuditLogger) LogChange(ctx context.Context, actorID, action string, before, after any) error {
+	details, err := f.diff(before, after)
+	if err != nil {
+		return err
+	}
+	return f.record(ctx, f, actorID, action, details, true)
+}
+
+func (f *fileAuditLogger) Log(ctx context.Context, actorID, action string, details map[string]any) error {
+	return f.record(ctx, f, actorID, action, details, false)
+}
+
+func (f *fileAuditLogger) writeEvent(_ context.Context, evt Event) error {
+	payload, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+	return f.write(append(payload, '\n'))
+}
+
+func (f *fileAuditLogger) write(line []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return ErrLoggerClosed
+	}
+
+	if f.shouldRotate(int64(len(line))) {
+		if err := f.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := f.file.Write(line)
+	f.size += int64(n)
+	if err != nil {
+		return err
+	}
+	if f.syncPolicy == syncAlways {
+		return f.file.Sync()
+	}
+	f.dirty = true
+	return nil
+}
+
+func (f *fileAuditLogger) shouldRotate(next int64) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.maxSize > 0 && f.size+next > f.maxSize {
+		return true
+	}
+	return f.maxAge > 0 && f.now().Sub(f.openedAt) >= f.maxAge
+}
+
+func (f *fileAuditLogger) rotate() error {
+	if err := f.file.Sync(); err != nil {
+		return err
+	}
+
+	// rename before reopening, so a failure leaves the current file in use
+	rotated := f.path + "." + f.now().UTC().Format(rotatedTimeFormat)
+	if err := os.Rename(f.path, rotated); err != nil {
+		return err
+	}
+	previous := f.file
+	if err := f.open(); err != nil {
+		return errors.Join(err, os.Rename(rotated, f.path))
+	}
+	f.dirty = false
+	if err := previous.Close(); err != nil {
+		log.FromContext(context.Background()).WithError(err).WithField("file", rotated).
+			Warn("failed to close rotated audit file")
+	}
+
+	f.maintenance.Add(1)
+	go func() {
+		defer f.maintenance.Done()
+		f.maintMu.Lock()
+		defer f.maintMu.Unlock()
+
+		l := log.FromContext(context.Background()).WithField("file", rotated)
+		if f.compress {
+			if err := gzipFile(rotated); err != nil {
+				l.WithError(err).Warn("failed to compress rotated audit file")
+			}
+		}
+		if err := f.prune(); err != nil {
+			l.WithError(err).Warn("failed to prune rotated audit files")
+		}
+	}()
+	return nil
+}
+
+// prune removes the oldest rotated files beyond maxBackups. Only names made
+// of the path and a rotation timestamp, optionally gzipped, are considered.
+func (f *fileAuditLogger) prune() error {
+	if f.maxBackups <= 0 {
+		return nil
+	}
+	matches, err := filepath.Glob(f.path + ".*")
+	if err != nil {
+		return err
+	}
+	rotated := matches[:0]
+	for _, name := range matches {
+		if isRotatedFile(f.path, name) {
+			rotated = append(rotated, name)
+		}
+	}
+	// the timestamp suffix sorts chronologically
+	sort.Strings(rotated)
+	var errs []error
+	for len(rotated) > f.maxBackups {
+		if err := os.Remove(rotated[0]); err != nil {
+			errs = append(errs, err)
+		}
+		rotated = rotated[1:]
+	}
+	return errors.Join(errs...)
+}
+
+func isRotatedFile(path, name string) bool {
+	suffix := strings.TrimSuffix(strings.TrimPrefix(name, path+"."), ".gz")
+	_, err := time.Parse(rotatedTimeFormat, suffix)
+	return err == nil
+}
+
+func gzipFile(path string) (err error) {
+	in, err := os.Open(path) //nolint:gosec // path is derived from the configured audit file
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = out.Close()
+			_ = os.Remove(path + ".gz")
+		}
+	}()
+
+	zw := gzip.NewWriter(out)
+	if _, err = io.Copy(zw, in); err != nil {
+		return err
+	}
+	if err = zw.Close(); err != nil {
+		return err
+	}
+	if err = out.Sync(); err != nil {
+		return err
+	}
+	if err = out.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+func (f *fileAuditLogger) syncLoop(interval time.Duration) {
+	defer close(f.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			f.mu.Lock()
+			if f.dirty && !f.closed {
+				if err := f.file.Sync(); err != nil {
+					log.FromContext(context.Background()).WithError(err).Warn("failed to sync audit file")
+				}
+				f.dirty = false
+			}
+			f.mu.Unlock()
+		case <-f.stop:
+			return
+		}
+	}
+}
+
+// Close syncs and closes the file and waits for pending compression.
+func (f *fileAuditLogger) Close(ctx context.Context) error {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return nil
+	}
+	f.closed = true
+	close(f.stop)
+	err := errors.Join(f.file.Sync(), f.file.Close())
+	f.mu.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		<-f.done
+		f.maintenance.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return err
+	case <-ctx.Done():
+		return errors.Join(err, ctx.Err())
+	}
+}
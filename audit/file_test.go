@@ -0,0 +1,303 @@
+package audit_test
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	. "github.com/nojyerac/go-lib/audit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("File Logger", func() {
+	var (
+		ctx     context.Context
+		dir     string
+		path    string
+		cfg     *Configuration
+		now     time.Time
+		logger  AuditLogger
+		actorID = uuid.NewString()
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		dir = GinkgoT().TempDir()
+		path = filepath.Join(dir, "logs", "audit.jsonl")
+		now = timeNow()
+		cfg = NewConfiguration()
+		cfg.AuditLoggerType = "file"
+		cfg.FilePath = path
+		cfg.FileSyncPolicy = "always"
+	})
+
+	JustBeforeEach(func() {
+		var err error
+		logger, err = NewAuditLogger(cfg, WithTimeNow(func() time.Time { return now }))
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(Close, ctx, logger)
+	})
+
+	readLines := func(name string) []string {
+		f, err := os.Open(name)
+		Expect(err).NotTo(HaveOccurred())
+		defer f.Close()
+		var lines []string
+		scanner := bufio.NewScanner(f)
+		if strings.HasSuffix(name, ".gz") {
+			zr, err := gzip.NewReader(f)
+			Expect(err).NotTo(HaveOccurred())
+			scanner = bufio.NewScanner(zr)
+		}
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		return lines
+	}
+
+	rotated := func() []string {
+		files, err := filepath.Glob(path + ".*")
+		Expect(err).NotTo(HaveOccurred())
+		sort.Strings(files)
+		return files
+	}
+
+	It("writes one compact JSON object per line", func() {
+		Expect(logger.Log(ctx, actorID, "user.login", map[string]any{"ip": "10.0.0.1"})).To(Succeed())
+		Expect(logger.LogChange(ctx, actorID, "user.update",
+			map[string]any{"name": "a"}, map[string]any{"name": "b"})).To(Succeed())
+
+		lines := readLines(path)
+		Expect(lines).To(HaveLen(2))
+		var evt Event
+		Expect(json.Unmarshal([]byte(lines[0]), &evt)).To(Succeed())
+		Expect(evt.Action).To(Equal("user.login"))
+		Expect(lines[1]).To(ContainSubstring(`"name":{"old_value":"a","new_value":"b"}`))
+	})
+
+	It("appends to an existing file", func() {
+		Expect(logger.Log(ctx, actorID, "user.login", map[string]any{})).To(Succeed())
+		Expect(Close(ctx, logger)).To(Succeed())
+
+		reopened, err := NewAuditLogger(cfg, WithTimeNow(func() time.Time { return now }))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reopened.Log(ctx, actorID, "user.logout", map[string]any{})).To(Succeed())
+		Expect(Close(ctx, reopened)).To(Succeed())
+
+		Expect(readLines(path)).To(HaveLen(2))
+	})
+
+	It("rejects events after Close", func() {
+		Expect(Close(ctx, logger)).To(Succeed())
+		Expect(logger.Log(ctx, actorID, "user.login", map[string]any{})).To(MatchError(ErrLoggerClosed))
+	})
+
+	Context("with size rotation", func() {
+		BeforeEach(func() {
+			cfg.FileMaxSizeBytes = 400
+			cfg.FileMaxBackups = 2
+			cfg.FileCompress = true
+		})
+
+		It("rotates, compresses and prunes old files", func() {
+			for i := range 8 {
+				now = now.Add(time.Second)
+				Expect(logger.Log(ctx, actorID, "user.update", map[string]any{"seq": i})).To(Succeed())
+			}
+			Expect(Close(ctx, logger)).To(Succeed())
+
+			files := rotated()
+			Expect(files).To(HaveLen(2))
+			for _, f := range files {
+				Expect(f).To(HaveSuffix(".gz"))
+				Expect(readLines(f)).NotTo(BeEmpty())
+			}
+
+			info, err := os.Stat(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Size()).To(BeNumerically("<=", 400))
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0o600)))
+
+			// the newest rotated file holds the events just before the live file
+			last := readLines(files[1])
+			var evt Event
+			Expect(json.Unmarshal([]byte(last[len(last)-1]), &evt)).To(Succeed())
+			live := readLines(path)
+			var first Event
+			Expect(json.Unmarshal([]byte(live[0]), &first)).To(Succeed())
+			Expect(first.Details["seq"]).To(Equal(evt.Details["seq"].(float64) + 1))
+		})
+
+		It("prunes only rotated files", func() {
+			other := path + ".lock"
+			Expect(os.WriteFile(other, nil, 0o600)).To(Succeed())
+			for i := range 8 {
+				now = now.Add(time.Second)
+				Expect(logger.Log(ctx, actorID, "user.update", map[string]any{"seq": i})).To(Succeed())
+			}
+			Expect(Close(ctx, logger)).To(Succeed())
+
+			Expect(other).To(BeAnExistingFile())
+			Expect(rotated()).To(HaveLen(3))
+		})
+
+		It("keeps writing to the current file when the rename fails", func() {
+			now = now.Add(time.Second)
+			Expect(logger.Log(ctx, actorID, "user.update", map[string]any{"seq": 0})).To(Succeed())
+			// a non-empty directory in the way of the rotated name
+			blocker := path + "." + now.UTC().Format("20060102T150405.000000000")
+			Expect(os.MkdirAll(filepath.Join(blocker, "x"), 0o750)).To(Succeed())
+			Expect(logger.Log(ctx, actorID, "user.update", map[string]any{"seq": 1})).NotTo(Succeed())
+
+			Expect(os.RemoveAll(blocker)).To(Succeed())
+			Expect(logger.Log(ctx, actorID, "user.update", map[string]any{"seq": 1})).To(Succeed())
+			Expect(Close(ctx, logger)).To(Succeed())
+			Expect(readLines(path)).To(HaveLen(1))
+			Expect(rotated()).To(HaveLen(1))
+		})
+	})
+
+	Context("with age rotation", func() {
+		BeforeEach(func() {
+			cfg.FileMaxAge = time.Hour
+			cfg.FileCompress = false
+		})
+
+		It("starts a new file once the current one is too old", func() {
+			Expect(logger.Log(ctx, actorID, "user.login", map[string]any{})).To(Succeed())
+			now = now.Add(30 * time.Minute)
+			Expect(logger.Log(ctx, actorID, "user.login", map[string]any{})).To(Succeed())
+			Expect(rotated()).To(BeEmpty())
+
+			now = now.Add(30 * time.Minute)
+			Expect(logger.Log(ctx, actorID, "user.logout", map[string]any{})).To(Succeed())
+			Expect(Close(ctx, logger)).To(Succeed())
+
+			files := rotated()
+			rotatedAt := timeNow().Add(time.Hour).UTC().Format("20060102T150405.000000000")
+			Expect(files).To(Equal([]string{path + "." + rotatedAt}))
+			Expect(readLines(files[0])).To(HaveLen(2))
+			Expect(readLines(path)).To(HaveLen(1))
+		})
+
+		It("measures the age of an existing file from its first event", func() {
+			Expect(logger.Log(ctx, actorID, "user.login", map[string]any{})).To(Succeed())
+			Expect(Close(ctx, logger)).To(Succeed())
+
+			// a restart 45 minutes later must not reset the age
+			now = now.Add(45 * time.Minute)
+			restarted, err := NewAuditLogger(cfg, WithTimeNow(func() time.Time { return now }))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(restarted.Log(ctx, actorID, "user.login", map[string]any{})).To(Succeed())
+			Expect(rotated()).To(BeEmpty())
+
+			now = now.Add(15 * time.Minute)
+			Expect(restarted.Log(ctx, actorID, "user.logout", map[string]any{})).To(Succeed())
+			Expect(Close(ctx, restarted)).To(Succeed())
+			Expect(rotated()).To(HaveLen(1))
+			Expect(readLines(path)).To(HaveLen(1))
+		})
+	})
+
+	Context("with interval sync", func() {
+		BeforeEach(func() {
+			cfg.FileSyncPolicy = "interval"
+			cfg.FileSyncInterval = 5 * time.Millisecond
+		})
+
+		It("writes events", func() {
+			Expect(logger.Log(ctx, actorID, "user.login", map[string]any{})).To(Succeed())
+			Expect(Close(ctx, logger)).To(Succeed())
+			Expect(readLines(path)).To(HaveLen(1))
+		})
+	})
+
+	It("requires a path", func() {
+		cfg.FilePath = ""
+		l, err := NewAuditLogger(cfg)
+		Expect(err).To(HaveOccurred())
+		Expect(l).To(BeNil())
+	})
+
+	It("verifies a chained file", func() {
+		chained, err := NewAuditLogger(cfg, WithHashChain(nil))
+		Expect(err).NotTo(HaveOccurred())
+		for range 3 {
+			Expect(chained.Log(ctx, actorID, "user.update", map[string]any{})).To(Succeed())
+		}
+		Expect(Close(ctx, chained)).To(Succeed())
+
+		f, err := os.Open(path)
+		Expect(err).NotTo(HaveOccurred())
+		defer f.Close()
+		report, err := VerifyChain(f)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Records).To(Equal(3))
+	})
+
+	Context("with a hash chain", func() {
+		logChained := func(n int) {
+			chained, err := NewAuditLogger(cfg, WithHashChain(nil))
+			Expect(err).NotTo(HaveOccurred())
+			for range n {
+				Expect(chained.Log(ctx, actorID, "user.update", map[string]any{})).To(Succeed())
+			}
+			Expect(Close(ctx, chained)).To(Succeed())
+		}
+
+		lastHash := func(name string) string {
+			lines := readLines(name)
+			var evt Event
+			Expect(json.Unmarshal([]byte(lines[len(lines)-1]), &evt)).To(Succeed())
+			return evt.Hash
+		}
+
+		It("continues the chain of the existing file after a restart", func() {
+			logChained(2)
+			logChained(1)
+
+			f, err := OpenFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			defer f.Close()
+			report, err := VerifyChain(f)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(report).To(Equal(VerifyReport{Records: 3, Chains: 1}))
+		})
+
+		It("continues the chain from the newest rotated file", func() {
+			logChained(2)
+			// compress the file as a rotation would, leaving no live file
+			raw, err := os.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			gz := path + "." + now.UTC().Format("20060102T150405.000000000") + ".gz"
+			out, err := os.Create(gz)
+			Expect(err).NotTo(HaveOccurred())
+			zw := gzip.NewWriter(out)
+			_, err = zw.Write(raw)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(zw.Close()).To(Succeed())
+			Expect(out.Close()).To(Succeed())
+			Expect(os.Remove(path)).To(Succeed())
+
+			logChained(1)
+			var evt Event
+			Expect(json.Unmarshal([]byte(readLines(path)[0]), &evt)).To(Succeed())
+			Expect(evt.PrevHash).To(Equal(lastHash(gz)))
+
+			f, err := OpenFile(gz)
+			Expect(err).NotTo(HaveOccurred())
+			defer f.Close()
+			report, err := VerifyChain(f)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(report.Records).To(Equal(2))
+		})
+	})
+})
@@ -1,26 +1,43 @@
 package audit
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"math/rand/v2"
 	"net/http"
 	"os"
-	"strings"
 	"sync"
 	"time"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
 )
 
 // AuditLogger provides the simplest possible interface for audit logging.
 type AuditLogger interface {
-	LogChange(ctx context.Context, actorID, action string, before, after map[string]any) error
+	// LogChange records the structural difference between before and after,
+	// which may be maps or structs (compared through their json tags).
+	LogChange(ctx context.Context, actorID, action string, before, after any) error
 	Log(ctx context.Context, actorID, action string, details map[string]any) error
 }
 
+// Closer is implemented by the loggers of this package. Close flushes any
+// buffered events and releases the logger; events logged after Close are
+// rejected.
+type Closer interface {
+	Close(ctx context.Context) error
+}
+
+// Close closes logger if it is a Closer and does nothing otherwise.
+func Close(ctx context.Context, logger AuditLogger) error {
+	if c, ok := logger.(Closer); ok {
+		return c.Close(ctx)
+	}
+	return nil
+}
+
 // NewAuditLogger creates an AuditLogger.
 // The first and current implementation is a no-op logger.
 func NewAuditLogger(cfg *Configuration, opts ...Option) (AuditLogger, error) {
@@ -28,6 +45,48 @@ func NewAuditLogger(cfg *Configuration, opts ...Option) (AuditLogger, error) {
 		cfg = NewConfiguration()
 	}
 
+	o := newOptions(opts)
+	builder := newEventBuilder(cfg, o)
+
+	switch cfg.AuditLoggerType {
+	case "noop":
+		return noopAuditLogger{}, nil
+	case "outbox":
+		logger, err := newOutboxAuditLogger(builder)
+		if err != nil {
+			return nil, err
+		}
+		return logger, nil
+	case "stdout":
+		return &stdoutAuditLogger{
+			eventBuilder: builder,
+			output:       o.output,
+		}, nil
+	case "file":
+		logger, err := newFileAuditLogger(cfg, builder)
+		if err != nil {
+			return nil, err
+		}
+		return logger, nil
+	case "http":
+		sink, err := newHTTPSink(cfg, o)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.HTTPAsync {
+			return newAsyncHTTPAuditLogger(cfg, builder, sink), nil
+		}
+
+		return &httpAuditLogger{
+			eventBuilder: builder,
+			httpSink:     sink,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported audit logger type: %s", cfg.AuditLoggerType)
+	}
+}
+
+func newOptions(opts []Option) *options {
 	o := &options{
 		// Default validator with struct tag support
 		validator: validator.New(),
@@ -49,38 +108,18 @@ func NewAuditLogger(cfg *Configuration, opts ...Option) (AuditLogger, error) {
 	if o.httpClient == nil {
 		o.httpClient = &http.Client{Timeout: 5 * time.Second}
 	}
-
-	switch cfg.AuditLoggerType {
-	case "noop":
-		return noopAuditLogger{}, nil
-	case "stdout":
-		return &stdoutAuditLogger{
-			v:               o.validator,
-			output:          o.output,
-			now:             o.now,
-			maxPayloadBytes: cfg.MaxPayloadBytes,
-		}, nil
-	case "http":
-		baseURL := strings.TrimSpace(cfg.AuditLoggerURL)
-		if baseURL == "" {
-			return nil, fmt.Errorf("audit logger url is required for http logger")
-		}
-
-		return &httpAuditLogger{
-			v:               o.validator,
-			client:          o.httpClient,
-			endpoint:        strings.TrimRight(baseURL, "/") + "/api/auditlog",
-			now:             o.now,
-			maxPayloadBytes: cfg.MaxPayloadBytes,
-		}, nil
-	default:
-		return nil, fmt.Errorf("unsupported audit logger type: %s", cfg.AuditLoggerType)
+	if o.newID == nil {
+		o.newID = uuid.NewString
+	}
+	if o.jitter == nil {
+		o.jitter = rand.Float64 //nolint:gosec // jitter does not need a secure source
 	}
+	return o
 }
 
 type noopAuditLogger struct{}
 
-func (noopAuditLogger) LogChange(_ context.Context, _, _ string, _, _ map[string]any) error {
+func (noopAuditLogger) LogChange(_ context.Context, _, _ string, _, _ any) error {
 	return nil
 }
 
@@ -88,40 +127,151 @@ func (noopAuditLogger) Log(_ context.Context, _, _ string, _ map[string]any) err
 	return nil
 }
 
-type stdoutAuditLogger struct {
-	v               *validator.Validate
-	mu              sync.Mutex
-	output          io.Writer
-	now             func() time.Time
-	maxPayloadBytes int
+func (noopAuditLogger) Close(_ context.Context) error {
+	return nil
 }
 
-func (s *stdoutAuditLogger) LogChange(ctx context.Context, actorID, action string, before, after map[string]any) error {
-	details := processDetails(before, after)
+func (noopAuditLogger) writeEvent(_ context.Context, _ Event) error {
+	return nil
+}
+
+// eventWriter is implemented by the loggers in this package. writeEvent
+// delivers an event that has already been built and sealed, which lets the
+// multi logger build an event once and hand it to every sink.
+type eventWriter interface {
+	writeEvent(ctx context.Context, evt Event) error
+}
 
-	return s.Log(ctx, actorID, action, details)
+// eventBuilder validates and bounds events before they are written by a
+// logger implementation.
+type eventBuilder struct {
+	v     *validator.Validate
+	now   func() time.Time
+	newID func() string
+	differ
+	actors          actorResolver
+	redact          *redactor
+	catalog         *Catalog
+	strictCatalog   bool
+	chain           *hashChain
+	maxPayloadBytes int
 }
 
-func (s *stdoutAuditLogger) Log(_ context.Context, actorID, action string, details map[string]any) error {
-	evt := event{
-		ActorID:   actorID,
-		Action:    action,
-		Details:   details,
-		Timestamp: s.now(),
+// build validates and bounds an event. fromDiff is set for the details of
+// LogChange, which hold only the changed fields.
+func (b *eventBuilder) build(
+	ctx context.Context,
+	actorID, action string,
+	details map[string]any,
+	fromDiff bool,
+) (Event, error) {
+	evt := Event{
+		EventID:       b.newID(),
+		SchemaVersion: SchemaVersion,
+		ActorID:       actorID,
+		Action:        action,
+		Details:       details,
+		Timestamp:     b.now(),
+		Source:        currentSource(),
+	}
+	evt.populate(ctx)
+	actor, err := b.actors.resolve(ctx, actorID)
+	if err != nil {
+		return Event{}, err
 	}
+	evt.Actor = actor
+	evt.ActorID = actor.ID
 
-	if err := s.v.Struct(evt); err != nil {
-		return validationErr(err)
+	if err := b.actors.validateID(evt.Actor); err != nil {
+		return Event{}, err
+	}
+	if err := b.v.Struct(evt); err != nil {
+		return Event{}, validationErr(err)
 	}
+	if b.catalog != nil {
+		entry, err := b.catalog.check(action, evt.Details, b.strictCatalog, fromDiff)
+		if err != nil {
+			return Event{}, err
+		}
+		if entry != nil {
+			evt.Details = entry.redact.apply(ctx, evt.Details)
+		}
+	}
+	evt.Details = b.redact.apply(ctx, evt.Details)
 
 	detailsPayload, err := json.Marshal(evt.Details)
+	if err != nil {
+		return Event{}, err
+	}
+	if b.maxPayloadBytes > 0 && len(detailsPayload) > b.maxPayloadBytes {
+		return Event{}, fmt.Errorf("%w: got=%d max=%d", ErrPayloadTooLarge, len(detailsPayload), b.maxPayloadBytes)
+	}
+
+	return evt, nil
+}
+
+// record builds an event and writes it with w.
+func (b *eventBuilder) record(
+	ctx context.Context,
+	w eventWriter,
+	actorID, action string,
+	details map[string]any,
+	fromDiff bool,
+) error {
+	evt, err := b.build(ctx, actorID, action, details, fromDiff)
 	if err != nil {
 		return err
 	}
-	if s.maxPayloadBytes > 0 && len(detailsPayload) > s.maxPayloadBytes {
-		return fmt.Errorf("%w: got=%d max=%d", ErrPayloadTooLarge, len(detailsPayload), s.maxPayloadBytes)
+
+	return b.emit(&evt, func() error {
+		return w.writeEvent(ctx, evt)
+	})
+}
+
+// emit seals evt onto the hash chain, when enabled, and calls write with the
+// sealed event.
+func (b *eventBuilder) emit(evt *Event, write func() error) error {
+	if b.chain == nil {
+		return write()
+	}
+	return b.chain.append(evt, write)
+}
+
+func newEventBuilder(cfg *Configuration, o *options) eventBuilder {
+	return eventBuilder{
+		v:               o.validator,
+		now:             o.now,
+		newID:           o.newID,
+		differ:          newDiffer(o.ignoredFields),
+		actors:          newActorResolver(o),
+		redact:          newRedactor(o.redaction),
+		catalog:         o.catalog,
+		strictCatalog:   o.strictCatalog,
+		chain:           newHashChain(o.chain, o.partition, o.signer),
+		maxPayloadBytes: cfg.MaxPayloadBytes,
+	}
+}
+
+type stdoutAuditLogger struct {
+	eventBuilder
+	mu     sync.Mutex
+	output io.Writer
+}
+
+func (s *stdoutAuditLogger) LogChange(ctx context.Context, actorID, action string, before, after any) error {
+	details, err := s.diff(before, after)
+	if err != nil {
+		return err
 	}
 
+	return s.record(ctx, s, actorID, action, details, true)
+}
+
+func (s *stdoutAuditLogger) Log(ctx context.Context, actorID, action string, details map[string]any) error {
+	return s.record(ctx, s, actorID, action, details, false)
+}
+
+func (s *stdoutAuditLogger) writeEvent(_ context.Context, evt Event) error {
 	payload, err := json.MarshalIndent(evt, "", "  ")
 	if err != nil {
 		return err
@@ -140,55 +290,35 @@ func (s *stdoutAuditLogger) Log(_ context.Context, actorID, action string, detai
 	return nil
 }
 
-type httpAuditLogger struct {
-	v               *validator.Validate
-	client          *http.Client
-	endpoint        string
-	now             func() time.Time
-	maxPayloadBytes int
+func (*stdoutAuditLogger) Close(_ context.Context) error {
+	return nil
 }
 
-func (h *httpAuditLogger) LogChange(ctx context.Context, actorID, action string, before, after map[string]any) error {
-	details := processDetails(before, after)
-	return h.Log(ctx, actorID, action, details)
+type httpAuditLogger struct {
+	eventBuilder
+	*httpSink
 }
 
-func (h *httpAuditLogger) Log(ctx context.Context, actorID, action string, details map[string]any) error {
-	evt := event{
-		ActorID:   actorID,
-		Action:    action,
-		Details:   details,
-		Timestamp: h.now(),
-	}
-
-	if err := h.v.Struct(evt); err != nil {
-		return validationErr(err)
-	}
-
-	payload, err := json.Marshal(evt)
+func (h *httpAuditLogger) LogChange(ctx context.Context, actorID, action string, before, after any) error {
+	details, err := h.diff(before, after)
 	if err != nil {
 		return err
 	}
-	if h.maxPayloadBytes > 0 && len(payload) > h.maxPayloadBytes {
-		return fmt.Errorf("%w: got=%d max=%d", ErrPayloadTooLarge, len(payload), h.maxPayloadBytes)
-	}
+	return h.record(ctx, h, actorID, action, details, true)
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.endpoint, bytes.NewReader(payload))
-	if err != nil {
-		return err
-	}
-	req.Header.Set("Content-Type", "application/json")
+func (h *httpAuditLogger) Log(ctx context.Context, actorID, action string, details map[string]any) error {
+	return h.record(ctx, h, actorID, action, details, false)
+}
 
-	//nolint:gosec // G704: client is injected via WithHTTPClient option
-	resp, err := h.client.Do(req)
+func (h *httpAuditLogger) writeEvent(ctx context.Context, evt Event) error {
+	payload, err := json.Marshal(evt)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
-		return fmt.Errorf("audit http logger request failed with status %d", resp.StatusCode)
-	}
+	return h.Publish(ctx, Message{EventID: evt.EventID, Payload: payload})
+}
 
+func (*httpAuditLogger) Close(_ context.Context) error {
 	return nil
 }
@@ -13,6 +13,7 @@ import (
 
 	"github.com/google/uuid"
 	. "github.com/nojyerac/go-lib/audit"
+	"github.com/nojyerac/go-lib/version"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 )
@@ -29,8 +30,13 @@ func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
 
 const (
 	auditLoggerExampleURL = "https://audit.example.test"
+	testEventID           = "5f0c6f9e-4b6e-4d8a-9a52-0d3c2f4b7a10"
 )
 
+func fixedEventID() string {
+	return testEventID
+}
+
 var _ = Describe("NewAuditLogger", func() {
 	var (
 		cfg     *Configuration
@@ -40,7 +46,7 @@ var _ = Describe("NewAuditLogger", func() {
 		actorID = uuid.New().String()
 	)
 	JustBeforeEach(func() {
-		logger, err = NewAuditLogger(cfg, WithOutput(&out), WithTimeNow(timeNow))
+		logger, err = NewAuditLogger(cfg, WithOutput(&out), WithTimeNow(timeNow), WithEventIDFunc(fixedEventID))
 	})
 	Describe("Noop Logger", func() {
 		BeforeEach(func() {
@@ -62,6 +68,8 @@ var _ = Describe("NewAuditLogger", func() {
 			out.Reset()
 			cfg = NewConfiguration()
 			cfg.AuditLoggerType = "stdout"
+			version.SetServiceName("audit-test")
+			version.SetSemVer("1.2.3")
 		})
 
 		It("logs pretty json to configured output for stdout logger", func() {
@@ -70,7 +78,11 @@ var _ = Describe("NewAuditLogger", func() {
 
 			payload := out.String()
 			Expect(payload).To(MatchJSON(`{
+				"eventID": "` + testEventID + `",
+				"schemaVersion": "2.0",
+				"source": {"service": "audit-test", "version": "1.2.3"},
 				"actorID": "` + actorID + `",
+				"actor": {"type": "user", "id": "` + actorID + `"},
 				"action": "user.update",
 				"details": {
 					"user_id": {
@@ -83,7 +95,9 @@ var _ = Describe("NewAuditLogger", func() {
 		})
 
 		It("returns validation error for invalid event", func() {
-			err = logger.Log(context.Background(), "bad-actor-id", "user.login", map[string]any{"user_id": "u-1"})
+			err = logger.Log(context.Background(), "", "user.login", map[string]any{"user_id": "u-1"})
+			Expect(err).To(MatchError(ErrInvalidEventActorID))
+			err = logger.Log(context.Background(), "bad\tactor", "user.login", map[string]any{"user_id": "u-1"})
 			Expect(err).To(MatchError(ErrInvalidEventActorID))
 			err = logger.Log(context.Background(), actorID, "", map[string]any{"user_id": "u-1"})
 			Expect(err).To(MatchError(ErrInvalidEventAction))
@@ -122,6 +136,8 @@ var _ = Describe("NewAuditLogger", func() {
 			out.Reset()
 			cfg = NewConfiguration()
 			cfg.AuditLoggerType = "http"
+			cfg.HTTPRetryBaseDelay = time.Millisecond
+			cfg.HTTPRetryMaxDelay = 5 * time.Millisecond
 		})
 
 		It("posts audit logs to /api/auditlog", func() {
@@ -0,0 +1,103 @@
+package audit
+
+import (
+	"sync"
+
+	"github.com/nojyerac/go-lib/metrics"
+	"go.opentelemetry.io/otel/metric"
+)
+
+var (
+	meter             = metrics.MeterForPackage()
+	initOutboxMetrics sync.Once
+	outboxCounters    outboxInstruments
+)
+
+type outboxInstruments struct {
+	queued    metric.Int64Counter
+	published metric.Int64Counter
+	retried   metric.Int64Counter
+	failed    metric.Int64Counter
+	dlq       metric.Int64Counter
+}
+
+func outboxMetrics() *outboxInstruments {
+	initOutboxMetrics.Do(func() {
+		// the meter returns usable no-op instruments alongside any error
+		outboxCounters.queued, _ = meter.Int64Counter(
+			"audit_outbox_queued",
+			metric.WithDescription("count of audit events staged in the outbox"),
+		)
+		outboxCounters.published, _ = meter.Int64Counter(
+			"audit_outbox_published",
+			metric.WithDescription("count of outbox events delivered to the publisher"),
+		)
+		outboxCounters.retried, _ = meter.Int64Counter(
+			"audit_outbox_retried",
+			metric.WithDescription("count of outbox events rescheduled after a failed publish"),
+		)
+		outboxCounters.failed, _ = meter.Int64Counter(
+			"audit_outbox_failed",
+			metric.WithDescription("count of failed outbox publish attempts"),
+		)
+		outboxCounters.dlq, _ = meter.Int64Counter(
+			"audit_outbox_dlq",
+			metric.WithDescription("count of outbox events moved to the dead-letter table"),
+		)
+	})
+	return &outboxCounters
+}
+
+var (
+	initRedactionMetrics sync.Once
+	redactionCounter     metric.Int64Counter
+)
+
+func redactionMetrics() metric.Int64Counter {
+	initRedactionMetrics.Do(func() {
+		redactionCounter, _ = meter.Int64Counter(
+			"audit_redactions",
+			metric.WithDescription("count of values redacted from audit details, by rule"),
+		)
+	})
+	return redactionCounter
+}
+
+var (
+	initAsyncMetrics sync.Once
+	asyncCounters    asyncInstruments
+)
+
+type asyncInstruments struct {
+	depth   metric.Int64UpDownCounter
+	dropped metric.Int64Counter
+}
+
+func asyncMetrics() *asyncInstruments {
+	initAsyncMetrics.Do(func() {
+		asyncCounters.depth, _ = meter.Int64UpDownCounter(
+			"audit_http_queue_depth",
+			metric.WithDescription("number of audit events waiting in async http queues"),
+		)
+		asyncCounters.dropped, _ = meter.Int64Counter(
+			"audit_http_dropped",
+			metric.WithDescription("count of audit events dropped by async http loggers, by reason"),
+		)
+	})
+	return &asyncCounters
+}
+
+var (
+	initSinkMetrics sync.Once
+	sinkErrors      metric.Int64Counter
+)
+
+func sinkMetrics() metric.Int64Counter {
+	initSinkMetrics.Do(func() {
+		sinkErrors, _ = meter.Int64Counter(
+			"audit_sink_errors",
+			metric.WithDescription("count of failed writes to multi logger sinks, by sink and policy"),
+		)
+	})
+	return sinkErrors
+}
@@ -0,0 +1,166 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/nojyerac/go-lib/log"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// SinkPolicy decides how a multi logger treats a sink's write error.
+type SinkPolicy string
+
+const (
+	// SinkRequired returns the sink's error from Log.
+	SinkRequired SinkPolicy = "required"
+	// SinkBestEffort logs and counts the sink's error and otherwise ignores it.
+	SinkBestEffort SinkPolicy = "best_effort"
+)
+
+// Sink is one destination of a multi logger. Logger must be created by this
+// package (NewAuditLogger or NewOutboxAuditLogger). Policy defaults to
+// SinkRequired.
+type Sink struct {
+	Name   string
+	Logger AuditLogger
+	Policy SinkPolicy
+}
+
+type multiSink struct {
+	Sink
+	writer eventWriter
+}
+
+// multiAuditLogger builds each event once and writes it to every sink.
+type multiAuditLogger struct {
+	eventBuilder
+	sinks []multiSink
+}
+
+// NewMultiAuditLogger returns an AuditLogger that writes every event to all
+// sinks concurrently. Events are validated, redacted and, with WithHashChain,
+// sealed once with cfg and opts, so every sink receives the same event; the
+// sinks' own redaction and chain options are not applied.
+//
+// Log returns the errors of required sinks. The hash chain advances when no
+// required sink failed; it cannot be combined with an outbox sink
+// (ErrOutboxChain). Close closes every sink.
+func NewMultiAuditLogger(cfg *Configuration, sinks []Sink, opts ...Option) (AuditLogger, error) {
+	if cfg == nil {
+		cfg = NewConfiguration()
+	}
+	if len(sinks) == 0 {
+		return nil, errors.New("audit multi logger requires at least one sink")
+	}
+
+	names := make(map[string]bool, len(sinks))
+	multi := &multiAuditLogger{
+		eventBuilder: newEventBuilder(cfg, newOptions(opts)),
+		sinks:        make([]multiSink, 0, len(sinks)),
+	}
+	for i, sink := range sinks {
+		if sink.Name == "" {
+			return nil, fmt.Errorf("audit sink %d: name is required", i)
+		}
+		if names[sink.Name] {
+			return nil, fmt.Errorf("audit sink %s: duplicate name", sink.Name)
+		}
+		names[sink.Name] = true
+
+		switch sink.Policy {
+		case "":
+			sink.Policy = SinkRequired
+		case SinkRequired, SinkBestEffort:
+		default:
+			return nil, fmt.Errorf("audit sink %s: unsupported policy %q", sink.Name, sink.Policy)
+		}
+		writer, ok := sink.Logger.(eventWriter)
+		if !ok {
+			return nil, fmt.Errorf("audit sink %s: logger %T was not created by the audit package", sink.Name, sink.Logger)
+		}
+		if multi.chain != nil && writesInTx(writer) {
+			return nil, fmt.Errorf("audit sink %s: %w", sink.Name, ErrOutboxChain)
+		}
+		multi.sinks = append(multi.sinks, multiSink{Sink: sink, writer: writer})
+	}
+	return multi, nil
+}
+
+// writesInTx reports whether w, or any sink below it, is an outbox logger.
+func writesInTx(w eventWriter) bool {
+	switch w := w.(type) {
+	case *outboxAuditLogger:
+		return true
+	case *multiAuditLogger:
+		for _, sink := range w.sinks {
+			if writesInTx(sink.writer) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (m *multiAuditLogger) LogChange(ctx context.Context, actorID, action string, before, after any) error {
+	details, err := m.diff(before, after)
+	if err != nil {
+		return err
+	}
+	return m.record(ctx, m, actorID, action, details, true)
+}
+
+func (m *multiAuditLogger) Log(ctx context.Context, actorID, action string, details map[string]any) error {
+	return m.record(ctx, m, actorID, action, details, false)
+}
+
+// writeEvent also lets a multi logger be a sink of another multi logger.
+func (m *multiAuditLogger) writeEvent(ctx context.Context, evt Event) error {
+	errs := make([]error, len(m.sinks))
+	var wg sync.WaitGroup
+	for i := range m.sinks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = m.sinks[i].write(ctx, evt)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// write returns the sink's error only for required sinks.
+func (s *multiSink) write(ctx context.Context, evt Event) error {
+	err := s.writer.writeEvent(ctx, evt)
+	if err == nil {
+		return nil
+	}
+
+	sinkMetrics().Add(ctx, 1, metric.WithAttributes(
+		attribute.String("sink", s.Name),
+		attribute.String("policy", string(s.Policy)),
+	))
+	if s.Policy == SinkRequired {
+		return fmt.Errorf("audit sink %s: %w", s.Name, err)
+	}
+	log.FromContext(ctx).WithFields(logrus.Fields{
+		"sink":     s.Name,
+		"event_id": evt.EventID,
+	}).WithError(err).Warn("best-effort audit sink failed")
+	return nil
+}
+
+// Close closes every sink, even when some of them fail.
+func (m *multiAuditLogger) Close(ctx context.Context) error {
+	errs := make([]error, 0, len(m.sinks))
+	for _, sink := range m.sinks {
+		if err := Close(ctx, sink.Logger); err != nil {
+			errs = append(errs, fmt.Errorf("audit sink %s: %w", sink.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,158 @@
+package audit_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+
+	"github.com/google/uuid"
+	. "github.com/nojyerac/go-lib/audit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+type foreignLogger struct {
+	AuditLogger
+}
+
+var _ = Describe("Multi Logger", func() {
+	var (
+		ctx           context.Context
+		actorID       string
+		primary       bytes.Buffer
+		secondary     bytes.Buffer
+		primarySink   AuditLogger
+		secondarySink AuditLogger
+	)
+
+	newStdout := func(out *bytes.Buffer) AuditLogger {
+		cfg := NewConfiguration()
+		cfg.AuditLoggerType = "stdout"
+		logger, err := NewAuditLogger(cfg, WithOutput(out))
+		Expect(err).NotTo(HaveOccurred())
+		return logger
+	}
+
+	decode := func(out *bytes.Buffer) Event {
+		var evt Event
+		Expect(json.Unmarshal(out.Bytes(), &evt)).To(Succeed())
+		return evt
+	}
+
+	BeforeEach(func() {
+		useMetricReader()
+		ctx = context.Background()
+		actorID = uuid.NewString()
+		primary.Reset()
+		secondary.Reset()
+		primarySink = newStdout(&primary)
+		secondarySink = newStdout(&secondary)
+	})
+
+	It("writes the same event to every sink", func() {
+		logger, err := NewMultiAuditLogger(nil, []Sink{
+			{Name: "primary", Logger: primarySink},
+			{Name: "secondary", Logger: secondarySink, Policy: SinkBestEffort},
+		}, WithRedaction(RedactionRule{Keys: []string{"password"}}), WithHashChain(nil))
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(logger.Log(ctx, actorID, "user.update", map[string]any{"password": "hunter2"})).To(Succeed())
+
+		first, second := decode(&primary), decode(&secondary)
+		Expect(first.EventID).NotTo(BeEmpty())
+		Expect(second.EventID).To(Equal(first.EventID))
+		Expect(second.Hash).To(Equal(first.Hash))
+		Expect(first.Details).To(HaveKeyWithValue("password", RedactedValue))
+		Expect(second.Details).To(HaveKeyWithValue("password", RedactedValue))
+	})
+
+	It("validates before fan-out", func() {
+		logger, err := NewMultiAuditLogger(nil, []Sink{{Name: "primary", Logger: primarySink}})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(logger.Log(ctx, "", "user.update", map[string]any{})).To(MatchError(ErrInvalidEventActorID))
+		Expect(primary.Len()).To(BeZero())
+	})
+
+	Context("when a sink fails", func() {
+		var failing AuditLogger
+
+		BeforeEach(func() {
+			cfg := NewConfiguration()
+			cfg.AuditLoggerType = "stdout"
+			var err error
+			failing, err = NewAuditLogger(cfg, WithOutput(failingWriter{}))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("returns the error of a required sink", func() {
+			logger, err := NewMultiAuditLogger(nil, []Sink{
+				{Name: "primary", Logger: primarySink},
+				{Name: "central", Logger: failing, Policy: SinkRequired},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			err = logger.Log(ctx, actorID, "user.update", map[string]any{})
+			Expect(err).To(MatchError(ContainSubstring("audit sink central: disk full")))
+			Expect(primary.Len()).NotTo(BeZero())
+			Expect(counterValue("audit_sink_errors", "policy", "required")).To(BeEquivalentTo(1))
+		})
+
+		It("logs and counts the error of a best-effort sink", func() {
+			logger, err := NewMultiAuditLogger(nil, []Sink{
+				{Name: "primary", Logger: primarySink},
+				{Name: "central", Logger: failing, Policy: SinkBestEffort},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(logger.Log(ctx, actorID, "user.update", map[string]any{})).To(Succeed())
+			Expect(primary.Len()).NotTo(BeZero())
+			Expect(counterValue("audit_sink_errors", "sink", "central")).To(BeEquivalentTo(1))
+		})
+	})
+
+	It("closes every sink", func() {
+		cfg := NewConfiguration()
+		cfg.AuditLoggerType = "file"
+		cfg.FilePath = filepath.Join(GinkgoT().TempDir(), "audit.log")
+		fileSink, err := NewAuditLogger(cfg)
+		Expect(err).NotTo(HaveOccurred())
+
+		logger, err := NewMultiAuditLogger(nil, []Sink{
+			{Name: "primary", Logger: primarySink},
+			{Name: "file", Logger: fileSink},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(Close(ctx, logger)).To(Succeed())
+
+		Expect(logger.Log(ctx, actorID, "user.update", map[string]any{})).To(MatchError(ErrLoggerClosed))
+	})
+
+	DescribeTable("rejects invalid sinks",
+		func(sinks func() []Sink, message string) {
+			_, err := NewMultiAuditLogger(nil, sinks())
+			Expect(err).To(MatchError(ContainSubstring(message)))
+		},
+		Entry("no sinks", func() []Sink { return nil }, "at least one sink"),
+		Entry("missing name", func() []Sink {
+			return []Sink{{Logger: primarySink}}
+		}, "name is required"),
+		Entry("duplicate name", func() []Sink {
+			return []Sink{{Name: "a", Logger: primarySink}, {Name: "a", Logger: secondarySink}}
+		}, "duplicate name"),
+		Entry("unknown policy", func() []Sink {
+			return []Sink{{Name: "a", Logger: primarySink, Policy: "sometimes"}}
+		}, "unsupported policy"),
+		Entry("foreign logger", func() []Sink {
+			return []Sink{{Name: "a", Logger: foreignLogger{primarySink}}}
+		}, "not created by the audit package"),
+	)
+})
@@ -0,0 +1,187 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/nojyerac/go-lib/db"
+)
+
+var (
+	ErrNoTransaction = errors.New("audit outbox logger requires a transaction")
+	// ErrOutboxChain is returned when a hash chain or signer is configured
+	// for the outbox logger. Events are inserted in transactions that may
+	// still roll back or commit out of order, so a chain sealed at insert
+	// time would not match the committed rows.
+	ErrOutboxChain = errors.New("audit outbox logger does not support hash chains")
+)
+
+// OutboxTable is the table the outbox logger appends events to.
+const OutboxTable = "audit_outbox"
+
+// OutboxTableDDL creates the outbox table (PostgreSQL).
+const OutboxTableDDL = `CREATE TABLE IF NOT EXISTS audit_outbox (
+    id           BIGSERIAL PRIMARY KEY,
+    event_id     UUID NOT NULL UNIQUE,
+    payload      JSONB NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    attempts     INTEGER NOT NULL DEFAULT 0,
+    available_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_error   TEXT
+);
+CREATE INDEX IF NOT EXISTS audit_outbox_available_at_idx ON audit_outbox (available_at, id);`
+
+// DeadLetterTable holds outbox events that exhausted their delivery attempts.
+const DeadLetterTable = "audit_outbox_dlq"
+
+// DeadLetterTableDDL creates the dead-letter table (PostgreSQL).
+const DeadLetterTableDDL = `CREATE TABLE IF NOT EXISTS audit_outbox_dlq (
+    id          BIGSERIAL PRIMARY KEY,
+    event_id    UUID NOT NULL UNIQUE,
+    payload     JSONB NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL,
+    failed_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    attempts    INTEGER NOT NULL,
+    last_error  TEXT
+);`
+
+// TxAuditLogger is an AuditLogger that writes through a database transaction,
+// so an event commits or rolls back together with the change it records.
+//
+// Log and LogChange use the transaction attached to ctx with WithTx and fail
+// with ErrNoTransaction when there is none.
+type TxAuditLogger interface {
+	AuditLogger
+	LogTx(ctx context.Context, tx db.Tx, actorID, action string, details map[string]any) error
+	LogChangeTx(ctx context.Context, tx db.Tx, actorID, action string, before, after any) error
+}
+
+type ctxTxKeyType struct{}
+
+var ctxTxKey = ctxTxKeyType{}
+
+// WithTx attaches tx to ctx for use by the outbox logger.
+func WithTx(ctx context.Context, tx db.Tx) context.Context {
+	return context.WithValue(ctx, ctxTxKey, tx)
+}
+
+// TxFromContext returns the transaction attached with WithTx.
+func TxFromContext(ctx context.Context) (db.Tx, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	tx, ok := ctx.Value(ctxTxKey).(db.Tx)
+	if !ok || tx == nil {
+		return nil, false
+	}
+	return tx, true
+}
+
+// NewOutboxAuditLogger returns a TxAuditLogger that appends events to the
+// audit_outbox table. Create the table with OutboxTableDDL. It returns
+// ErrOutboxChain with WithHashChain or WithSigner.
+func NewOutboxAuditLogger(cfg *Configuration, opts ...Option) (TxAuditLogger, error) {
+	if cfg == nil {
+		cfg = NewConfiguration()
+	}
+	return newOutboxAuditLogger(newEventBuilder(cfg, newOptions(opts)))
+}
+
+func newOutboxAuditLogger(builder eventBuilder) (*outboxAuditLogger, error) {
+	if builder.chain != nil {
+		return nil, ErrOutboxChain
+	}
+	return &outboxAuditLogger{eventBuilder: builder}, nil
+}
+
+type outboxAuditLogger struct {
+	eventBuilder
+}
+
+func (o *outboxAuditLogger) LogChange(ctx context.Context, actorID, action string, before, after any) error {
+	tx, ok := TxFromContext(ctx)
+	if !ok {
+		return ErrNoTransaction
+	}
+	return o.LogChangeTx(ctx, tx, actorID, action, before, after)
+}
+
+func (o *outboxAuditLogger) Log(ctx context.Context, actorID, action string, details map[string]any) error {
+	tx, ok := TxFromContext(ctx)
+	if !ok {
+		return ErrNoTransaction
+	}
+	return o.LogTx(ctx, tx, actorID, action, details)
+}
+
+func (*outboxAuditLogger) Close(_ context.Context) error {
+	return nil
+}
+
+func (o *outboxAuditLogger) LogChangeTx(
+	ctx context.Context,
+	tx db.Tx,
+	actorID, action string,
+	before, after any,
+) error {
+	details, err := o.diff(before, after)
+	if err != nil {
+		return err
+	}
+	return o.logTx(ctx, tx, actorID, action, details, true)
+}
+
+func (o *outboxAuditLogger) LogTx(
+	ctx context.Context,
+	tx db.Tx,
+	actorID, action string,
+	details map[string]any,
+) error {
+	return o.logTx(ctx, tx, actorID, action, details, false)
+}
+
+func (o *outboxAuditLogger) logTx(
+	ctx context.Context,
+	tx db.Tx,
+	actorID, action string,
+	details map[string]any,
+	fromDiff bool,
+) error {
+	if tx == nil {
+		return ErrNoTransaction
+	}
+
+	evt, err := o.build(ctx, actorID, action, details, fromDiff)
+	if err != nil {
+		return err
+	}
+
+	return o.insert(ctx, tx, evt)
+}
+
+// writeEvent inserts evt using the transaction attached to ctx with WithTx.
+func (o *outboxAuditLogger) writeEvent(ctx context.Context, evt Event) error {
+	tx, ok := TxFromContext(ctx)
+	if !ok {
+		return ErrNoTransaction
+	}
+	return o.insert(ctx, tx, evt)
+}
+
+func (*outboxAuditLogger) insert(ctx context.Context, tx db.Tx, evt Event) error {
+	payload, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(
+		ctx,
+		`INSERT INTO `+OutboxTable+` (event_id, payload) VALUES ($1, $2)`,
+		evt.EventID,
+		payload,
+	); err != nil {
+		return err
+	}
+	outboxMetrics().queued.Add(ctx, 1)
+	return nil
+}
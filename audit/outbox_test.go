@@ -0,0 +1,134 @@
+package audit_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	. "github.com/nojyerac/go-lib/audit"
+	"github.com/nojyerac/go-lib/db"
+	"github.com/nojyerac/go-lib/log"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var dsnCount int
+
+// openMockDatabase opens a db.Database backed by a fresh sqlmock connection
+// and registers cleanup that verifies all expectations were met.
+func openMockDatabase(ctx context.Context) (db.Database, sqlmock.Sqlmock) {
+	dsnCount++
+	dsn := fmt.Sprintf("auditDB-%d", dsnCount)
+	_, sqlMock, err := sqlmock.NewWithDSN(dsn)
+	Expect(err).NotTo(HaveOccurred())
+
+	config := db.NewConfiguration()
+	config.Driver = "sqlmock"
+	config.DBConnStr = dsn
+	database := db.NewDatabase(config, db.WithLogger(log.Nop()))
+	Expect(database.Open(ctx)).To(Succeed())
+	DeferCleanup(func() {
+		Expect(sqlMock.ExpectationsWereMet()).To(Succeed())
+		sqlMock.ExpectClose()
+		Expect(database.Close()).To(Succeed())
+	})
+	return database, sqlMock
+}
+
+var _ = Describe("OutboxAuditLogger", func() {
+	var (
+		ctx      context.Context
+		database db.Database
+		sqlMock  sqlmock.Sqlmock
+		logger   TxAuditLogger
+		actorID  = uuid.New().String()
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		database, sqlMock = openMockDatabase(ctx)
+		var err error
+		logger, err = NewOutboxAuditLogger(NewConfiguration(), WithTimeNow(timeNow))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("rejects a hash chain", func() {
+		_, err := NewOutboxAuditLogger(NewConfiguration(), WithHashChain(nil))
+		Expect(err).To(MatchError(ErrOutboxChain))
+
+		cfg := NewConfiguration()
+		cfg.AuditLoggerType = "outbox"
+		_, err = NewAuditLogger(cfg, WithSigner(HMACSigner{Key: []byte("k")}))
+		Expect(err).To(MatchError(ErrOutboxChain))
+
+		_, err = NewMultiAuditLogger(NewConfiguration(), []Sink{{Name: "outbox", Logger: logger}}, WithHashChain(nil))
+		Expect(err).To(MatchError(ErrOutboxChain))
+	})
+
+	It("is selectable through the configuration", func() {
+		cfg := NewConfiguration()
+		cfg.AuditLoggerType = "outbox"
+		l, err := NewAuditLogger(cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(l).To(BeAssignableToTypeOf(logger))
+	})
+
+	It("writes the event in the caller's transaction", func() {
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectExec(`INSERT INTO audit_outbox \(event_id, payload\) VALUES \(\$1, \$2\)`).
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		sqlMock.ExpectCommit()
+
+		tx, err := database.Begin(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(logger.LogTx(ctx, tx, actorID, "user.update", map[string]any{"field": "email"})).To(Succeed())
+		Expect(tx.Commit(ctx)).To(Succeed())
+	})
+
+	It("uses the transaction attached to the context", func() {
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectExec(`INSERT INTO audit_outbox`).
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		sqlMock.ExpectRollback()
+
+		tx, err := database.Begin(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		txCtx := WithTx(ctx, tx)
+		Expect(logger.LogChange(txCtx, actorID, "user.update",
+			map[string]any{"email": "a@example.com"},
+			map[string]any{"email": "b@example.com"},
+		)).To(Succeed())
+		Expect(tx.Rollback(ctx)).To(Succeed())
+	})
+
+	It("requires a transaction", func() {
+		Expect(logger.Log(ctx, actorID, "user.update", nil)).To(MatchError(ErrNoTransaction))
+		Expect(logger.LogTx(ctx, nil, actorID, "user.update", nil)).To(MatchError(ErrNoTransaction))
+	})
+
+	It("validates events before writing", func() {
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectRollback()
+
+		tx, err := database.Begin(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		err = logger.LogTx(ctx, tx, "", "user.update", nil)
+		Expect(err).To(MatchError(ErrInvalidEventActorID))
+		Expect(tx.Rollback(ctx)).To(Succeed())
+	})
+
+	It("returns insert errors", func() {
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectExec(`INSERT INTO audit_outbox`).WillReturnError(errors.New("boom"))
+		sqlMock.ExpectRollback()
+
+		tx, err := database.Begin(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(logger.LogTx(ctx, tx, actorID, "user.update", map[string]any{"field": "email"})).To(MatchError("boom"))
+		Expect(tx.Rollback(ctx)).To(Succeed())
+	})
+})
@@ -0,0 +1,233 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Message is a serialized audit event handed to a Publisher.
+type Message struct {
+	EventID string
+	Payload []byte
+}
+
+// Publisher delivers serialized audit events to a downstream sink. The outbox
+// Dispatcher relays staged events through a Publisher.
+type Publisher interface {
+	Publish(ctx context.Context, msg Message) error
+}
+
+// NewHTTPPublisher returns a Publisher that POSTs each message to
+// <AuditLoggerURL><HTTPPath>, the same endpoint used by the http logger.
+func NewHTTPPublisher(cfg *Configuration, opts ...Option) (Publisher, error) {
+	if cfg == nil {
+		cfg = NewConfiguration()
+	}
+	return newHTTPSink(cfg, newOptions(opts))
+}
+
+// IdempotencyKeyHeader carries a key that is stable across retries of the same
+// delivery, so the sink can discard duplicates.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+type httpSink struct {
+	client        *http.Client
+	endpoint      string
+	batchEndpoint string
+	tokens        TokenSource
+	signingSecret []byte
+	now           func() time.Time
+	maxRetries    int
+	baseDelay     time.Duration
+	maxDelay      time.Duration
+	jitter        func() float64
+}
+
+func newHTTPSink(cfg *Configuration, o *options) (*httpSink, error) {
+	baseURL := strings.TrimSpace(cfg.AuditLoggerURL)
+	if baseURL == "" {
+		return nil, fmt.Errorf("audit logger url is required for http logger")
+	}
+
+	client, err := withClientTLS(o.httpClient, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	baseURL = strings.TrimRight(baseURL, "/")
+	return &httpSink{
+		client:        client,
+		endpoint:      baseURL + cfg.HTTPPath,
+		batchEndpoint: baseURL + cfg.HTTPBatchPath,
+		tokens:        o.tokens,
+		signingSecret: []byte(cfg.HTTPSigningSecret),
+		now:           o.now,
+		maxRetries:    cfg.HTTPMaxRetries,
+		baseDelay:     cfg.HTTPRetryBaseDelay,
+		maxDelay:      cfg.HTTPRetryMaxDelay,
+		jitter:        o.jitter,
+	}, nil
+}
+
+// Publish POSTs msg with its event ID as the idempotency key.
+func (h *httpSink) Publish(ctx context.Context, msg Message) error {
+	return h.post(ctx, h.endpoint, "application/json", msg.EventID, msg.Payload)
+}
+
+// publishOnce makes a single delivery attempt, for the Dispatcher, which
+// reschedules failed rows itself.
+func (h *httpSink) publishOnce(ctx context.Context, msg Message) error {
+	_, err := h.send(ctx, h.endpoint, "application/json", msg.EventID, msg.Payload)
+	return err
+}
+
+// PublishBatch POSTs msgs in one request to the batch endpoint, either as a JSON
+// array or as newline-delimited JSON.
+func (h *httpSink) PublishBatch(ctx context.Context, msgs []Message, format string) error {
+	var (
+		body        bytes.Buffer
+		contentType = "application/json"
+	)
+	switch format {
+	case batchFormatNDJSON:
+		contentType = "application/x-ndjson"
+		for _, msg := range msgs {
+			body.Write(msg.Payload)
+			body.WriteByte('\n')
+		}
+	default:
+		body.WriteByte('[')
+		for i, msg := range msgs {
+			if i > 0 {
+				body.WriteByte(',')
+			}
+			body.Write(msg.Payload)
+		}
+		body.WriteByte(']')
+	}
+	return h.post(ctx, h.batchEndpoint, contentType, batchIdempotencyKey(msgs), body.Bytes())
+}
+
+// batchIdempotencyKey derives a key from the event IDs in a batch. Each event
+// in the body still carries its own eventID for per-event deduplication.
+func batchIdempotencyKey(msgs []Message) string {
+	h := sha256.New()
+	for _, msg := range msgs {
+		h.Write([]byte(msg.EventID))
+		h.Write([]byte{0})
+	}
+	return "batch-" + hex.EncodeToString(h.Sum(nil))
+}
+
+// post sends payload, retrying transport errors, 429 and 5xx responses up to
+// maxRetries times with capped exponential backoff. A Retry-After header on
+// the response overrides the computed delay, within the same cap.
+func (h *httpSink) post(ctx context.Context, endpoint, contentType, idempotencyKey string, payload []byte) error {
+	for attempt := 0; ; attempt++ {
+		retryAfter, err := h.send(ctx, endpoint, contentType, idempotencyKey, payload)
+		if err == nil {
+			return nil
+		}
+		var permanent *permanentError
+		if errors.As(err, &permanent) || attempt >= h.maxRetries {
+			if attempt > 0 {
+				return fmt.Errorf("audit http delivery failed after %d attempts: %w", attempt+1, err)
+			}
+			return err
+		}
+
+		delay := min(retryAfter, h.maxDelay)
+		if delay <= 0 {
+			delay = backoffDelay(h.baseDelay, h.maxDelay, attempt+1, h.jitter)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(err, ctx.Err())
+		}
+	}
+}
+
+// permanentError marks a response that retrying will not fix.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// send makes a single attempt and returns the server's Retry-After delay, if
+// any, alongside retryable errors. The bearer token and signature are
+// refreshed on every attempt so retries are not rejected as stale.
+func (h *httpSink) send(
+	ctx context.Context,
+	endpoint, contentType, idempotencyKey string,
+	payload []byte,
+) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return 0, &permanentError{err: err}
+	}
+	req.Header.Set("Content-Type", contentType)
+	if idempotencyKey != "" {
+		req.Header.Set(IdempotencyKeyHeader, idempotencyKey)
+	}
+	if h.tokens != nil {
+		token, err := h.tokens.Token(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("audit http token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if len(h.signingSecret) > 0 {
+		timestamp := strconv.FormatInt(h.now().Unix(), 10)
+		req.Header.Set(TimestampHeader, timestamp)
+		req.Header.Set(SignatureHeader,
+			signRequest(h.signingSecret, timestamp, req.Method, req.URL.EscapedPath(), idempotencyKey, payload))
+	}
+
+	//nolint:gosec // G704: client is injected via WithHTTPClient option
+	resp, err := h.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return 0, &permanentError{err: err}
+		}
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
+		return 0, nil
+	}
+	statusErr := fmt.Errorf("audit http logger request failed with status %d", resp.StatusCode)
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError {
+		return parseRetryAfter(resp.Header.Get("Retry-After"), h.now()), statusErr
+	}
+	return 0, &permanentError{err: statusErr}
+}
+
+// parseRetryAfter reads a Retry-After value given in seconds or as an HTTP date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return at.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,370 @@
+package audit_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	. "github.com/nojyerac/go-lib/audit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HTTP Publisher", func() {
+	var (
+		ctx       context.Context
+		cfg       *Configuration
+		mu        sync.Mutex
+		statuses  []int
+		headers   []http.Header
+		keys      []string
+		server    *httptest.Server
+		publisher Publisher
+		msg       Message
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		statuses = nil
+		headers = nil
+		keys = nil
+		cfg = NewConfiguration()
+		cfg.HTTPMaxRetries = 2
+		cfg.HTTPRetryBaseDelay = time.Millisecond
+		cfg.HTTPRetryMaxDelay = 5 * time.Millisecond
+		msg = Message{EventID: uuid.NewString(), Payload: []byte(`{}`)}
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			keys = append(keys, r.Header.Get(IdempotencyKeyHeader))
+			status := http.StatusAccepted
+			if len(statuses) > 0 {
+				status, statuses = statuses[0], statuses[1:]
+			}
+			if len(headers) > 0 {
+				for k, v := range headers[0] {
+					w.Header()[k] = v
+				}
+				headers = headers[1:]
+			}
+			w.WriteHeader(status)
+		}))
+		DeferCleanup(server.Close)
+	})
+
+	JustBeforeEach(func() {
+		cfg.AuditLoggerURL = server.URL
+		var err error
+		publisher, err = NewHTTPPublisher(cfg)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("retries 5xx and 429 responses with the same idempotency key", func() {
+		statuses = []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}
+
+		Expect(publisher.Publish(ctx, msg)).To(Succeed())
+		Expect(keys).To(Equal([]string{msg.EventID, msg.EventID, msg.EventID}))
+	})
+
+	It("gives up after the configured retries", func() {
+		statuses = []int{500, 502, 503, 504}
+
+		err := publisher.Publish(ctx, msg)
+		Expect(err).To(MatchError(ContainSubstring("after 3 attempts")))
+		Expect(err).To(MatchError(ContainSubstring("status 503")))
+		Expect(keys).To(HaveLen(3))
+	})
+
+	It("does not retry other client errors", func() {
+		statuses = []int{http.StatusBadRequest}
+
+		Expect(publisher.Publish(ctx, msg)).To(MatchError(ContainSubstring("status 400")))
+		Expect(keys).To(HaveLen(1))
+	})
+
+	newPublisher := func(opts ...Option) Publisher {
+		p, err := NewHTTPPublisher(cfg, opts...)
+		Expect(err).NotTo(HaveOccurred())
+		return p
+	}
+
+	It("honors Retry-After", func() {
+		cfg.HTTPRetryMaxDelay = 2 * time.Second
+		publisher = newPublisher()
+		statuses = []int{http.StatusTooManyRequests}
+		headers = []http.Header{{"Retry-After": []string{"1"}}}
+
+		start := time.Now()
+		Expect(publisher.Publish(ctx, msg)).To(Succeed())
+		Expect(time.Since(start)).To(BeNumerically(">=", 900*time.Millisecond))
+	})
+
+	It("caps Retry-After at the maximum retry delay", func() {
+		statuses = []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable}
+		headers = []http.Header{
+			{"Retry-After": []string{"3600"}},
+			{"Retry-After": []string{timeNow().Add(time.Hour).Format(http.TimeFormat)}},
+		}
+		publisher = newPublisher(WithTimeNow(timeNow))
+
+		start := time.Now()
+		Expect(publisher.Publish(ctx, msg)).To(Succeed())
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+		Expect(keys).To(HaveLen(3))
+	})
+
+	It("stops retrying when the context is done", func() {
+		cfg.HTTPRetryMaxDelay = time.Minute
+		publisher = newPublisher()
+		statuses = []int{http.StatusTooManyRequests}
+		headers = []http.Header{{"Retry-After": []string{"60"}}}
+
+		timeoutCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		Expect(publisher.Publish(timeoutCtx, msg)).To(MatchError(context.DeadlineExceeded))
+	})
+
+	Context("with transport errors", func() {
+		It("retries them", func() {
+			calls := 0
+			client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				calls++
+				if calls == 1 {
+					return nil, errors.New("connection reset")
+				}
+				Expect(req.Header.Get(IdempotencyKeyHeader)).To(Equal(msg.EventID))
+				body, err := io.ReadAll(req.Body)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(body)).To(Equal(`{}`))
+				return &http.Response{
+					StatusCode: http.StatusAccepted,
+					Header:     make(http.Header),
+					Body:       io.NopCloser(strings.NewReader("")),
+				}, nil
+			})}
+
+			p, err := NewHTTPPublisher(cfg, WithHTTPClient(client))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(p.Publish(ctx, msg)).To(Succeed())
+			Expect(calls).To(Equal(2))
+		})
+	})
+
+	Context("with custom paths", func() {
+		BeforeEach(func() {
+			cfg.HTTPPath = "/v2/events"
+		})
+
+		It("posts to the configured path", func() {
+			var path string
+			server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				path = r.URL.Path
+				w.WriteHeader(http.StatusAccepted)
+			})
+
+			Expect(publisher.Publish(ctx, msg)).To(Succeed())
+			Expect(path).To(Equal("/v2/events"))
+		})
+	})
+
+	Context("with a token source", func() {
+		var tokens []string
+
+		BeforeEach(func() {
+			tokens = nil
+			server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tokens = append(tokens, r.Header.Get("Authorization"))
+				w.WriteHeader(http.StatusAccepted)
+			})
+		})
+
+		It("sends a bearer token", func() {
+			p, err := NewHTTPPublisher(cfg, WithTokenSource(StaticTokenSource("abc")))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(p.Publish(ctx, msg)).To(Succeed())
+			Expect(tokens).To(Equal([]string{"Bearer abc"}))
+		})
+
+		It("fails when the token source fails", func() {
+			cfg.HTTPMaxRetries = 0
+			p, err := NewHTTPPublisher(cfg, WithTokenSource(tokenSourceFunc(func(context.Context) (string, error) {
+				return "", errors.New("token service down")
+			})))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(p.Publish(ctx, msg)).To(MatchError(ContainSubstring("token service down")))
+			Expect(tokens).To(BeEmpty())
+		})
+	})
+
+	Context("with a signing secret", func() {
+		var (
+			now      time.Time
+			verifier RequestVerifier
+			received []byte
+		)
+
+		BeforeEach(func() {
+			now = time.Now()
+			received = nil
+			cfg.HTTPSigningSecret = "s3cret"
+			cfg.HTTPMaxRetries = 0
+			verifier = RequestVerifier{Secret: []byte("s3cret"), Now: func() time.Time { return now }}
+			server.Config.Handler = verifier.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var err error
+				received, err = io.ReadAll(r.Body)
+				Expect(err).NotTo(HaveOccurred())
+				w.WriteHeader(http.StatusAccepted)
+			}))
+		})
+
+		It("signs requests the verifier accepts", func() {
+			Expect(publisher.Publish(ctx, msg)).To(Succeed())
+			Expect(received).To(Equal(msg.Payload))
+		})
+
+		It("is rejected with the wrong secret", func() {
+			verifier.Secret = []byte("other")
+			server.Config.Handler = verifier.Middleware(http.NotFoundHandler())
+
+			Expect(publisher.Publish(ctx, msg)).To(MatchError(ContainSubstring("status 401")))
+		})
+
+		It("covers the idempotency key, method and path", func() {
+			var signed *http.Request
+			server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				signed = r.Clone(context.Background())
+				w.WriteHeader(http.StatusAccepted)
+			})
+			Expect(publisher.Publish(ctx, msg)).To(Succeed())
+
+			replay := func(method, path, key string) error {
+				req := httptest.NewRequest(method, path, bytes.NewReader(msg.Payload))
+				req.Header = signed.Header.Clone()
+				req.Header.Set(IdempotencyKeyHeader, key)
+				_, err := verifier.Verify(req)
+				return err
+			}
+			Expect(replay(http.MethodPost, signed.URL.Path, msg.EventID)).To(Succeed())
+			Expect(replay(http.MethodPost, signed.URL.Path, uuid.NewString())).To(MatchError(ErrInvalidSignature))
+			Expect(replay(http.MethodPut, signed.URL.Path, msg.EventID)).To(MatchError(ErrInvalidSignature))
+			Expect(replay(http.MethodPost, "/other", msg.EventID)).To(MatchError(ErrInvalidSignature))
+		})
+
+		It("is rejected outside the tolerance", func() {
+			p, err := NewHTTPPublisher(cfg, WithTimeNow(func() time.Time { return now.Add(-10 * time.Minute) }))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(p.Publish(ctx, msg)).To(MatchError(ContainSubstring("status 401")))
+		})
+	})
+
+	Describe("RequestVerifier", func() {
+		var verifier RequestVerifier
+
+		BeforeEach(func() {
+			verifier = RequestVerifier{Secret: []byte("s3cret")}
+		})
+
+		It("rejects unsigned requests", func() {
+			req := httptest.NewRequest(http.MethodPost, "/api/auditlog", strings.NewReader(`{}`))
+			_, err := verifier.Verify(req)
+			Expect(err).To(MatchError(ErrMissingSignature))
+		})
+
+		It("rejects tampered bodies", func() {
+			req := httptest.NewRequest(http.MethodPost, "/api/auditlog", strings.NewReader(`{"a":1}`))
+			req.Header.Set(TimestampHeader, "1700000000")
+			req.Header.Set(SignatureHeader, "v1=00")
+			_, err := verifier.Verify(req)
+			Expect(err).To(MatchError(ErrInvalidSignature))
+		})
+
+		It("rejects oversized bodies", func() {
+			verifier.MaxBodyBytes = 2
+			req := httptest.NewRequest(http.MethodPost, "/api/auditlog", strings.NewReader(`{"a":1}`))
+			req.Header.Set(TimestampHeader, "1700000000")
+			req.Header.Set(SignatureHeader, "v1=00")
+			_, err := verifier.Verify(req)
+			Expect(err).To(MatchError(ContainSubstring("exceeds 2 bytes")))
+		})
+	})
+
+	Context("with mTLS", func() {
+		var tlsServer *httptest.Server
+
+		BeforeEach(func() {
+			caPEM, err := os.ReadFile("../transport/testdata/ca.crt")
+			Expect(err).NotTo(HaveOccurred())
+			clientCAs := x509.NewCertPool()
+			Expect(clientCAs.AppendCertsFromPEM(caPEM)).To(BeTrue())
+
+			tlsServer = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.TLS.PeerCertificates).NotTo(BeEmpty())
+				w.WriteHeader(http.StatusAccepted)
+			}))
+			tlsServer.TLS = &tls.Config{
+				ClientAuth: tls.RequireAndVerifyClientCert,
+				ClientCAs:  clientCAs,
+				MinVersion: tls.VersionTLS12,
+			}
+			tlsServer.StartTLS()
+			DeferCleanup(tlsServer.Close)
+
+			rootCA := filepath.Join(GinkgoT().TempDir(), "server-ca.crt")
+			serverPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tlsServer.Certificate().Raw})
+			Expect(os.WriteFile(rootCA, serverPEM, 0o600)).To(Succeed())
+
+			cfg.HTTPMaxRetries = 0
+			cfg.HTTPTLSRootCA = rootCA
+		})
+
+		It("presents the client certificate", func() {
+			cfg.HTTPTLSCert = "../transport/testdata/pub.crt"
+			cfg.HTTPTLSKey = "../transport/testdata/priv.key"
+			cfg.AuditLoggerURL = tlsServer.URL
+			p, err := NewHTTPPublisher(cfg)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(p.Publish(ctx, msg)).To(Succeed())
+		})
+
+		It("fails without a client certificate", func() {
+			cfg.AuditLoggerURL = tlsServer.URL
+			p, err := NewHTTPPublisher(cfg)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(p.Publish(ctx, msg)).NotTo(Succeed())
+		})
+
+		It("rejects clients with a custom transport", func() {
+			cfg.AuditLoggerURL = tlsServer.URL
+			client := &http.Client{Transport: roundTripFunc(func(*http.Request) (*http.Response, error) {
+				return nil, errors.New("unused")
+			})}
+
+			_, err := NewHTTPPublisher(cfg, WithHTTPClient(client))
+			Expect(err).To(MatchError(ContainSubstring("require an *http.Transport")))
+		})
+	})
+})
+
+type tokenSourceFunc func(ctx context.Context) (string, error)
+
+func (f tokenSourceFunc) Token(ctx context.Context) (string, error) {
+	return f(ctx)
+}
@@ -0,0 +1,274 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nojyerac/go-lib/db"
+)
+
+// Query selects audit events. Empty fields match everything.
+type Query struct {
+	ActorID string
+	// Action matches exactly, or as a prefix when it ends in "*".
+	Action       string
+	ResourceType string
+	ResourceID   string
+	// Since is inclusive and Until exclusive; both compare Event.Timestamp.
+	Since time.Time
+	Until time.Time
+	// Limit caps the number of events read; 0 means no limit.
+	Limit int
+}
+
+// Match reports whether evt satisfies q, ignoring Limit.
+func (q Query) Match(evt *Event) bool {
+	if q.ActorID != "" && evt.ActorID != q.ActorID {
+		return false
+	}
+	if prefix, ok := strings.CutSuffix(q.Action, "*"); ok {
+		if !strings.HasPrefix(evt.Action, prefix) {
+			return false
+		}
+	} else if q.Action != "" && evt.Action != q.Action {
+		return false
+	}
+	if q.ResourceType != "" && evt.ResourceType != q.ResourceType {
+		return false
+	}
+	if q.ResourceID != "" && evt.ResourceID != q.ResourceID {
+		return false
+	}
+	if !q.Since.IsZero() && evt.Timestamp.Before(q.Since) {
+		return false
+	}
+	return q.Until.IsZero() || evt.Timestamp.Before(q.Until)
+}
+
+// Record is an event read back from a store together with its stored JSON,
+// which is what Replay publishes so hashes and signatures stay valid.
+type Record struct {
+	Event
+	Payload json.RawMessage
+}
+
+// EventReader reads stored audit events.
+type EventReader interface {
+	// Read calls fn for every event matching q, in storage order, until the
+	// events or q.Limit run out. An error from fn stops the read and is
+	// returned.
+	Read(ctx context.Context, q Query, fn func(Record) error) error
+}
+
+// NewFileReader returns an EventReader over audit files written by the file
+// or stdout loggers, read in the order given. Files ending in ".gz" are
+// decompressed, so rotated files can be read directly.
+func NewFileReader(paths ...string) EventReader {
+	return fileReader(paths)
+}
+
+type fileReader []string
+
+func (paths fileReader) Read(ctx context.Context, q Query, fn func(Record) error) error {
+	read := 0
+	for _, path := range paths {
+		done, err := readFile(ctx, path, q, &read, fn)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if done {
+			return nil
+		}
+	}
+	return nil
+}
+
+// OpenFile opens an audit file written by the file logger for reading, e.g.
+// by VerifyChain, decompressing it when its name ends in .gz as rotated files
+// do.
+func OpenFile(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path) //nolint:gosec // reading operator-supplied audit files is the point
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return f, nil
+	}
+	zr, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return gzipFileReader{Reader: zr, file: f}, nil
+}
+
+type gzipFileReader struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (r gzipFileReader) Close() error {
+	return errors.Join(r.Reader.Close(), r.file.Close())
+}
+
+// readFile reports done once q.Limit events have been read.
+func readFile(ctx context.Context, path string, q Query, read *int, fn func(Record) error) (done bool, err error) {
+	in, err := OpenFile(path)
+	if err != nil {
+		return false, err
+	}
+	defer in.Close()
+
+	dec := json.NewDecoder(in)
+	for record := 1; ; record++ {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				return false, nil
+			}
+			return false, fmt.Errorf("read record %d: %w", record, err)
+		}
+		rec, err := decodeRecord(raw)
+		if err != nil {
+			return false, fmt.Errorf("read record %d: %w", record, err)
+		}
+		if !q.Match(&rec.Event) {
+			continue
+		}
+		if err := fn(rec); err != nil {
+			return false, err
+		}
+		*read++
+		if q.Limit > 0 && *read >= q.Limit {
+			return true, nil
+		}
+	}
+}
+
+func decodeRecord(raw []byte) (Record, error) {
+	var rec Record
+	if err := json.Unmarshal(raw, &rec.Event); err != nil {
+		return Record{}, err
+	}
+	// the stdout logger indents its output; store the compact form
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, raw); err != nil {
+		return Record{}, err
+	}
+	rec.Payload = compact.Bytes()
+	return rec, nil
+}
+
+// NewOutboxReader returns an EventReader over OutboxTable or DeadLetterTable.
+// Filters are evaluated by PostgreSQL against the JSONB payload; rows are read
+// in insertion order.
+func NewOutboxReader(database db.DataInterface, table string) (EventReader, error) {
+	if table != OutboxTable && table != DeadLetterTable {
+		return nil, fmt.Errorf("unsupported audit table %q", table)
+	}
+	return &outboxReader{database: database, table: table}, nil
+}
+
+type outboxReader struct {
+	database db.DataInterface
+	table    string
+}
+
+func (r *outboxReader) Read(ctx context.Context, q Query, fn func(Record) error) error {
+	query, args := r.sql(q)
+	rows, err := r.database.Query(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var payload []byte
+		if err := rows.Scan(&payload); err != nil {
+			return err
+		}
+		rec, err := decodeRecord(payload)
+		if err != nil {
+			return err
+		}
+		if !q.Match(&rec.Event) {
+			continue
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func (r *outboxReader) sql(q Query) (string, []any) {
+	var (
+		where []string
+		args  []any
+	)
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+	if q.ActorID != "" {
+		add("payload->>'actorID' = $%d", q.ActorID)
+	}
+	if prefix, ok := strings.CutSuffix(q.Action, "*"); ok {
+		add("payload->>'action' LIKE $%d", likeEscaper.Replace(prefix)+"%")
+	} else if q.Action != "" {
+		add("payload->>'action' = $%d", q.Action)
+	}
+	if q.ResourceType != "" {
+		add("payload->>'resourceType' = $%d", q.ResourceType)
+	}
+	if q.ResourceID != "" {
+		add("payload->>'resourceID' = $%d", q.ResourceID)
+	}
+	if !q.Since.IsZero() {
+		add("(payload->>'timestamp')::timestamptz >= $%d", q.Since)
+	}
+	if !q.Until.IsZero() {
+		add("(payload->>'timestamp')::timestamptz < $%d", q.Until)
+	}
+
+	query := "SELECT payload FROM " + r.table //nolint:gosec // table is checked by NewOutboxReader
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id"
+	if q.Limit > 0 {
+		args = append(args, q.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	return query, args
+}
+
+// Replay publishes the stored payload of every event matching q and returns
+// the number published. It stops at the first publish error; since each
+// message keeps its event ID, running it again is safe for sinks that
+// deduplicate on it.
+func Replay(ctx context.Context, reader EventReader, q Query, publisher Publisher) (int, error) {
+	published := 0
+	err := reader.Read(ctx, q, func(rec Record) error {
+		if err := publisher.Publish(ctx, Message{EventID: rec.EventID, Payload: rec.Payload}); err != nil {
+			return fmt.Errorf("publish event %s: %w", rec.EventID, err)
+		}
+		published++
+		return nil
+	})
+	return published, err
+}
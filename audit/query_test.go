@@ -0,0 +1,216 @@
+package audit_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	. "github.com/nojyerac/go-lib/audit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Query and replay", func() {
+	var (
+		ctx   context.Context
+		alice = uuid.NewString()
+		bob   = uuid.NewString()
+		start = time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC)
+	)
+
+	// writeEvents logs one event per minute from start with the stdout logger
+	// and returns its output.
+	writeEvents := func(entries ...[3]string) []byte {
+		var out bytes.Buffer
+		minute := 0
+		cfg := NewConfiguration()
+		cfg.AuditLoggerType = "stdout"
+		logger, err := NewAuditLogger(cfg, WithOutput(&out), WithTimeNow(func() time.Time {
+			minute++
+			return start.Add(time.Duration(minute-1) * time.Minute)
+		}))
+		Expect(err).NotTo(HaveOccurred())
+		for _, e := range entries {
+			evtCtx := WithResource(ctx, "document", e[2])
+			Expect(logger.Log(evtCtx, e[0], e[1], map[string]any{"n": 1})).To(Succeed())
+		}
+		return out.Bytes()
+	}
+
+	collect := func(reader EventReader, q Query) []Record {
+		var records []Record
+		Expect(reader.Read(ctx, q, func(rec Record) error {
+			records = append(records, rec)
+			return nil
+		})).To(Succeed())
+		return records
+	}
+
+	actions := func(records []Record) []string {
+		out := make([]string, len(records))
+		for i, rec := range records {
+			out[i] = rec.Action
+		}
+		return out
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+	})
+
+	Describe("NewFileReader", func() {
+		var paths []string
+
+		BeforeEach(func() {
+			dir := GinkgoT().TempDir()
+			rotated := filepath.Join(dir, "audit.log.20260102T030000.000000000.gz")
+			current := filepath.Join(dir, "audit.log")
+
+			var gz bytes.Buffer
+			zw := gzip.NewWriter(&gz)
+			_, err := zw.Write(writeEvents(
+				[3]string{alice, "document.create", "d1"},
+				[3]string{bob, "document.read", "d1"},
+			))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(zw.Close()).To(Succeed())
+			Expect(os.WriteFile(rotated, gz.Bytes(), 0o600)).To(Succeed())
+
+			start = start.Add(time.Hour)
+			Expect(os.WriteFile(current, writeEvents(
+				[3]string{alice, "document.update", "d2"},
+				[3]string{alice, "user.login", ""},
+			), 0o600)).To(Succeed())
+			start = start.Add(-time.Hour)
+
+			paths = []string{rotated, current}
+		})
+
+		It("reads gzipped and plain files in order", func() {
+			Expect(actions(collect(NewFileReader(paths...), Query{}))).To(Equal([]string{
+				"document.create", "document.read", "document.update", "user.login",
+			}))
+		})
+
+		DescribeTable("filters events",
+			func(q func() Query, expected []string) {
+				Expect(actions(collect(NewFileReader(paths...), q()))).To(Equal(expected))
+			},
+			Entry("by actor", func() Query { return Query{ActorID: alice} },
+				[]string{"document.create", "document.update", "user.login"}),
+			Entry("by action prefix", func() Query { return Query{Action: "document.*"} },
+				[]string{"document.create", "document.read", "document.update"}),
+			Entry("by exact action", func() Query { return Query{Action: "document"} }, []string{}),
+			Entry("by resource", func() Query { return Query{ResourceType: "document", ResourceID: "d1"} },
+				[]string{"document.create", "document.read"}),
+			Entry("by time range", func() Query {
+				return Query{Since: start.Add(time.Minute), Until: start.Add(time.Hour + time.Minute)}
+			}, []string{"document.read", "document.update"}),
+			Entry("with a limit across files", func() Query { return Query{ActorID: alice, Limit: 2} },
+				[]string{"document.create", "document.update"}),
+		)
+
+		It("keeps the stored payload", func() {
+			records := collect(NewFileReader(paths[1]), Query{Limit: 1})
+			Expect(records).To(HaveLen(1))
+			Expect(json.Valid(records[0].Payload)).To(BeTrue())
+			Expect(bytes.Contains(records[0].Payload, []byte("\n"))).To(BeFalse())
+			Expect(string(records[0].Payload)).To(ContainSubstring(records[0].EventID))
+		})
+
+		It("reports the file and record of malformed input", func() {
+			bad := filepath.Join(GinkgoT().TempDir(), "bad.log")
+			Expect(os.WriteFile(bad, []byte(`{"action":`), 0o600)).To(Succeed())
+
+			err := NewFileReader(bad).Read(ctx, Query{}, func(Record) error { return nil })
+			Expect(err).To(MatchError(ContainSubstring("bad.log: read record 1")))
+		})
+	})
+
+	Describe("NewOutboxReader", func() {
+		It("rejects other tables", func() {
+			_, err := NewOutboxReader(nil, "users")
+			Expect(err).To(MatchError(ContainSubstring(`unsupported audit table "users"`)))
+		})
+
+		It("filters in SQL", func() {
+			database, sqlMock := openMockDatabase(ctx)
+			var compact bytes.Buffer
+			Expect(json.Compact(&compact, writeEvents([3]string{alice, "document_create", "d1"}))).To(Succeed())
+
+			since := start.Add(-time.Minute)
+			sqlMock.ExpectQuery(`SELECT payload FROM audit_outbox_dlq WHERE payload->>'actorID' = \$1 `+
+				`AND payload->>'action' LIKE \$2 AND payload->>'resourceType' = \$3 `+
+				`AND \(payload->>'timestamp'\)::timestamptz >= \$4 ORDER BY id LIMIT \$5`).
+				WithArgs(alice, `document\_%`, "document", since, 5).
+				WillReturnRows(sqlmock.NewRows([]string{"payload"}).AddRow(compact.Bytes()))
+
+			reader, err := NewOutboxReader(database, DeadLetterTable)
+			Expect(err).NotTo(HaveOccurred())
+			q := Query{ActorID: alice, Action: "document_*", ResourceType: "document", Since: since, Limit: 5}
+			Expect(actions(collect(reader, q))).To(Equal([]string{"document_create"}))
+		})
+
+		It("returns matching rows", func() {
+			database, sqlMock := openMockDatabase(ctx)
+			var compact bytes.Buffer
+			Expect(json.Compact(&compact, writeEvents([3]string{bob, "document.read", "d1"}))).To(Succeed())
+
+			sqlMock.ExpectQuery(`SELECT payload FROM audit_outbox ORDER BY id`).
+				WillReturnRows(sqlmock.NewRows([]string{"payload"}).AddRow(compact.Bytes()))
+
+			reader, err := NewOutboxReader(database, OutboxTable)
+			Expect(err).NotTo(HaveOccurred())
+			records := collect(reader, Query{})
+			Expect(records).To(HaveLen(1))
+			Expect(records[0].ActorID).To(Equal(bob))
+			Expect(records[0].Payload).To(MatchJSON(compact.Bytes()))
+		})
+	})
+
+	Describe("Replay", func() {
+		var path string
+
+		BeforeEach(func() {
+			path = filepath.Join(GinkgoT().TempDir(), "audit.log")
+			Expect(os.WriteFile(path, writeEvents(
+				[3]string{alice, "document.create", "d1"},
+				[3]string{bob, "document.read", "d1"},
+				[3]string{alice, "document.update", "d1"},
+			), 0o600)).To(Succeed())
+		})
+
+		It("publishes the stored payloads of matching events", func() {
+			var messages []Message
+			n, err := Replay(ctx, NewFileReader(path), Query{ActorID: alice}, publisherFunc(
+				func(_ context.Context, msg Message) error {
+					messages = append(messages, msg)
+					return nil
+				},
+			))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(n).To(Equal(2))
+			Expect(messages).To(HaveLen(2))
+
+			var evt Event
+			Expect(json.Unmarshal(messages[1].Payload, &evt)).To(Succeed())
+			Expect(evt.EventID).To(Equal(messages[1].EventID))
+			Expect(evt.Action).To(Equal("document.update"))
+		})
+
+		It("stops at the first publish error", func() {
+			n, err := Replay(ctx, NewFileReader(path), Query{}, publisherFunc(
+				func(context.Context, Message) error { return errors.New("sink down") },
+			))
+			Expect(err).To(MatchError(ContainSubstring("sink down")))
+			Expect(n).To(BeZero())
+		})
+	})
+})
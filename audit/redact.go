@@ -0,0 +1,248 @@
+package audit
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// RedactedValue replaces values removed by a masking RedactionRule.
+const RedactedValue = "[REDACTED]"
+
+// TokenPrefix starts every value produced by a tokenizing RedactionRule.
+const TokenPrefix = "hmac:"
+
+var (
+	// EmailPattern matches email addresses.
+	EmailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	// CardNumberPattern matches 13 to 19 digit payment card numbers, optionally
+	// grouped with spaces or dashes.
+	CardNumberPattern = regexp.MustCompile(`\b\d(?:[ \-]?\d){12,18}\b`)
+)
+
+// RedactionRule removes sensitive data from event details before they are
+// written. A rule matches values by key name (Keys, at any depth, case
+// insensitive), by dotted path from the details root (Paths, where a "*"
+// segment matches any key), or by content (Pattern, applied to string values,
+// replacing only the matched text). Slice indexes in a path are optional:
+// "cards.number" and "cards.*.number" both match the number of every element
+// of cards, in Log details and in LogChange diff paths alike.
+//
+// Matches are masked with RedactedValue unless TokenKey is set, in which case
+// they are replaced with a keyed HMAC-SHA256 token so equal values remain
+// correlatable across events without being readable.
+type RedactionRule struct {
+	// Name labels the rule in the audit_redactions counter.
+	Name     string
+	Keys     []string
+	Paths    []string
+	Pattern  *regexp.Regexp
+	TokenKey []byte
+}
+
+func (r *RedactionRule) matchesKey(keys, path []string) bool {
+	for _, k := range r.Keys {
+		for _, key := range keys {
+			if strings.EqualFold(k, key) {
+				return true
+			}
+		}
+	}
+	if len(r.Paths) == 0 {
+		return false
+	}
+	unindexed := withoutIndexes(path)
+	for _, p := range r.Paths {
+		pattern := strings.Split(p, ".")
+		if matchPathPrefix(pattern, path) || matchPathPrefix(pattern, unindexed) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPathPrefix reports whether pattern matches path or one of its parents:
+// a path also covers everything below it, which matters for the flattened
+// paths LogChange produces.
+func matchPathPrefix(pattern, path []string) bool {
+	return len(path) >= len(pattern) && matchPath(pattern, path[:len(pattern)])
+}
+
+// withoutIndexes drops the numeric segments slices contribute to a path.
+func withoutIndexes(path []string) []string {
+	out := make([]string, 0, len(path))
+	for _, segment := range path {
+		if _, err := strconv.Atoi(segment); err != nil {
+			out = append(out, segment)
+		}
+	}
+	return out
+}
+
+func matchPath(pattern, path []string) bool {
+	if len(pattern) != len(path) {
+		return false
+	}
+	for i, segment := range pattern {
+		if segment != "*" && segment != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *RedactionRule) replace(value string) string {
+	if len(r.TokenKey) == 0 {
+		return RedactedValue
+	}
+	mac := hmac.New(sha256.New, r.TokenKey)
+	mac.Write([]byte(value))
+	return TokenPrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// redactor applies an ordered list of rules to event details.
+type redactor struct {
+	rules []RedactionRule
+}
+
+func newRedactor(rules []RedactionRule) *redactor {
+	if len(rules) == 0 {
+		return nil
+	}
+	named := make([]RedactionRule, len(rules))
+	for i, rule := range rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule-%d", i)
+		}
+		named[i] = rule
+	}
+	return &redactor{rules: named}
+}
+
+// apply returns a redacted copy of details; the caller's map is not modified.
+func (r *redactor) apply(ctx context.Context, details map[string]any) map[string]any {
+	if r == nil || details == nil {
+		return details
+	}
+	out, _ := r.value(ctx, nil, details).(map[string]any)
+	return out
+}
+
+func (r *redactor) value(ctx context.Context, path []string, v any) any {
+	switch val := v.(type) {
+	case nil, bool, float32, float64, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return val
+	case string:
+		return r.text(ctx, val)
+	case map[string]any:
+		out := make(map[string]any, len(val))
+		for key, child := range val {
+			// LogChange keys are dotted paths; match them segment by segment
+			segments := strings.Split(key, ".")
+			childPath := append(path[:len(path):len(path)], segments...)
+			if rule := r.keyRule(segments, childPath); rule != nil {
+				out[key] = r.redactValue(ctx, rule, child)
+				continue
+			}
+			out[key] = r.value(ctx, childPath, child)
+		}
+		return out
+	case []any:
+		out := make([]any, len(val))
+		for i, child := range val {
+			// index segments match LogChange, which flattens slices the same way
+			out[i] = r.value(ctx, append(path[:len(path):len(path)], strconv.Itoa(i)), child)
+		}
+		return out
+	case change:
+		return change{
+			OldValue: r.value(ctx, path, val.OldValue),
+			NewValue: r.value(ctx, path, val.NewValue),
+		}
+	default:
+		// Structs, typed maps and slices are normalized through JSON so their
+		// fields are visited the same way they will be serialized.
+		normalized, ok := normalizeJSON(val)
+		if !ok {
+			return val
+		}
+		return r.value(ctx, path, normalized)
+	}
+}
+
+func (r *redactor) keyRule(keys, path []string) *RedactionRule {
+	for i := range r.rules {
+		if r.rules[i].matchesKey(keys, path) {
+			return &r.rules[i]
+		}
+	}
+	return nil
+}
+
+func (r *redactor) redactValue(ctx context.Context, rule *RedactionRule, v any) any {
+	if c, ok := v.(change); ok {
+		// keep the shape of a change so consumers can still see which side moved
+		out := change{}
+		if c.OldValue != nil {
+			out.OldValue = r.redactValue(ctx, rule, c.OldValue)
+		}
+		if c.NewValue != nil {
+			out.NewValue = r.redactValue(ctx, rule, c.NewValue)
+		}
+		return out
+	}
+	countRedaction(ctx, rule.Name)
+	if s, ok := v.(string); ok {
+		return rule.replace(s)
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return RedactedValue
+	}
+	return rule.replace(string(raw))
+}
+
+func (r *redactor) text(ctx context.Context, s string) string {
+	for i := range r.rules {
+		rule := &r.rules[i]
+		if rule.Pattern == nil {
+			continue
+		}
+		s = rule.Pattern.ReplaceAllStringFunc(s, func(match string) string {
+			countRedaction(ctx, rule.Name)
+			return rule.replace(match)
+		})
+	}
+	return s
+}
+
+func normalizeJSON(v any) (any, bool) {
+	switch reflect.Indirect(reflect.ValueOf(v)).Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+	default:
+		return nil, false
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, false
+	}
+	var out any
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, false
+	}
+	return out, true
+}
+
+func countRedaction(ctx context.Context, rule string) {
+	redactionMetrics().Add(ctx, 1, metric.WithAttributes(attribute.String("rule", rule)))
+}
@@ -0,0 +1,235 @@
+package audit_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+
+	"github.com/google/uuid"
+	. "github.com/nojyerac/go-lib/audit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+var (
+	metricReader     *sdkmetric.ManualReader
+	initMetricReader sync.Once
+)
+
+// useMetricReader installs a global meter provider backed by metricReader.
+func useMetricReader() {
+	initMetricReader.Do(func() {
+		metricReader = sdkmetric.NewManualReader()
+		otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(metricReader)))
+	})
+}
+
+// collectCounter returns the data points recorded for an int64 counter by the
+// global meter provider.
+func collectCounter(name string) []metricdata.DataPoint[int64] {
+	var rm metricdata.ResourceMetrics
+	Expect(metricReader.Collect(context.Background(), &rm)).To(Succeed())
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name == name {
+				sum, ok := m.Data.(metricdata.Sum[int64])
+				Expect(ok).To(BeTrue())
+				return sum.DataPoints
+			}
+		}
+	}
+	return nil
+}
+
+func counterValue(name, attrKey, attrValue string) int64 {
+	for _, dp := range collectCounter(name) {
+		if v, ok := dp.Attributes.Value(attribute.Key(attrKey)); ok && v.AsString() == attrValue {
+			return dp.Value
+		}
+	}
+	return 0
+}
+
+var _ = Describe("Redaction", func() {
+	var (
+		out     bytes.Buffer
+		rules   []RedactionRule
+		logger  AuditLogger
+		actorID = uuid.NewString()
+	)
+
+	BeforeEach(func() {
+		useMetricReader()
+		out.Reset()
+		rules = nil
+	})
+
+	JustBeforeEach(func() {
+		cfg := NewConfiguration()
+		cfg.AuditLoggerType = "stdout"
+		var err error
+		logger, err = NewAuditLogger(cfg, WithOutput(&out), WithTimeNow(timeNow), WithRedaction(rules...))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	details := func() map[string]any {
+		var evt map[string]any
+		Expect(json.Unmarshal(out.Bytes(), &evt)).To(Succeed())
+		d, ok := evt["details"].(map[string]any)
+		Expect(ok).To(BeTrue())
+		return d
+	}
+
+	Context("with key, path and pattern rules", func() {
+		BeforeEach(func() {
+			rules = []RedactionRule{
+				{Name: "secrets", Keys: []string{"password", "SSN"}},
+				{Name: "address", Paths: []string{"profile.address", "contacts.*.phone"}},
+				{Name: "email", Pattern: EmailPattern},
+				{Name: "card", Pattern: CardNumberPattern},
+			}
+		})
+
+		It("redacts matching values at any depth", func() {
+			before := counterValue("audit_redactions", "rule", "email")
+			input := map[string]any{
+				"password": "hunter2",
+				"profile": map[string]any{
+					"ssn":     "123-45-6789",
+					"address": map[string]any{"city": "Paris"},
+					"name":    "Ada",
+				},
+				"contacts": map[string]any{
+					"home": map[string]any{"phone": "555-0100", "label": "home"},
+				},
+				"note": "contact ada@example.com or bob@example.org, card 4111 1111 1111 1111",
+				"tags": []any{"x@example.com", 3},
+			}
+
+			Expect(logger.Log(context.Background(), actorID, "user.update", input)).To(Succeed())
+
+			Expect(details()).To(Equal(map[string]any{
+				"password": RedactedValue,
+				"profile": map[string]any{
+					"ssn":     RedactedValue,
+					"address": RedactedValue,
+					"name":    "Ada",
+				},
+				"contacts": map[string]any{
+					"home": map[string]any{"phone": RedactedValue, "label": "home"},
+				},
+				"note": "contact [REDACTED] or [REDACTED], card [REDACTED]",
+				"tags": []any{RedactedValue, float64(3)},
+			}))
+			Expect(input["password"]).To(Equal("hunter2"), "caller's details must not be modified")
+			Expect(counterValue("audit_redactions", "rule", "email") - before).To(Equal(int64(3)))
+		})
+
+		It("redacts both sides of a change", func() {
+			Expect(logger.LogChange(context.Background(), actorID, "user.update",
+				map[string]any{"password": "old", "email": "a@example.com"},
+				map[string]any{"password": "new", "email": "b@example.com"},
+			)).To(Succeed())
+
+			Expect(details()).To(Equal(map[string]any{
+				"password": map[string]any{"old_value": RedactedValue, "new_value": RedactedValue},
+				"email":    map[string]any{"old_value": RedactedValue, "new_value": RedactedValue},
+			}))
+		})
+
+		It("visits struct values through their JSON form", func() {
+			type profile struct {
+				Password string `json:"password"`
+				Name     string `json:"name"`
+			}
+			Expect(logger.Log(context.Background(), actorID, "user.update", map[string]any{
+				"profile": profile{Password: "hunter2", Name: "Ada"},
+			})).To(Succeed())
+
+			Expect(details()).To(Equal(map[string]any{
+				"profile": map[string]any{"password": RedactedValue, "name": "Ada"},
+			}))
+		})
+	})
+
+	Context("with paths through slices", func() {
+		BeforeEach(func() {
+			rules = []RedactionRule{{Name: "cards", Paths: []string{"cards.number", "accounts.*.iban"}}}
+		})
+
+		It("matches paths through slices the same way for Log and LogChange", func() {
+			before := map[string]any{
+				"cards":    []any{map[string]any{"number": "4111", "brand": "visa"}},
+				"accounts": []any{map[string]any{"iban": "FR76 1"}},
+			}
+			after := map[string]any{
+				"cards": []any{
+					map[string]any{"number": "4222", "brand": "visa"},
+					map[string]any{"number": "5500", "brand": "mc"},
+				},
+				"accounts": []any{map[string]any{"iban": "FR76 2"}},
+			}
+
+			Expect(logger.Log(context.Background(), actorID, "user.update", after)).To(Succeed())
+			Expect(details()).To(Equal(map[string]any{
+				"cards": []any{
+					map[string]any{"number": RedactedValue, "brand": "visa"},
+					map[string]any{"number": RedactedValue, "brand": "mc"},
+				},
+				"accounts": []any{map[string]any{"iban": RedactedValue}},
+			}))
+
+			out.Reset()
+			Expect(logger.LogChange(context.Background(), actorID, "user.update", before, after)).To(Succeed())
+			Expect(details()).To(Equal(map[string]any{
+				"cards.0.number":  map[string]any{"old_value": RedactedValue, "new_value": RedactedValue},
+				"cards.1":         map[string]any{"new_value": map[string]any{"number": RedactedValue, "brand": "mc"}},
+				"accounts.0.iban": map[string]any{"old_value": RedactedValue, "new_value": RedactedValue},
+			}))
+		})
+	})
+
+	Context("with a tokenization key", func() {
+		key := []byte("token-key")
+
+		BeforeEach(func() {
+			rules = []RedactionRule{{Name: "tokenize", Keys: []string{"email"}, TokenKey: key}}
+		})
+
+		It("replaces values with a stable keyed token", func() {
+			mac := hmac.New(sha256.New, key)
+			mac.Write([]byte("ada@example.com"))
+			token := TokenPrefix + hex.EncodeToString(mac.Sum(nil))
+
+			Expect(logger.Log(context.Background(), actorID, "user.update",
+				map[string]any{"email": "ada@example.com"})).To(Succeed())
+			Expect(details()).To(HaveKeyWithValue("email", token))
+		})
+	})
+
+	Context("with a payload limit", func() {
+		BeforeEach(func() {
+			rules = []RedactionRule{{Keys: []string{"blob"}}}
+		})
+
+		It("redacts before checking the payload size", func() {
+			cfg := NewConfiguration()
+			cfg.AuditLoggerType = "stdout"
+			cfg.MaxPayloadBytes = 24
+			l, err := NewAuditLogger(cfg, WithOutput(&out), WithRedaction(rules...))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(l.Log(context.Background(), actorID, "user.update",
+				map[string]any{"blob": "0123456789012345678901234567890123456789"})).To(Succeed())
+			Expect(counterValue("audit_redactions", "rule", "rule-0")).To(BeNumerically(">", 0))
+		})
+	})
+})
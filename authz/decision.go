@@ -0,0 +1,105 @@
+package authz
+
+import (
+	"context"
+
+	"github.com/nojyerac/go-lib/audit"
+	"github.com/nojyerac/go-lib/auth"
+	"github.com/nojyerac/go-lib/log"
+)
+
+// DecisionAuditAction is the audit action used for authorization decisions.
+const DecisionAuditAction = "authz.decision"
+
+const (
+	OutcomeAllow      = "allow"
+	OutcomeDeny       = "deny"
+	OutcomeShadowDeny = "shadow_deny"
+)
+
+// Decision is the result of enforcing a matched policy.
+type Decision struct {
+	Match  Match
+	Claims *auth.Claims
+	// Err is the enforcement error; nil means the request was allowed.
+	Err error
+	// Shadow is set when Err was recorded but not enforced.
+	Shadow bool
+}
+
+func (d Decision) Outcome() string {
+	switch {
+	case d.Err == nil:
+		return OutcomeAllow
+	case d.Shadow:
+		return OutcomeShadowDeny
+	default:
+		return OutcomeDeny
+	}
+}
+
+// DecisionAuditor sends authorization decisions to an audit logger. Denials
+// are always recorded; allows are recorded only for sensitive operations.
+type DecisionAuditor struct {
+	logger    audit.AuditLogger
+	sensitive PolicyMap
+}
+
+// NewDecisionAuditor returns an auditor that records allows for operations
+// matching any of sensitiveOperations. Keys use the PolicyMap syntax, so HTTP
+// templates and gRPC wildcards are supported.
+func NewDecisionAuditor(logger audit.AuditLogger, sensitiveOperations ...string) *DecisionAuditor {
+	sensitive := NewPolicyMap()
+	sensitive.SetAll(Requirement{}, sensitiveOperations...)
+	return &DecisionAuditor{
+		logger:    logger,
+		sensitive: sensitive,
+	}
+}
+
+// Record emits an audit event for decision when it is a denial or concerns a
+// sensitive operation. Audit failures are logged and never affect the
+// decision.
+func (d *DecisionAuditor) Record(ctx context.Context, decision Decision) {
+	if d == nil || d.logger == nil {
+		return
+	}
+	if decision.Err == nil {
+		if _, sensitive := d.sensitive.Match(decision.Match.Operation); !sensitive {
+			return
+		}
+	}
+
+	subject := ""
+	if decision.Claims != nil {
+		subject = decision.Claims.Subject
+	}
+	details := map[string]any{
+		"subject":     subject,
+		"operation":   decision.Match.Operation,
+		"pattern":     decision.Match.Pattern,
+		"requirement": decision.Match.Requirement,
+		"outcome":     decision.Outcome(),
+	}
+	if decision.Err != nil {
+		details["reason"] = decision.Err.Error()
+	}
+
+	envelopeOutcome := audit.OutcomeSuccess
+	if decision.Err != nil && !decision.Shadow {
+		envelopeOutcome = audit.OutcomeDenied
+	}
+	ctx = audit.WithOutcome(ctx, envelopeOutcome)
+	if subject != "" {
+		// the claims are not on ctx yet; the logger derives the actor type from them
+		ctx = auth.WithClaims(ctx, decision.Claims)
+	} else {
+		// missing or invalid tokens are the denials most worth keeping
+		ctx = audit.WithActor(ctx, audit.Actor{Type: audit.ActorAnonymous})
+	}
+
+	if err := d.logger.Log(ctx, subject, DecisionAuditAction, details); err != nil {
+		log.FromContext(ctx).WithError(err).WithField("operation", decision.Match.Operation).
+			Warn("failed to audit authz decision")
+	}
+}
@@ -0,0 +1,142 @@
+package authz_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/nojyerac/go-lib/audit"
+	. "github.com/nojyerac/go-lib/auth"
+	. "github.com/nojyerac/go-lib/authz"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type auditEntry struct {
+	actorID string
+	action  string
+	details map[string]any
+}
+
+type auditLoggerStub struct {
+	entries []auditEntry
+	err     error
+}
+
+func (a *auditLoggerStub) LogChange(ctx context.Context, actorID, action string, _, _ any) error {
+	return a.Log(ctx, actorID, action, nil)
+}
+
+func (a *auditLoggerStub) Log(_ context.Context, actorID, action string, details map[string]any) error {
+	a.entries = append(a.entries, auditEntry{actorID: actorID, action: action, details: details})
+	return a.err
+}
+
+var _ = Describe("DecisionAuditor", func() {
+	var (
+		ctx      context.Context
+		logger   *auditLoggerStub
+		auditor  *DecisionAuditor
+		policies PolicyMap
+		claims   *Claims
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		logger = &auditLoggerStub{}
+		auditor = NewDecisionAuditor(logger, HTTPOperation("DELETE", "/v1/flags/{id}"))
+		policies = NewPolicyMap()
+		policies.Set(HTTPOperation("GET", "/v1/flags/{id}"), RequireAny("reader"))
+		policies.Set(HTTPOperation("DELETE", "/v1/flags/{id}"), RequireAny("admin"))
+		claims = &Claims{Subject: "user-1", Roles: []string{"reader", "admin"}}
+	})
+
+	match := func(operation string) Match {
+		m, ok := policies.Match(operation)
+		Expect(ok).To(BeTrue())
+		return m
+	}
+
+	It("always records denials", func() {
+		auditor.Record(ctx, Decision{
+			Match:  match(HTTPOperation("GET", "/v1/flags/1")),
+			Claims: claims,
+			Err:    ErrPermissionDenied,
+		})
+
+		Expect(logger.entries).To(HaveLen(1))
+		entry := logger.entries[0]
+		Expect(entry.actorID).To(Equal("user-1"))
+		Expect(entry.action).To(Equal(DecisionAuditAction))
+		Expect(entry.details).To(HaveKeyWithValue("subject", "user-1"))
+		Expect(entry.details).To(HaveKeyWithValue("operation", "GET /v1/flags/1"))
+		Expect(entry.details).To(HaveKeyWithValue("pattern", "GET /v1/flags/{id}"))
+		Expect(entry.details).To(HaveKeyWithValue("requirement", RequireAny("reader")))
+		Expect(entry.details).To(HaveKeyWithValue("outcome", OutcomeDeny))
+		Expect(entry.details).To(HaveKeyWithValue("reason", ErrPermissionDenied.Error()))
+	})
+
+	It("records allows only for sensitive operations", func() {
+		auditor.Record(ctx, Decision{Match: match(HTTPOperation("GET", "/v1/flags/1")), Claims: claims})
+		Expect(logger.entries).To(BeEmpty())
+
+		auditor.Record(ctx, Decision{Match: match(HTTPOperation("DELETE", "/v1/flags/1")), Claims: claims})
+		Expect(logger.entries).To(HaveLen(1))
+		Expect(logger.entries[0].details).To(HaveKeyWithValue("outcome", OutcomeAllow))
+		Expect(logger.entries[0].details).NotTo(HaveKey("reason"))
+	})
+
+	It("marks shadow denials", func() {
+		auditor.Record(ctx, Decision{
+			Match:  match(HTTPOperation("GET", "/v1/flags/1")),
+			Err:    ErrMissingToken,
+			Shadow: true,
+		})
+
+		Expect(logger.entries).To(HaveLen(1))
+		Expect(logger.entries[0].actorID).To(BeEmpty())
+		Expect(logger.entries[0].details).To(HaveKeyWithValue("outcome", OutcomeShadowDeny))
+	})
+
+	It("swallows audit failures", func() {
+		logger.err = errors.New("sink down")
+
+		Expect(func() {
+			auditor.Record(ctx, Decision{Match: match(HTTPOperation("GET", "/v1/flags/1")), Err: ErrPermissionDenied})
+		}).NotTo(Panic())
+	})
+
+	Context("with a real audit logger", func() {
+		var out bytes.Buffer
+
+		BeforeEach(func() {
+			out.Reset()
+			cfg := audit.NewConfiguration()
+			cfg.AuditLoggerType = "stdout"
+			l, err := audit.NewAuditLogger(cfg, audit.WithOutput(&out))
+			Expect(err).NotTo(HaveOccurred())
+			auditor = NewDecisionAuditor(l)
+		})
+
+		DescribeTable("records denials of any caller",
+			func(claims *Claims, err error, expected audit.Actor) {
+				auditor.Record(ctx, Decision{Match: match(HTTPOperation("GET", "/v1/flags/1")), Claims: claims, Err: err})
+
+				var evt audit.Event
+				Expect(json.Unmarshal(out.Bytes(), &evt)).To(Succeed())
+				Expect(*evt.Actor).To(Equal(expected))
+				Expect(evt.Outcome).To(Equal(audit.OutcomeDenied))
+			},
+			Entry("without a token", nil, ErrMissingToken, audit.Actor{Type: audit.ActorAnonymous}),
+			Entry("with an empty subject", &Claims{}, ErrPermissionDenied, audit.Actor{Type: audit.ActorAnonymous}),
+			Entry("with a client ID subject", &Claims{Subject: "billing-api"}, ErrPermissionDenied,
+				audit.Actor{Type: audit.ActorService, ID: "billing-api"}),
+		)
+	})
+
+	It("is a no-op when nil", func() {
+		var nilAuditor *DecisionAuditor
+		Expect(func() { nilAuditor.Record(ctx, Decision{Err: ErrPermissionDenied}) }).NotTo(Panic())
+	})
+})
@@ -3,8 +3,11 @@ package authz
 import "github.com/nojyerac/go-lib/auth"
 
 type Requirement struct {
-	AnyOf []string
-	AllOf []string
+	AnyOf []string `json:"anyOf,omitempty"`
+	AllOf []string `json:"allOf,omitempty"`
+	// Relation is only evaluated by AuthorizeContext; SatisfiedBy treats a
+	// requirement carrying one as unsatisfied.
+	Relation *RelationRequirement `json:"relation,omitempty"`
 }
 
 func RequireAny(roles ...string) Requirement {
@@ -16,14 +19,14 @@ func RequireAll(roles ...string) Requirement {
 }
 
 func (r Requirement) IsEmpty() bool {
-	return len(r.AnyOf) == 0 && len(r.AllOf) == 0
+	return len(r.AnyOf) == 0 && len(r.AllOf) == 0 && r.Relation == nil
 }
 
 func (r Requirement) SatisfiedBy(claims *auth.Claims) bool {
 	if r.IsEmpty() {
 		return true
 	}
-	if claims == nil {
+	if claims == nil || r.Relation != nil {
 		return false
 	}
 
@@ -49,6 +52,12 @@ func Authorize(claims *auth.Claims, requirement Requirement) error {
 	return auth.ErrPermissionDenied
 }
 
+// roles returns the requirement without its relationship part.
+func (r Requirement) roles() Requirement {
+	r.Relation = nil
+	return r
+}
+
 func normalizeRoles(roles []string) []string {
 	if len(roles) == 0 {
 		return nil
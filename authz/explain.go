@@ -0,0 +1,58 @@
+package authz
+
+import "github.com/nojyerac/go-lib/auth"
+
+// Explanation reports how a PolicyMap resolved an operation for a set of
+// claims. It is intended for debugging denials, not for enforcement.
+type Explanation struct {
+	Operation    string      `json:"operation"`
+	Matched      bool        `json:"matched"`
+	Pattern      string      `json:"pattern,omitempty"`
+	Score        int         `json:"score"`
+	Requirement  Requirement `json:"requirement"`
+	Allowed      bool        `json:"allowed"`
+	MissingAllOf []string    `json:"missingAllOf,omitempty"`
+	MissingAnyOf []string    `json:"missingAnyOf,omitempty"`
+	// RelationPending is set when the requirement carries a relationship
+	// check, which Explain does not evaluate; Allowed is then false even if
+	// the claims hold every role.
+	RelationPending bool `json:"relationPending,omitempty"`
+}
+
+// Explain resolves operation and reports the matched pattern, its score, and
+// which roles the claims are missing. Operations with no matching policy are
+// reported as allowed, mirroring the transport middleware.
+func (p PolicyMap) Explain(operation string, claims *auth.Claims) Explanation {
+	match, ok := p.Match(operation)
+	if !ok {
+		return Explanation{
+			Operation: normalizeOperationKey(operation),
+			Allowed:   true,
+		}
+	}
+
+	roles := match.Requirement.roles()
+	explanation := Explanation{
+		Operation:       match.Operation,
+		Matched:         true,
+		Pattern:         match.Pattern,
+		Score:           match.Score,
+		Requirement:     match.Requirement,
+		RelationPending: match.Requirement.Relation != nil,
+	}
+	if roles.SatisfiedBy(claims) {
+		explanation.Allowed = !explanation.RelationPending
+		return explanation
+	}
+
+	for _, role := range roles.AllOf {
+		if !claims.HasRole(role) {
+			explanation.MissingAllOf = append(explanation.MissingAllOf, role)
+		}
+	}
+	if len(roles.AnyOf) > 0 && !claims.HasAnyRole(roles.AnyOf...) {
+		explanation.MissingAnyOf = append([]string(nil), roles.AnyOf...)
+	}
+
+	return explanation
+}
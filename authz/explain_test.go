@@ -0,0 +1,55 @@
+package authz_test
+
+import (
+	. "github.com/nojyerac/go-lib/auth"
+	. "github.com/nojyerac/go-lib/authz"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Explain", func() {
+	var policies PolicyMap
+
+	BeforeEach(func() {
+		policies = NewPolicyMap()
+		policies.Set(HTTPOperation("GET", "/v1/flags/{id}"), RequireAny("reader", "admin"))
+		policies.Set(HTTPOperation("DELETE", "/v1/flags/{id}"), Requirement{
+			AllOf: []string{"writer", "approver"},
+			AnyOf: []string{"admin", "owner"},
+		})
+	})
+
+	It("reports unmatched operations as allowed", func() {
+		explanation := policies.Explain(HTTPOperation("GET", "/v1/other"), nil)
+
+		Expect(explanation.Matched).To(BeFalse())
+		Expect(explanation.Allowed).To(BeTrue())
+		Expect(explanation.Operation).To(Equal("GET /v1/other"))
+	})
+
+	It("reports the matched pattern and score", func() {
+		explanation := policies.Explain(HTTPOperation("GET", "/v1/flags/123"), &Claims{Roles: []string{"reader"}})
+
+		Expect(explanation.Matched).To(BeTrue())
+		Expect(explanation.Allowed).To(BeTrue())
+		Expect(explanation.Pattern).To(Equal("GET /v1/flags/{id}"))
+		Expect(explanation.Score).To(Equal(2))
+		Expect(explanation.MissingAllOf).To(BeEmpty())
+		Expect(explanation.MissingAnyOf).To(BeEmpty())
+	})
+
+	It("reports missing roles for denied claims", func() {
+		explanation := policies.Explain(HTTPOperation("DELETE", "/v1/flags/123"), &Claims{Roles: []string{"writer"}})
+
+		Expect(explanation.Allowed).To(BeFalse())
+		Expect(explanation.MissingAllOf).To(Equal([]string{"approver"}))
+		Expect(explanation.MissingAnyOf).To(Equal([]string{"admin", "owner"}))
+	})
+
+	It("reports every role as missing for nil claims", func() {
+		explanation := policies.Explain(HTTPOperation("GET", "/v1/flags/123"), nil)
+
+		Expect(explanation.Allowed).To(BeFalse())
+		Expect(explanation.MissingAnyOf).To(Equal([]string{"reader", "admin"}))
+	})
+})
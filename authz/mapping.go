@@ -7,6 +7,21 @@ import (
 
 type PolicyMap map[string]Requirement
 
+// grpcServiceScoreWeight makes service specificity dominate method
+// specificity when scoring gRPC patterns, so /pkg.Svc/* beats /pkg.*/Get.
+const grpcServiceScoreWeight = 1 << 16
+
+// Match describes the policy entry that resolved an operation.
+type Match struct {
+	Operation   string
+	Pattern     string
+	Score       int
+	Requirement Requirement
+	// Params holds the values of path parameters in an HTTP pattern, keyed by
+	// name without the {} or : decoration.
+	Params map[string]string
+}
+
 func NewPolicyMap() PolicyMap {
 	return make(PolicyMap)
 }
@@ -22,43 +37,101 @@ func (p PolicyMap) Set(operation string, requirement Requirement) {
 	p[key] = requirement
 }
 
+// SetAll stores the same requirement for each operation.
+func (p PolicyMap) SetAll(requirement Requirement, operations ...string) {
+	for _, operation := range operations {
+		p.Set(operation, requirement)
+	}
+}
+
 func (p PolicyMap) Requirement(operation string) (Requirement, bool) {
-	if p == nil {
+	match, ok := p.Match(operation)
+	if !ok {
 		return Requirement{}, false
 	}
+	return match.Requirement, true
+}
+
+// Match resolves the most specific policy entry for operation. Exact keys win
+// over templated keys; otherwise the candidate with the highest score wins.
+func (p PolicyMap) Match(operation string) (Match, bool) {
+	if p == nil {
+		return Match{}, false
+	}
 	normalizedOperation := normalizeOperationKey(operation)
-	requirement, ok := p[normalizedOperation]
-	if ok {
-		return requirement, true
+	if requirement, ok := p[normalizedOperation]; ok {
+		return Match{
+			Operation:   normalizedOperation,
+			Pattern:     normalizedOperation,
+			Score:       exactScore(normalizedOperation),
+			Requirement: requirement,
+		}, true
 	}
 
-	method, path, isHTTP := parseHTTPOperation(normalizedOperation)
-	if !isHTTP {
-		return Requirement{}, false
+	var score func(candidateOperation string) (int, bool)
+	if method, path, isHTTP := parseHTTPOperation(normalizedOperation); isHTTP {
+		score = func(candidateOperation string) (int, bool) {
+			candidateMethod, candidatePath, candidateIsHTTP := parseHTTPOperation(candidateOperation)
+			if !candidateIsHTTP || candidateMethod != method {
+				return 0, false
+			}
+			return matchHTTPPath(path, candidatePath)
+		}
+	} else if service, method, isGRPC := parseGRPCOperation(normalizedOperation); isGRPC {
+		score = func(candidateOperation string) (int, bool) {
+			candidateService, candidateMethod, candidateIsGRPC := parseGRPCOperation(candidateOperation)
+			if !candidateIsGRPC {
+				return 0, false
+			}
+			return matchGRPCMethod(service, method, candidateService, candidateMethod)
+		}
+	} else {
+		return Match{}, false
 	}
 
-	bestScore := -1
-	bestRequirement := Requirement{}
+	best := Match{Score: -1}
 	for candidateOperation, candidateRequirement := range p {
-		candidateMethod, candidatePath, candidateIsHTTP := parseHTTPOperation(candidateOperation)
-		if !candidateIsHTTP || candidateMethod != method {
+		candidateScore, matches := score(candidateOperation)
+		if !matches || !best.outscoredBy(candidateScore, candidateOperation) {
 			continue
 		}
 
-		score, matches := matchHTTPPath(path, candidatePath)
-		if !matches || score <= bestScore {
-			continue
+		best = Match{
+			Operation:   normalizedOperation,
+			Pattern:     candidateOperation,
+			Score:       candidateScore,
+			Requirement: candidateRequirement,
 		}
+	}
 
-		bestScore = score
-		bestRequirement = candidateRequirement
+	if best.Score < 0 {
+		return Match{}, false
 	}
 
-	if bestScore < 0 {
-		return Requirement{}, false
+	best.Params = httpPathParams(best.Operation, best.Pattern)
+	return best, true
+}
+
+// exactScore scores an operation matched by its own key, so that exact and
+// templated matches are reported on the same scale.
+func exactScore(operation string) int {
+	if _, path, isHTTP := parseHTTPOperation(operation); isHTTP {
+		return len(splitPathSegments(path))
 	}
+	if service, method, isGRPC := parseGRPCOperation(operation); isGRPC {
+		score, _ := matchGRPCMethod(service, method, service, method)
+		return score
+	}
+	return 0
+}
 
-	return bestRequirement, true
+// outscoredBy reports whether a candidate should replace m. Ties are broken by
+// pattern so that resolution does not depend on map iteration order.
+func (m Match) outscoredBy(score int, pattern string) bool {
+	if score != m.Score {
+		return score > m.Score
+	}
+	return pattern < m.Pattern
 }
 
 func HTTPOperation(method, path string) string {
@@ -139,6 +212,38 @@ func matchHTTPPath(requestPath, policyPath string) (int, bool) {
 	return score, true
 }
 
+func httpPathParams(operation, pattern string) map[string]string {
+	_, path, isHTTP := parseHTTPOperation(operation)
+	_, policyPath, policyIsHTTP := parseHTTPOperation(pattern)
+	if !isHTTP || !policyIsHTTP {
+		return nil
+	}
+
+	var params map[string]string
+	requestSegments := splitPathSegments(path)
+	for i, segment := range splitPathSegments(policyPath) {
+		name := pathParamName(segment)
+		if name == "" || i >= len(requestSegments) {
+			continue
+		}
+		if params == nil {
+			params = make(map[string]string)
+		}
+		params[name] = requestSegments[i]
+	}
+	return params
+}
+
+func pathParamName(segment string) string {
+	if name, ok := strings.CutPrefix(segment, ":"); ok {
+		return name
+	}
+	if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+		return segment[1 : len(segment)-1]
+	}
+	return ""
+}
+
 func splitPathSegments(path string) []string {
 	trimmed := strings.Trim(path, "/")
 	if trimmed == "" {
@@ -158,3 +263,48 @@ func isPathParamSegment(segment string) bool {
 
 	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") && len(segment) > 2
 }
+
+func parseGRPCOperation(operation string) (service, method string, ok bool) {
+	trimmed, found := strings.CutPrefix(strings.TrimSpace(operation), "/")
+	if !found {
+		return "", "", false
+	}
+
+	service, method, found = strings.Cut(trimmed, "/")
+	if !found || service == "" || method == "" || strings.Contains(method, "/") {
+		return "", "", false
+	}
+
+	return service, method, true
+}
+
+// matchGRPCMethod matches a full method against a pattern such as
+// /orders.v1.OrderService/*, /orders.v1.*/* or /orders.v1.OrderService/Get*.
+func matchGRPCMethod(service, method, policyService, policyMethod string) (int, bool) {
+	serviceScore, ok := matchGRPCName(service, policyService)
+	if !ok {
+		return 0, false
+	}
+	methodScore, ok := matchGRPCName(method, policyMethod)
+	if !ok {
+		return 0, false
+	}
+	return serviceScore*grpcServiceScoreWeight + methodScore, true
+}
+
+// matchGRPCName scores a name against a literal or trailing-wildcard pattern.
+// Longer literal prefixes score higher, and an exact literal outscores any
+// wildcard that matches the same name.
+func matchGRPCName(name, pattern string) (int, bool) {
+	if prefix, isWildcard := strings.CutSuffix(pattern, "*"); isWildcard {
+		if !strings.HasPrefix(name, prefix) {
+			return 0, false
+		}
+		return len(prefix), true
+	}
+
+	if name != pattern {
+		return 0, false
+	}
+	return len(pattern) + 1, true
+}
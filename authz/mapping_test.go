@@ -100,3 +100,98 @@ var _ = Describe("Operation Helpers", func() {
 		})
 	})
 })
+
+var _ = Describe("Match", func() {
+	It("reports exact matches with their segment count as score", func() {
+		policies := NewPolicyMap()
+		policies.Set(HTTPOperation("GET", "/v1/flags/me"), RequireAny("admin"))
+
+		match, ok := policies.Match(HTTPOperation("GET", "/v1/flags/me"))
+		Expect(ok).To(BeTrue())
+		Expect(match.Pattern).To(Equal("GET /v1/flags/me"))
+		Expect(match.Score).To(Equal(3))
+	})
+
+	It("breaks score ties deterministically by pattern", func() {
+		policies := NewPolicyMap()
+		policies.Set(HTTPOperation("GET", "/v1/{kind}/{id}"), RequireAny("b"))
+		policies.Set(HTTPOperation("GET", "/v1/:kind/:id"), RequireAny("a"))
+
+		for range 10 {
+			match, ok := policies.Match(HTTPOperation("GET", "/v1/flags/1"))
+			Expect(ok).To(BeTrue())
+			Expect(match.Pattern).To(Equal("GET /v1/:kind/:id"))
+		}
+	})
+})
+
+var _ = Describe("gRPC wildcard policies", func() {
+	var policies PolicyMap
+
+	BeforeEach(func() {
+		policies = NewPolicyMap()
+		policies.Set(GRPCOperation("/orders.v1.*/*"), RequireAny("orders"))
+		policies.Set(GRPCOperation("/orders.v1.OrderService/*"), RequireAny("writer"))
+		policies.SetAll(
+			RequireAny("reader"),
+			GRPCOperation("/orders.v1.OrderService/Get*"),
+			GRPCOperation("/orders.v1.OrderService/List*"),
+		)
+		policies.Set(GRPCOperation("/orders.v1.OrderService/GetSecret"), RequireAny("admin"))
+	})
+
+	resolve := func(fullMethod string) (Match, bool) {
+		return policies.Match(GRPCOperation(fullMethod))
+	}
+
+	It("prefers exact methods over every wildcard", func() {
+		match, ok := resolve("/orders.v1.OrderService/GetSecret")
+		Expect(ok).To(BeTrue())
+		Expect(match.Requirement.AnyOf).To(Equal([]string{"admin"}))
+	})
+
+	It("matches method prefixes before service wildcards", func() {
+		match, ok := resolve("/orders.v1.OrderService/ListOrders")
+		Expect(ok).To(BeTrue())
+		Expect(match.Pattern).To(Equal("/orders.v1.OrderService/List*"))
+		Expect(match.Requirement.AnyOf).To(Equal([]string{"reader"}))
+	})
+
+	It("falls back to service-level wildcards", func() {
+		match, ok := resolve("/orders.v1.OrderService/CreateOrder")
+		Expect(ok).To(BeTrue())
+		Expect(match.Pattern).To(Equal("/orders.v1.OrderService/*"))
+	})
+
+	It("falls back to package-level wildcards", func() {
+		match, ok := resolve("/orders.v1.RefundService/CreateRefund")
+		Expect(ok).To(BeTrue())
+		Expect(match.Pattern).To(Equal("/orders.v1.*/*"))
+	})
+
+	It("lets service specificity dominate method specificity", func() {
+		policies.Set(GRPCOperation("/orders.v1.*/CreateOrder"), RequireAny("other"))
+
+		match, ok := resolve("/orders.v1.OrderService/CreateOrder")
+		Expect(ok).To(BeTrue())
+		Expect(match.Pattern).To(Equal("/orders.v1.OrderService/*"))
+	})
+
+	It("does not match other packages", func() {
+		_, ok := resolve("/billing.v1.InvoiceService/GetInvoice")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("does not match malformed methods", func() {
+		_, ok := resolve("orders.v1.OrderService/GetOrder")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("reports exact gRPC matches above wildcard scores", func() {
+		exact, ok := resolve("/orders.v1.OrderService/GetSecret")
+		Expect(ok).To(BeTrue())
+		prefix, ok := resolve("/orders.v1.OrderService/GetOrder")
+		Expect(ok).To(BeTrue())
+		Expect(exact.Score).To(BeNumerically(">", prefix.Score))
+	})
+})
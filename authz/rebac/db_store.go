@@ -0,0 +1,116 @@
+package rebac
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/nojyerac/go-lib/db"
+)
+
+// TupleTable is the table used by the db-backed Store.
+const TupleTable = "authz_tuples"
+
+// TupleTableDDL creates the table used by the db-backed Store (PostgreSQL).
+const TupleTableDDL = `CREATE TABLE IF NOT EXISTS authz_tuples (
+    object           TEXT NOT NULL,
+    relation         TEXT NOT NULL,
+    subject          TEXT NOT NULL,
+    subject_relation TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (object, relation, subject, subject_relation)
+);
+CREATE INDEX IF NOT EXISTS authz_tuples_subject_idx ON authz_tuples (subject, subject_relation);`
+
+// NewDBStore returns a Store backed by the authz_tuples table. Pass a db.Tx to
+// make writes part of a larger transaction.
+func NewDBStore(data db.DataInterface) Store {
+	return &dbStore{data: data}
+}
+
+type dbStore struct {
+	data db.DataInterface
+}
+
+type tupleRow struct {
+	Object          string `db:"object"`
+	Relation        string `db:"relation"`
+	Subject         string `db:"subject"`
+	SubjectRelation string `db:"subject_relation"`
+}
+
+func (s *dbStore) Write(ctx context.Context, tuples ...Tuple) error {
+	for _, t := range tuples {
+		if err := t.validate(); err != nil {
+			return err
+		}
+		if _, err := s.data.Exec(
+			ctx,
+			`INSERT INTO `+TupleTable+` (object, relation, subject, subject_relation)
+VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING`,
+			t.Object, t.Relation, t.Subject.Object, t.Subject.Relation,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *dbStore) Delete(ctx context.Context, tuples ...Tuple) error {
+	for _, t := range tuples {
+		if _, err := s.data.Exec(
+			ctx,
+			`DELETE FROM `+TupleTable+`
+WHERE object = $1 AND relation = $2 AND subject = $3 AND subject_relation = $4`,
+			t.Object, t.Relation, t.Subject.Object, t.Subject.Relation,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *dbStore) Read(ctx context.Context, filter Filter) ([]Tuple, error) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	where := func(column, value string) {
+		args = append(args, value)
+		conditions = append(conditions, column+" = $"+strconv.Itoa(len(args)))
+	}
+	if filter.Object != "" {
+		where("object", filter.Object)
+	}
+	if filter.Relation != "" {
+		where("relation", filter.Relation)
+	}
+	if filter.Subject != "" {
+		subject, err := ParseSubject(filter.Subject)
+		if err != nil {
+			return nil, err
+		}
+		where("subject", subject.Object)
+		where("subject_relation", subject.Relation)
+	}
+
+	query := `SELECT object, relation, subject, subject_relation FROM ` + TupleTable
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY object, relation, subject, subject_relation"
+
+	var rows []tupleRow
+	if err := s.data.Select(ctx, &rows, query, args...); err != nil {
+		return nil, err
+	}
+
+	tuples := make([]Tuple, 0, len(rows))
+	for _, row := range rows {
+		tuples = append(tuples, Tuple{
+			Object:   row.Object,
+			Relation: row.Relation,
+			Subject:  Subject{Object: row.Subject, Relation: row.SubjectRelation},
+		})
+	}
+	return tuples, nil
+}
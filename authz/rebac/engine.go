@@ -0,0 +1,231 @@
+package rebac
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nojyerac/go-lib/authz"
+)
+
+const defaultMaxDepth = 16
+
+var _ authz.RelationChecker = (*Engine)(nil)
+
+// Engine evaluates check and expand queries over a Store using the userset
+// rewrites declared in a Schema. It implements authz.RelationChecker.
+type Engine struct {
+	store    Store
+	schema   Schema
+	maxDepth int
+}
+
+type Option func(*Engine)
+
+// WithMaxDepth bounds how many relations may be followed while evaluating a
+// single query. Deeper queries fail with ErrMaxDepthExceeded.
+func WithMaxDepth(depth int) Option {
+	return func(e *Engine) {
+		if depth > 0 {
+			e.maxDepth = depth
+		}
+	}
+}
+
+func NewEngine(store Store, schema Schema, opts ...Option) *Engine {
+	e := &Engine{
+		store:    store,
+		schema:   schema,
+		maxDepth: defaultMaxDepth,
+	}
+	for _, applyOpt := range opts {
+		applyOpt(e)
+	}
+	return e
+}
+
+// Check reports whether subject holds relation on object. subject may be an
+// object such as user:bob or a userset such as group:eng#member.
+func (e *Engine) Check(ctx context.Context, object, relation, subject string) (bool, error) {
+	parsedSubject, err := ParseSubject(subject)
+	if err != nil {
+		return false, err
+	}
+	q := &checkQuery{engine: e, subject: parsedSubject, visiting: make(map[string]bool)}
+	return q.check(ctx, object, relation, 0)
+}
+
+type checkQuery struct {
+	engine   *Engine
+	subject  Subject
+	visiting map[string]bool
+	// negated is set while evaluating the subtract side of an odd number of
+	// exclusions, where a match denies the relation.
+	negated bool
+}
+
+func (q *checkQuery) check(ctx context.Context, object, relation string, depth int) (bool, error) {
+	if depth > q.engine.maxDepth {
+		return false, fmt.Errorf("%w: %s#%s", ErrMaxDepthExceeded, object, relation)
+	}
+	if q.subject.Object == object && q.subject.Relation == relation {
+		return true, nil
+	}
+
+	// a relation already being evaluated on this path cannot add new
+	// subjects; inside an exclusion's subtract side the cycle counts as a
+	// match so that it denies instead of granting
+	key := object + "#" + relation
+	if q.visiting[key] {
+		return q.negated, nil
+	}
+	q.visiting[key] = true
+	defer delete(q.visiting, key)
+
+	return q.eval(ctx, object, relation, q.engine.schema.rewrite(object, relation), depth)
+}
+
+func (q *checkQuery) eval(ctx context.Context, object, relation string, rewrite Rewrite, depth int) (bool, error) {
+	switch rewrite.kind {
+	case rewriteThis:
+		tuples, err := q.engine.store.Read(ctx, Filter{Object: object, Relation: relation})
+		if err != nil {
+			return false, err
+		}
+		for _, t := range tuples {
+			if t.Subject == q.subject {
+				return true, nil
+			}
+			if !t.Subject.IsUserset() {
+				continue
+			}
+			ok, err := q.check(ctx, t.Subject.Object, t.Subject.Relation, depth+1)
+			if err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+	case rewriteComputedUserset:
+		return q.check(ctx, object, rewrite.relation, depth+1)
+	case rewriteTupleToUserset:
+		tuples, err := q.engine.store.Read(ctx, Filter{Object: object, Relation: rewrite.tupleset})
+		if err != nil {
+			return false, err
+		}
+		for _, t := range tuples {
+			ok, err := q.check(ctx, t.Subject.Object, rewrite.relation, depth+1)
+			if err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+	case rewriteUnion:
+		for _, child := range rewrite.children {
+			ok, err := q.eval(ctx, object, relation, child, depth)
+			if err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+	case rewriteIntersection:
+		for _, child := range rewrite.children {
+			ok, err := q.eval(ctx, object, relation, child, depth)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+		return len(rewrite.children) > 0, nil
+	case rewriteExclusion:
+		ok, err := q.eval(ctx, object, relation, rewrite.children[0], depth)
+		if err != nil || !ok {
+			return false, err
+		}
+		q.negated = !q.negated
+		excluded, err := q.eval(ctx, object, relation, rewrite.children[1], depth)
+		q.negated = !q.negated
+		if err != nil {
+			return false, err
+		}
+		return !excluded, nil
+	default:
+		return false, fmt.Errorf("unknown userset rewrite %d", rewrite.kind)
+	}
+}
+
+// Tree is the result of Expand: a userset expressed as set operations over
+// the subjects stored on each relation.
+type Tree struct {
+	// Operation is one of leaf, union, intersection or exclusion.
+	Operation string `json:"operation"`
+	Object    string `json:"object,omitempty"`
+	Relation  string `json:"relation,omitempty"`
+	// Subjects lists the direct subjects of a leaf. Usersets such as
+	// group:eng#member are listed as-is and can be expanded in turn.
+	Subjects []string `json:"subjects,omitempty"`
+	Children []*Tree  `json:"children,omitempty"`
+}
+
+// Expand returns the userset tree for relation on object.
+func (e *Engine) Expand(ctx context.Context, object, relation string) (*Tree, error) {
+	return e.expand(ctx, object, relation, 0)
+}
+
+func (e *Engine) expand(ctx context.Context, object, relation string, depth int) (*Tree, error) {
+	if depth > e.maxDepth {
+		return nil, fmt.Errorf("%w: %s#%s", ErrMaxDepthExceeded, object, relation)
+	}
+	return e.expandRewrite(ctx, object, relation, e.schema.rewrite(object, relation), depth)
+}
+
+func (e *Engine) expandRewrite(
+	ctx context.Context,
+	object, relation string,
+	rewrite Rewrite,
+	depth int,
+) (*Tree, error) {
+	switch rewrite.kind {
+	case rewriteThis:
+		tuples, err := e.store.Read(ctx, Filter{Object: object, Relation: relation})
+		if err != nil {
+			return nil, err
+		}
+		leaf := &Tree{Operation: "leaf", Object: object, Relation: relation}
+		for _, t := range tuples {
+			leaf.Subjects = append(leaf.Subjects, t.Subject.String())
+		}
+		return leaf, nil
+	case rewriteComputedUserset:
+		return e.expand(ctx, object, rewrite.relation, depth+1)
+	case rewriteTupleToUserset:
+		tuples, err := e.store.Read(ctx, Filter{Object: object, Relation: rewrite.tupleset})
+		if err != nil {
+			return nil, err
+		}
+		node := &Tree{Operation: "union", Object: object, Relation: relation}
+		for _, t := range tuples {
+			child, err := e.expand(ctx, t.Subject.Object, rewrite.relation, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			node.Children = append(node.Children, child)
+		}
+		return node, nil
+	case rewriteUnion, rewriteIntersection, rewriteExclusion:
+		node := &Tree{Operation: operationNames[rewrite.kind], Object: object, Relation: relation}
+		for _, childRewrite := range rewrite.children {
+			child, err := e.expandRewrite(ctx, object, relation, childRewrite, depth)
+			if err != nil {
+				return nil, err
+			}
+			node.Children = append(node.Children, child)
+		}
+		return node, nil
+	default:
+		return nil, fmt.Errorf("unknown userset rewrite %d", rewrite.kind)
+	}
+}
+
+var operationNames = map[rewriteKind]string{
+	rewriteUnion:        "union",
+	rewriteIntersection: "intersection",
+	rewriteExclusion:    "exclusion",
+}
@@ -0,0 +1,148 @@
+package rebac_test
+
+import (
+	"context"
+
+	. "github.com/nojyerac/go-lib/authz/rebac"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Engine", func() {
+	var (
+		ctx    context.Context
+		store  Store
+		engine *Engine
+	)
+
+	schema := Schema{
+		"document": {
+			"editor": Union(This(), ComputedUserset("owner"), TupleToUserset("parent", "editor")),
+			"viewer": Union(This(), ComputedUserset("editor")),
+			"auditor": Intersection(
+				ComputedUserset("viewer"),
+				TupleToUserset("parent", "auditor"),
+			),
+			"commenter": Exclusion(ComputedUserset("viewer"), This()),
+		},
+		"folder": {
+			"editor": Union(This(), ComputedUserset("owner")),
+		},
+	}
+
+	write := func(tuples ...string) {
+		for _, t := range tuples {
+			Expect(store.Write(ctx, MustParseTuple(t))).To(Succeed())
+		}
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		store = NewMemoryStore()
+		engine = NewEngine(store, schema)
+		write(
+			"group:y#member@user:bob",
+			"folder:z#owner@group:y#member",
+			"document:x#parent@folder:z",
+		)
+	})
+
+	Describe("Check", func() {
+		It("follows groups, ownership and parents", func() {
+			ok, err := engine.Check(ctx, "document:x", "editor", "user:bob")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+
+			ok, err = engine.Check(ctx, "document:x", "viewer", "user:bob")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+		})
+
+		It("denies subjects without a path", func() {
+			ok, err := engine.Check(ctx, "document:x", "editor", "user:alice")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeFalse())
+		})
+
+		It("checks userset subjects", func() {
+			ok, err := engine.Check(ctx, "folder:z", "editor", "group:y#member")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+		})
+
+		It("requires every branch of an intersection", func() {
+			ok, err := engine.Check(ctx, "document:x", "auditor", "user:bob")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeFalse())
+
+			write("folder:z#auditor@user:bob")
+			ok, err = engine.Check(ctx, "document:x", "auditor", "user:bob")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+		})
+
+		It("subtracts excluded subjects", func() {
+			ok, err := engine.Check(ctx, "document:x", "commenter", "user:bob")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+
+			write("document:x#commenter@user:bob")
+			ok, err = engine.Check(ctx, "document:x", "commenter", "user:bob")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeFalse())
+		})
+
+		It("terminates on membership cycles", func() {
+			write("group:a#member@group:b#member", "group:b#member@group:a#member")
+
+			ok, err := engine.Check(ctx, "group:a", "member", "user:carol")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeFalse())
+		})
+
+		It("denies when an exclusion subtracts a relation that depends on itself", func() {
+			engine = NewEngine(store, Schema{
+				"page": {
+					"reader":  Exclusion(This(), ComputedUserset("blocked")),
+					"blocked": Union(This(), ComputedUserset("reader")),
+				},
+			})
+			write("page:p#reader@user:bob")
+
+			ok, err := engine.Check(ctx, "page:p", "reader", "user:bob")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeFalse())
+		})
+
+		It("fails when max depth is exceeded", func() {
+			engine = NewEngine(store, schema, WithMaxDepth(1))
+
+			_, err := engine.Check(ctx, "document:x", "editor", "user:bob")
+			Expect(err).To(MatchError(ErrMaxDepthExceeded))
+		})
+
+		It("rejects malformed subjects", func() {
+			_, err := engine.Check(ctx, "document:x", "editor", "bob")
+			Expect(err).To(MatchError(ErrInvalidTuple))
+		})
+	})
+
+	Describe("Expand", func() {
+		It("returns the userset tree", func() {
+			tree, err := engine.Expand(ctx, "document:x", "editor")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(tree.Operation).To(Equal("union"))
+			Expect(tree.Children).To(HaveLen(3))
+			Expect(tree.Children[0]).To(Equal(&Tree{Operation: "leaf", Object: "document:x", Relation: "editor"}))
+			Expect(tree.Children[1]).To(Equal(&Tree{Operation: "leaf", Object: "document:x", Relation: "owner"}))
+
+			parents := tree.Children[2]
+			Expect(parents.Operation).To(Equal("union"))
+			Expect(parents.Children).To(HaveLen(1))
+			folderEditors := parents.Children[0]
+			Expect(folderEditors.Operation).To(Equal("union"))
+			Expect(folderEditors.Children[1].Subjects).To(Equal([]string{"group:y#member"}))
+		})
+	})
+})
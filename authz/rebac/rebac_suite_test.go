@@ -0,0 +1,13 @@
+package rebac_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestRebac(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Rebac Suite")
+}
@@ -0,0 +1,81 @@
+package rebac
+
+import "strings"
+
+// Schema maps an object type to its relations and their userset rewrites.
+// Relations that are not declared are treated as This(): only tuples stored
+// directly on the relation grant it.
+type Schema map[string]Namespace
+
+// Namespace maps relation names to userset rewrites for one object type.
+type Namespace map[string]Rewrite
+
+type rewriteKind int
+
+const (
+	rewriteThis rewriteKind = iota
+	rewriteComputedUserset
+	rewriteTupleToUserset
+	rewriteUnion
+	rewriteIntersection
+	rewriteExclusion
+)
+
+// Rewrite describes how the holders of a relation are computed.
+type Rewrite struct {
+	kind     rewriteKind
+	relation string
+	tupleset string
+	children []Rewrite
+}
+
+// This grants the relation to subjects of tuples stored on the relation.
+func This() Rewrite {
+	return Rewrite{kind: rewriteThis}
+}
+
+// ComputedUserset grants the relation to holders of another relation on the
+// same object, e.g. every owner is an editor.
+func ComputedUserset(relation string) Rewrite {
+	return Rewrite{kind: rewriteComputedUserset, relation: relation}
+}
+
+// TupleToUserset follows the tupleset relation to other objects and grants the
+// relation to holders of relation on them, e.g. editors of a document's
+// parent folder are editors of the document.
+func TupleToUserset(tupleset, relation string) Rewrite {
+	return Rewrite{kind: rewriteTupleToUserset, tupleset: tupleset, relation: relation}
+}
+
+// Union grants the relation to subjects matched by any child.
+func Union(children ...Rewrite) Rewrite {
+	return Rewrite{kind: rewriteUnion, children: children}
+}
+
+// Intersection grants the relation to subjects matched by every child.
+func Intersection(children ...Rewrite) Rewrite {
+	return Rewrite{kind: rewriteIntersection, children: children}
+}
+
+// Exclusion grants the relation to subjects matched by base but not by
+// subtract.
+func Exclusion(base, subtract Rewrite) Rewrite {
+	return Rewrite{kind: rewriteExclusion, children: []Rewrite{base, subtract}}
+}
+
+func (s Schema) rewrite(object, relation string) Rewrite {
+	namespace, ok := s[objectType(object)]
+	if !ok {
+		return This()
+	}
+	rewrite, ok := namespace[relation]
+	if !ok {
+		return This()
+	}
+	return rewrite
+}
+
+func objectType(object string) string {
+	objectType, _, _ := strings.Cut(object, ":")
+	return objectType
+}
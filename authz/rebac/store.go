@@ -0,0 +1,76 @@
+package rebac
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// Filter selects tuples by exact field values. Empty fields match anything.
+type Filter struct {
+	Object   string
+	Relation string
+	Subject  string
+}
+
+func (f Filter) matches(t Tuple) bool {
+	return (f.Object == "" || f.Object == t.Object) &&
+		(f.Relation == "" || f.Relation == t.Relation) &&
+		(f.Subject == "" || f.Subject == t.Subject.String())
+}
+
+// Store persists relation tuples.
+type Store interface {
+	Write(ctx context.Context, tuples ...Tuple) error
+	Delete(ctx context.Context, tuples ...Tuple) error
+	Read(ctx context.Context, filter Filter) ([]Tuple, error)
+}
+
+// NewMemoryStore returns a Store backed by an in-process map. It is intended
+// for tests and for small, static relationship sets.
+func NewMemoryStore() Store {
+	return &memoryStore{tuples: make(map[Tuple]struct{})}
+}
+
+type memoryStore struct {
+	mu     sync.RWMutex
+	tuples map[Tuple]struct{}
+}
+
+func (m *memoryStore) Write(_ context.Context, tuples ...Tuple) error {
+	for _, t := range tuples {
+		if err := t.validate(); err != nil {
+			return err
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, t := range tuples {
+		m.tuples[t] = struct{}{}
+	}
+	return nil
+}
+
+func (m *memoryStore) Delete(_ context.Context, tuples ...Tuple) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, t := range tuples {
+		delete(m.tuples, t)
+	}
+	return nil
+}
+
+func (m *memoryStore) Read(_ context.Context, filter Filter) ([]Tuple, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	result := make([]Tuple, 0)
+	for t := range m.tuples {
+		if filter.matches(t) {
+			result = append(result, t)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].String() < result[j].String()
+	})
+	return result, nil
+}
@@ -0,0 +1,124 @@
+package rebac_test
+
+import (
+	"context"
+	"fmt"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	. "github.com/nojyerac/go-lib/authz/rebac"
+	"github.com/nojyerac/go-lib/db"
+	"github.com/nojyerac/go-lib/log"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MemoryStore", func() {
+	var (
+		ctx   context.Context
+		store Store
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		store = NewMemoryStore()
+		Expect(store.Write(ctx,
+			MustParseTuple("document:a#editor@user:bob"),
+			MustParseTuple("document:a#viewer@group:eng#member"),
+			MustParseTuple("document:b#editor@user:bob"),
+		)).To(Succeed())
+	})
+
+	It("reads tuples by filter in a stable order", func() {
+		tuples, err := store.Read(ctx, Filter{Subject: "user:bob"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tuples).To(Equal([]Tuple{
+			MustParseTuple("document:a#editor@user:bob"),
+			MustParseTuple("document:b#editor@user:bob"),
+		}))
+
+		tuples, err = store.Read(ctx, Filter{Object: "document:a", Relation: "viewer"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tuples).To(HaveLen(1))
+	})
+
+	It("deletes tuples", func() {
+		Expect(store.Delete(ctx, MustParseTuple("document:a#editor@user:bob"))).To(Succeed())
+
+		tuples, err := store.Read(ctx, Filter{Object: "document:a"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tuples).To(Equal([]Tuple{MustParseTuple("document:a#viewer@group:eng#member")}))
+	})
+
+	It("rejects invalid tuples", func() {
+		Expect(store.Write(ctx, Tuple{Object: "document:a"})).To(MatchError(ErrInvalidTuple))
+	})
+})
+
+var dsnCount int
+
+var _ = Describe("DBStore", func() {
+	var (
+		ctx     context.Context
+		store   Store
+		sqlMock sqlmock.Sqlmock
+	)
+
+	BeforeEach(func() {
+		var err error
+		ctx = context.Background()
+		dsnCount++
+		dsn := fmt.Sprintf("rebacDB-%d", dsnCount)
+		_, sqlMock, err = sqlmock.NewWithDSN(dsn)
+		Expect(err).NotTo(HaveOccurred())
+
+		config := db.NewConfiguration()
+		config.Driver = "sqlmock"
+		config.DBConnStr = dsn
+		database := db.NewDatabase(config, db.WithLogger(log.Nop()))
+		Expect(database.Open(ctx)).To(Succeed())
+		store = NewDBStore(database)
+		DeferCleanup(func() {
+			Expect(sqlMock.ExpectationsWereMet()).To(Succeed())
+			sqlMock.ExpectClose()
+			Expect(database.Close()).To(Succeed())
+		})
+	})
+
+	It("inserts tuples idempotently", func() {
+		sqlMock.ExpectExec(`INSERT INTO authz_tuples .* ON CONFLICT DO NOTHING`).
+			WithArgs("folder:z", "owner", "group:y", "member").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		Expect(store.Write(ctx, MustParseTuple("folder:z#owner@group:y#member"))).To(Succeed())
+	})
+
+	It("deletes tuples", func() {
+		sqlMock.ExpectExec(`DELETE FROM authz_tuples`).
+			WithArgs("folder:z", "owner", "user:bob", "").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		Expect(store.Delete(ctx, MustParseTuple("folder:z#owner@user:bob"))).To(Succeed())
+	})
+
+	It("reads tuples with filter conditions", func() {
+		sqlMock.ExpectQuery(`SELECT object, relation, subject, subject_relation FROM authz_tuples `+
+			`WHERE object = \$1 AND relation = \$2 ORDER BY`).
+			WithArgs("folder:z", "owner").
+			WillReturnRows(sqlmock.NewRows([]string{"object", "relation", "subject", "subject_relation"}).
+				AddRow("folder:z", "owner", "group:y", "member"))
+
+		tuples, err := store.Read(ctx, Filter{Object: "folder:z", Relation: "owner"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tuples).To(Equal([]Tuple{MustParseTuple("folder:z#owner@group:y#member")}))
+	})
+
+	It("splits userset subjects in filters", func() {
+		sqlMock.ExpectQuery(`WHERE subject = \$1 AND subject_relation = \$2`).
+			WithArgs("group:y", "member").
+			WillReturnRows(sqlmock.NewRows([]string{"object", "relation", "subject", "subject_relation"}))
+
+		tuples, err := store.Read(ctx, Filter{Subject: "group:y#member"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tuples).To(BeEmpty())
+	})
+})
@@ -0,0 +1,89 @@
+package rebac
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrInvalidTuple     = errors.New("invalid relation tuple")
+	ErrMaxDepthExceeded = errors.New("relation evaluation exceeded max depth")
+)
+
+// Subject is either a concrete object such as user:bob or a userset such as
+// group:eng#member.
+type Subject struct {
+	Object   string
+	Relation string
+}
+
+// Tuple is a relationship object#relation@subject, for example
+// document:readme#editor@user:bob or folder:z#owner@group:y#member.
+type Tuple struct {
+	Object   string
+	Relation string
+	Subject  Subject
+}
+
+func ParseSubject(s string) (Subject, error) {
+	object, relation, hasRelation := strings.Cut(strings.TrimSpace(s), "#")
+	if !isObject(object) || (hasRelation && relation == "") {
+		return Subject{}, fmt.Errorf("%w: subject %q", ErrInvalidTuple, s)
+	}
+	return Subject{Object: object, Relation: relation}, nil
+}
+
+func ParseTuple(s string) (Tuple, error) {
+	objectRelation, subject, found := strings.Cut(strings.TrimSpace(s), "@")
+	if !found {
+		return Tuple{}, fmt.Errorf("%w: %q", ErrInvalidTuple, s)
+	}
+	object, relation, found := strings.Cut(objectRelation, "#")
+	if !found || !isObject(object) || relation == "" {
+		return Tuple{}, fmt.Errorf("%w: %q", ErrInvalidTuple, s)
+	}
+	parsedSubject, err := ParseSubject(subject)
+	if err != nil {
+		return Tuple{}, err
+	}
+	return Tuple{Object: object, Relation: relation, Subject: parsedSubject}, nil
+}
+
+func MustParseTuple(s string) Tuple {
+	t, err := ParseTuple(s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func (s Subject) String() string {
+	if s.Relation == "" {
+		return s.Object
+	}
+	return s.Object + "#" + s.Relation
+}
+
+// IsUserset reports whether the subject refers to the holders of a relation
+// rather than to a single object.
+func (s Subject) IsUserset() bool {
+	return s.Relation != ""
+}
+
+func (t Tuple) String() string {
+	return t.Object + "#" + t.Relation + "@" + t.Subject.String()
+}
+
+func (t Tuple) validate() error {
+	if !isObject(t.Object) || t.Relation == "" || !isObject(t.Subject.Object) {
+		return fmt.Errorf("%w: %q", ErrInvalidTuple, t.String())
+	}
+	return nil
+}
+
+// isObject reports whether s has the form type:id.
+func isObject(s string) bool {
+	objectType, id, found := strings.Cut(s, ":")
+	return found && objectType != "" && id != ""
+}
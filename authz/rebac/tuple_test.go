@@ -0,0 +1,43 @@
+package rebac_test
+
+import (
+	. "github.com/nojyerac/go-lib/authz/rebac"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Tuple", func() {
+	It("parses direct subjects", func() {
+		t, err := ParseTuple("document:readme#editor@user:bob")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(t.Object).To(Equal("document:readme"))
+		Expect(t.Relation).To(Equal("editor"))
+		Expect(t.Subject).To(Equal(Subject{Object: "user:bob"}))
+		Expect(t.Subject.IsUserset()).To(BeFalse())
+		Expect(t.String()).To(Equal("document:readme#editor@user:bob"))
+	})
+
+	It("parses userset subjects", func() {
+		t, err := ParseTuple("folder:z#owner@group:y#member")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(t.Subject).To(Equal(Subject{Object: "group:y", Relation: "member"}))
+		Expect(t.Subject.IsUserset()).To(BeTrue())
+		Expect(t.String()).To(Equal("folder:z#owner@group:y#member"))
+	})
+
+	DescribeTable("rejects malformed tuples",
+		func(s string) {
+			_, err := ParseTuple(s)
+			Expect(err).To(MatchError(ErrInvalidTuple))
+		},
+		Entry("missing subject", "document:readme#editor"),
+		Entry("missing relation", "document:readme@user:bob"),
+		Entry("untyped object", "readme#editor@user:bob"),
+		Entry("untyped subject", "document:readme#editor@bob"),
+		Entry("empty subject relation", "document:readme#editor@group:y#"),
+	)
+
+	It("panics in MustParseTuple for malformed tuples", func() {
+		Expect(func() { MustParseTuple("nope") }).To(Panic())
+	})
+})
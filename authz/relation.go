@@ -0,0 +1,95 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/nojyerac/go-lib/auth"
+)
+
+// RelationSubjectType is the object type used for the authenticated caller
+// when evaluating relationship requirements, e.g. user:<subject>.
+const RelationSubjectType = "user"
+
+// ErrRelationCheck is returned by AuthorizeContext when the RelationChecker
+// fails. It is not a denial: the transports answer it with an unavailable
+// status and keep the cause, which may name the backing store, server-side.
+var ErrRelationCheck = errors.New("relation check failed")
+
+// RelationChecker answers relationship queries such as "is user:bob an editor
+// of document:readme". The authz/rebac Engine implements it.
+type RelationChecker interface {
+	Check(ctx context.Context, object, relation, subject string) (bool, error)
+}
+
+// RelationRequirement requires the caller to hold Relation on the object
+// <ObjectType>:<id>, where id is read from the request parameter ObjectParam.
+type RelationRequirement struct {
+	ObjectType  string `json:"objectType"`
+	ObjectParam string `json:"objectParam"`
+	Relation    string `json:"relation"`
+}
+
+func RequireRelation(objectType, objectParam, relation string) Requirement {
+	return Requirement{Relation: &RelationRequirement{
+		ObjectType:  objectType,
+		ObjectParam: objectParam,
+		Relation:    relation,
+	}}
+}
+
+// Object returns the object identifier for the request parameters, or false
+// when the parameter is missing.
+func (r *RelationRequirement) Object(params map[string]string) (string, bool) {
+	id := params[r.ObjectParam]
+	if r.ObjectType == "" || id == "" {
+		return "", false
+	}
+	return r.ObjectType + ":" + id, true
+}
+
+// RelationSubject returns the relationship subject for claims.
+func RelationSubject(claims *auth.Claims) string {
+	if claims == nil || claims.Subject == "" {
+		return ""
+	}
+	return RelationSubjectType + ":" + claims.Subject
+}
+
+// AuthorizeContext enforces the role and relationship parts of requirement.
+// params supplies the object identifier for relationship requirements, such
+// as the path parameters of an HTTP match. A relationship requirement with no
+// checker, no subject or no object is denied; a checker failure returns
+// ErrRelationCheck.
+func AuthorizeContext(
+	ctx context.Context,
+	checker RelationChecker,
+	claims *auth.Claims,
+	requirement Requirement,
+	params map[string]string,
+) error {
+	if err := Authorize(claims, requirement.roles()); err != nil {
+		return err
+	}
+
+	relation := requirement.Relation
+	if relation == nil {
+		return nil
+	}
+
+	subject := RelationSubject(claims)
+	object, ok := relation.Object(params)
+	if checker == nil || subject == "" || !ok {
+		return auth.ErrPermissionDenied
+	}
+
+	allowed, err := checker.Check(ctx, object, relation.Relation, subject)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRelationCheck, err)
+	}
+	if !allowed {
+		return auth.ErrPermissionDenied
+	}
+	return nil
+}
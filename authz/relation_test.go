@@ -0,0 +1,106 @@
+package authz_test
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/nojyerac/go-lib/auth"
+	. "github.com/nojyerac/go-lib/authz"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type relationCheckerStub struct {
+	allowed bool
+	err     error
+	calls   [][3]string
+}
+
+func (r *relationCheckerStub) Check(_ context.Context, object, relation, subject string) (bool, error) {
+	r.calls = append(r.calls, [3]string{object, relation, subject})
+	return r.allowed, r.err
+}
+
+var _ = Describe("Relation requirements", func() {
+	var (
+		ctx     context.Context
+		checker *relationCheckerStub
+		claims  *Claims
+		params  map[string]string
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		checker = &relationCheckerStub{allowed: true}
+		claims = &Claims{Subject: "bob", Roles: []string{"reader"}}
+		params = map[string]string{"id": "x"}
+	})
+
+	It("is not empty and not satisfied by roles alone", func() {
+		req := RequireRelation("document", "id", "editor")
+		Expect(req.IsEmpty()).To(BeFalse())
+		Expect(req.SatisfiedBy(claims)).To(BeFalse())
+		Expect(Authorize(claims, req)).To(MatchError(ErrPermissionDenied))
+	})
+
+	It("checks the caller against the object from params", func() {
+		Expect(AuthorizeContext(ctx, checker, claims, RequireRelation("document", "id", "editor"), params)).To(Succeed())
+		Expect(checker.calls).To(Equal([][3]string{{"document:x", "editor", "user:bob"}}))
+	})
+
+	It("enforces roles before relations", func() {
+		req := RequireRelation("document", "id", "editor")
+		req.AllOf = []string{"admin"}
+
+		Expect(AuthorizeContext(ctx, checker, claims, req, params)).To(MatchError(ErrPermissionDenied))
+		Expect(checker.calls).To(BeEmpty())
+	})
+
+	It("denies when the checker denies", func() {
+		req := RequireRelation("document", "id", "editor")
+		checker.allowed = false
+		Expect(AuthorizeContext(ctx, checker, claims, req, params)).To(MatchError(ErrPermissionDenied))
+	})
+
+	It("reports checker failures apart from denials", func() {
+		req := RequireRelation("document", "id", "editor")
+		checker.err = errors.New("store down")
+		err := AuthorizeContext(ctx, checker, claims, req, params)
+		Expect(err).To(MatchError(ErrRelationCheck))
+		Expect(err).NotTo(MatchError(ErrPermissionDenied))
+	})
+
+	It("denies without a checker, subject or object", func() {
+		req := RequireRelation("document", "id", "editor")
+		Expect(AuthorizeContext(ctx, nil, claims, req, params)).To(MatchError(ErrPermissionDenied))
+		Expect(AuthorizeContext(ctx, checker, &Claims{}, req, params)).To(MatchError(ErrPermissionDenied))
+		Expect(AuthorizeContext(ctx, checker, claims, req, nil)).To(MatchError(ErrPermissionDenied))
+	})
+
+	It("behaves like Authorize for role-only requirements", func() {
+		Expect(AuthorizeContext(ctx, nil, claims, RequireAny("reader"), nil)).To(Succeed())
+		Expect(AuthorizeContext(ctx, nil, claims, RequireAny("admin"), nil)).To(MatchError(ErrPermissionDenied))
+	})
+
+	It("exposes path params on HTTP matches", func() {
+		policies := NewPolicyMap()
+		policies.Set(
+			HTTPOperation("PUT", "/v1/documents/{id}/comments/:comment"),
+			RequireRelation("document", "id", "editor"),
+		)
+
+		match, ok := policies.Match(HTTPOperation("PUT", "/v1/documents/x/comments/7"))
+		Expect(ok).To(BeTrue())
+		Expect(match.Params).To(Equal(map[string]string{"id": "x", "comment": "7"}))
+	})
+
+	It("marks explanations with pending relation checks", func() {
+		policies := NewPolicyMap()
+		policies.Set(HTTPOperation("GET", "/v1/documents/{id}"), RequireRelation("document", "id", "viewer"))
+
+		explanation := policies.Explain(HTTPOperation("GET", "/v1/documents/x"), claims)
+		Expect(explanation.RelationPending).To(BeTrue())
+		Expect(explanation.Allowed).To(BeFalse())
+		Expect(explanation.MissingAllOf).To(BeEmpty())
+	})
+})
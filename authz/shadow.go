@@ -0,0 +1,58 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/nojyerac/go-lib/auth"
+	"github.com/nojyerac/go-lib/log"
+	"github.com/nojyerac/go-lib/metrics"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+var (
+	meter               = metrics.MeterForPackage()
+	initShadowMetrics   sync.Once
+	shadowDenialCounter metric.Int64Counter
+)
+
+func shadowDenials() metric.Int64Counter {
+	initShadowMetrics.Do(func() {
+		// the meter returns a usable no-op instrument alongside any error
+		shadowDenialCounter, _ = meter.Int64Counter(
+			"authz_shadow_denials",
+			metric.WithDescription("count of requests that would have been denied in enforcing mode"),
+		)
+	})
+	return shadowDenialCounter
+}
+
+// RecordShadowDenial logs and counts a denial that was not enforced because
+// the caller runs in shadow mode. err is the error enforcement would have
+// returned; explanation describes the policy that produced it.
+func RecordShadowDenial(ctx context.Context, explanation Explanation, err error) {
+	reason := "forbidden"
+	switch {
+	case errors.Is(err, ErrRelationCheck):
+		reason = "error"
+	case !errors.Is(err, auth.ErrPermissionDenied):
+		reason = "unauthenticated"
+	}
+
+	shadowDenials().Add(ctx, 1, metric.WithAttributes(
+		attribute.String("pattern", explanation.Pattern),
+		attribute.String("reason", reason),
+	))
+
+	log.FromContext(ctx).WithFields(logrus.Fields{
+		"operation":    explanation.Operation,
+		"pattern":      explanation.Pattern,
+		"score":        explanation.Score,
+		"reason":       reason,
+		"missingAllOf": explanation.MissingAllOf,
+		"missingAnyOf": explanation.MissingAnyOf,
+	}).WithError(err).Warn("authz shadow denial")
+}
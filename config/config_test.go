@@ -1,13 +1,82 @@
 package config_test
 
 import (
+	"os"
+
+	. "github.com/nojyerac/go-lib/config"
+	"github.com/nojyerac/go-lib/log"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/spf13/pflag"
 )
 
+type portConfig struct {
+	Port int `config:"loader_port" flag:"port,p" validate:"gte=1"`
+}
+
 var _ = Describe("ConfigLoader", func() {
 	It("is testable", func() {
 		Expect(c).NotTo(BeNil())
 		Expect(c.InitAndValidate()).To(Succeed())
 	})
+
+	newLoader := func(args ...string) Loader {
+		return NewConfigLoader("test", WithLogger(log.Nop()),
+			WithFlagSet(pflag.NewFlagSet("test", pflag.ContinueOnError)),
+			WithArgs(append([]string{"-c", "./testdata"}, args...)...))
+	}
+
+	It("keeps the flags and args of each loader apart", func() {
+		first, second := &portConfig{Port: 1}, &portConfig{Port: 1}
+		l1, l2 := newLoader("--port", "8080"), newLoader("-p", "9090")
+		Expect(l1.RegisterConfig(first)).To(Succeed())
+		Expect(l2.RegisterConfig(second)).To(Succeed())
+
+		Expect(l1.InitAndValidate()).To(Succeed())
+		Expect(l2.InitAndValidate()).To(Succeed())
+		Expect(first.Port).To(Equal(8080))
+		Expect(second.Port).To(Equal(9090))
+	})
+
+	It("rejects flags that are already defined", func() {
+		l := newLoader()
+		Expect(l.RegisterConfig(&portConfig{Port: 1})).To(Succeed())
+		Expect(l.RegisterConfig(&portConfig{})).To(MatchError(ContainSubstring("flag --port is already defined")))
+		Expect(l.RegisterConfig(&struct {
+			Other string `config:"other" flag:"other,p"`
+		}{})).To(MatchError(ContainSubstring("flag shorthand -p is already defined")))
+		Expect(l.InitAndValidate()).To(Succeed())
+	})
+
+	It("rejects a struct type that is already registered", func() {
+		type limits struct {
+			Max int `config:"max"`
+		}
+		l := newLoader()
+		Expect(l.RegisterConfig(&limits{})).To(Succeed())
+		Expect(l.RegisterConfig(&limits{})).To(MatchError(ContainSubstring("type is already registered")))
+	})
+
+	It("starts over on every InitAndValidate", func() {
+		conf := &portConfig{Port: 1}
+		l := newLoader()
+		Expect(l.RegisterConfig(conf)).To(Succeed())
+
+		Expect(os.Setenv("TEST_LOADER_PORT", "7070")).To(Succeed())
+		Expect(l.InitAndValidate()).To(Succeed())
+		Expect(conf.Port).To(Equal(7070))
+
+		Expect(os.Unsetenv("TEST_LOADER_PORT")).To(Succeed())
+		Expect(l.InitAndValidate()).To(Succeed())
+		Expect(conf.Port).To(Equal(1))
+	})
+
+	It("returns flag parse errors", func() {
+		l := newLoader("--port", "http")
+		Expect(l.RegisterConfig(&portConfig{})).To(Succeed())
+		Expect(l.InitAndValidate()).To(MatchError(ContainSubstring(`invalid argument "http"`)))
+
+		l = newLoader("--help")
+		Expect(l.InitAndValidate()).To(MatchError(pflag.ErrHelp))
+	})
 })
@@ -1,21 +1,58 @@
 package config
 
 import (
-	"os"
+	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
 )
 
 type Configuration struct {
-	LogConfigOnInit bool   `config:"log_config_on_init"`
-	ConfigPath      string `config:"config_dir" flag:"configs,c" validate:"dir"`
+	LogConfigOnInit bool   `config:"log_config_on_init" usage:"log every setting once loaded"`
+	ConfigPath      string `config:"config_dir" flag:"configs,c" validate:"dir" usage:"directory of config files"`
 }
 
 type Option func(*configLoader)
 
+// WithArgs sets the arguments the loader parses, without the program name.
+// Defaults to os.Args[1:] at each InitAndValidate.
 func WithArgs(args ...string) Option {
 	return func(cl *configLoader) {
-		os.Args = append([]string{os.Args[0]}, args...)
+		cl.args = append([]string{}, args...)
+	}
+}
+
+// WithFlagSet registers the loader's flags on fs instead of a new FlagSet
+// that exits on parse errors. Pass a pflag.ContinueOnError set to get parse
+// errors, including pflag.ErrHelp, from InitAndValidate; pass
+// pflag.CommandLine to share flags with the rest of the program.
+func WithFlagSet(fs *pflag.FlagSet) Option {
+	return func(cl *configLoader) {
+		cl.flags = fs
+	}
+}
+
+// WithReloadDebounce sets how long Watch waits for the config directory to
+// stop changing before it reloads. Defaults to 100ms.
+func WithReloadDebounce(d time.Duration) Option {
+	return func(cl *configLoader) {
+		cl.debounce = d
+	}
+}
+
+// WithSecretProvider resolves setting values of the form secret://name/key
+// with p. Without one, such values are an error.
+func WithSecretProvider(p SecretProvider) Option {
+	return func(cl *configLoader) {
+		cl.secrets = p
+	}
+}
+
+// WithSecretTimeout bounds each call to the SecretProvider, so a slow
+// provider fails the load instead of blocking it. Defaults to 10s.
+func WithSecretTimeout(d time.Duration) Option {
+	return func(cl *configLoader) {
+		cl.secretTimeout = d
 	}
 }
 
@@ -0,0 +1,170 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-viper/mapstructure/v2"
+	"github.com/spf13/viper"
+)
+
+// envKeyReplacer turns nested keys such as "db.database_driver" into
+// environment variable names such as PREFIX_DB_DATABASE_DRIVER.
+var envKeyReplacer = strings.NewReplacer(".", "_")
+
+// decoderConfig decodes settings into config structs: keys come from config
+// tags, embedded structs share their parent's keys, and strings from the
+// environment or flags are converted to durations, slices, maps, and
+// encoding.TextUnmarshaler values. mapstructure squashes tagged embedded
+// structs too; decode puts those back under their own section.
+func decoderConfig(dc *mapstructure.DecoderConfig) {
+	dc.TagName = "config"
+	dc.Squash = true
+	dc.DecodeHook = mapstructure.ComposeDecodeHookFunc(
+		mapstructure.StringToTimeDurationHookFunc(),
+		stringToCollectionHook,
+		mapstructure.TextUnmarshallerHookFunc(),
+	)
+}
+
+// decode decodes the settings of v into out, a pointer to a registered
+// struct.
+func decode(v *viper.Viper, out any) error {
+	return decodeSection(v.AllSettings(), reflect.ValueOf(out))
+}
+
+// taggedEmbed is an embedded struct with a config name, which is a section of
+// its own rather than part of its parent's keys.
+type taggedEmbed struct {
+	path  []string
+	field reflect.Value
+	saved reflect.Value
+}
+
+// decodeSection decodes settings into ptr. Tagged embedded structs, which
+// mapstructure fills from the parent's keys, are reset to the values they had
+// before and decoded from their own section.
+func decodeSection(settings map[string]any, ptr reflect.Value) error {
+	var embeds []taggedEmbed
+	findTaggedEmbeds(ptr.Elem(), nil, &embeds)
+
+	dc := &mapstructure.DecoderConfig{Result: ptr.Interface(), WeaklyTypedInput: true}
+	decoderConfig(dc)
+	dec, err := mapstructure.NewDecoder(dc)
+	if err != nil {
+		return err
+	}
+	if err := dec.Decode(settings); err != nil {
+		return err
+	}
+
+	for _, e := range embeds {
+		e.field.Set(e.saved.Elem())
+		section, ok := lookupSection(settings, e.path)
+		if !ok {
+			continue
+		}
+		if err := decodeSection(section, e.field.Addr()); err != nil {
+			return fmt.Errorf("%s: %w", strings.Join(e.path, "."), err)
+		}
+	}
+	return nil
+}
+
+// findTaggedEmbeds collects the tagged embedded structs of rv, following the
+// sections and squashed structs bindStruct follows, with a copy of their
+// current values.
+func findTaggedEmbeds(rv reflect.Value, path []string, out *[]taggedEmbed) {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		name, squash := parseConfigTag(field.Tag.Get("config"))
+		if name == "-" || !(field.IsExported() || field.Anonymous) {
+			continue
+		}
+		nested, ok := nestedStruct(rv.Field(i))
+		if !ok {
+			continue
+		}
+		switch {
+		case squash || name == "" && field.Anonymous:
+			findTaggedEmbeds(nested, path, out)
+		case name != "" && field.Anonymous:
+			*out = append(*out, taggedEmbed{
+				path:  append(path[:len(path):len(path)], name),
+				field: nested,
+				saved: deepCopy(nested.Addr()),
+			})
+		case name != "":
+			findTaggedEmbeds(nested, append(path[:len(path):len(path)], name), out)
+		}
+	}
+}
+
+// lookupSection returns the settings below path.
+func lookupSection(settings map[string]any, path []string) (map[string]any, bool) {
+	for _, key := range path {
+		next, ok := settings[key].(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		settings = next
+	}
+	return settings, true
+}
+
+// stringToCollectionHook decodes a string into a slice or map. JSON is used
+// when the string starts with "[" or "{"; otherwise slices are
+// comma-separated values and maps comma-separated key=value pairs.
+func stringToCollectionHook(from, to reflect.Type, data any) (any, error) {
+	if from.Kind() != reflect.String {
+		return data, nil
+	}
+	s := strings.TrimSpace(data.(string)) //nolint:forcetypeassert // from is a string kind
+	switch to.Kind() {
+	case reflect.Slice:
+		if to.Elem().Kind() == reflect.Uint8 {
+			return data, nil
+		}
+		if strings.HasPrefix(s, "[") {
+			var out []any
+			if err := json.Unmarshal([]byte(s), &out); err != nil {
+				return nil, fmt.Errorf("decode JSON list: %w", err)
+			}
+			return out, nil
+		}
+		return splitCSV(s), nil
+	case reflect.Map:
+		if strings.HasPrefix(s, "{") {
+			var out map[string]any
+			if err := json.Unmarshal([]byte(s), &out); err != nil {
+				return nil, fmt.Errorf("decode JSON object: %w", err)
+			}
+			return out, nil
+		}
+		out := make(map[string]string)
+		for _, pair := range splitCSV(s) {
+			k, v, ok := strings.Cut(pair, "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid map entry %q, expected key=value", pair)
+			}
+			out[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+		return out, nil
+	default:
+		return data, nil
+	}
+}
+
+func splitCSV(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	parts := strings.Split(s, ",")
+	for i, part := range parts {
+		parts[i] = strings.TrimSpace(part)
+	}
+	return parts
+}
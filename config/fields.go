@@ -0,0 +1,116 @@
+package config
+
+import (
+	"encoding"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+func parseConfigTag(tag string) (name string, squash bool) {
+	name, opts, _ := strings.Cut(tag, ",")
+	for _, opt := range strings.Split(opts, ",") {
+		if opt == "squash" {
+			squash = true
+		}
+	}
+	return name, squash
+}
+
+// nestedStruct returns the struct held by fv when it should be traversed
+// rather than bound as a single value, allocating nil struct pointers.
+func nestedStruct(fv reflect.Value) (reflect.Value, bool) {
+	t := fv.Type()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if !isSection(t) {
+		return reflect.Value{}, false
+	}
+	if fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			if !fv.CanSet() {
+				return reflect.Value{}, false
+			}
+			fv.Set(reflect.New(t))
+		}
+		fv = fv.Elem()
+	}
+	return fv, true
+}
+
+// isSection reports whether t is a struct with config fields of its own, as
+// opposed to a value type such as time.Time.
+func isSection(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct || t == reflect.TypeOf(time.Time{}) ||
+		reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() && !field.Anonymous {
+			continue
+		}
+		if name, _ := parseConfigTag(field.Tag.Get("config")); name != "" && name != "-" {
+			return true
+		}
+		ft := field.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if field.Anonymous && isSection(ft) {
+			return true
+		}
+	}
+	return false
+}
+
+// deepCopy returns a pointer to a copy of the struct v points to that shares
+// no pointers, slices, or maps with it, so decoding into the copy cannot
+// change the original.
+func deepCopy(v reflect.Value) reflect.Value {
+	out := reflect.New(v.Type().Elem())
+	copyValue(out.Elem(), v.Elem())
+	return out
+}
+
+func copyValue(dst, src reflect.Value) {
+	switch src.Kind() {
+	case reflect.Ptr:
+		if src.IsNil() {
+			return
+		}
+		dst.Set(reflect.New(src.Type().Elem()))
+		copyValue(dst.Elem(), src.Elem())
+	case reflect.Struct:
+		dst.Set(src)
+		for i := 0; i < src.NumField(); i++ {
+			if dst.Field(i).CanSet() {
+				copyValue(dst.Field(i), src.Field(i))
+			}
+		}
+	case reflect.Slice:
+		if src.IsNil() {
+			return
+		}
+		dst.Set(reflect.MakeSlice(src.Type(), src.Len(), src.Len()))
+		for i := 0; i < src.Len(); i++ {
+			copyValue(dst.Index(i), src.Index(i))
+		}
+	case reflect.Map:
+		if src.IsNil() {
+			return
+		}
+		dst.Set(reflect.MakeMapWithSize(src.Type(), src.Len()))
+		iter := src.MapRange()
+		for iter.Next() {
+			elem := reflect.New(iter.Value().Type()).Elem()
+			copyValue(elem, iter.Value())
+			dst.SetMapIndex(iter.Key(), elem)
+		}
+	default:
+		dst.Set(src)
+	}
+}
@@ -1,33 +1,176 @@
 package config
 
 import (
+	"encoding"
+	"errors"
 	"fmt"
 	"reflect"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/go-viper/mapstructure/v2"
 	"github.com/spf13/pflag"
 )
 
+// NewFlagValue returns a pflag.Value for a field of rv's type. Set parses its
+// argument into that type, with the same rules as environment variables, so
+// invalid values are rejected while flags are parsed. The default shown in
+// help is rv's current value.
 func NewFlagValue(rv reflect.Value) pflag.Value {
+	return newFlagValue(rv, false)
+}
+
+// newFlagValue is NewFlagValue for a field that may be sensitive: String
+// then returns Redacted for a non-empty value, so pflag's help and errors
+// don't show it.
+func newFlagValue(rv reflect.Value, sensitive bool) *flagValue {
+	str := formatValue(rv)
 	return &flagValue{
-		rv:  rv,
-		str: fmt.Sprintf("%v", rv.Interface()),
+		typ:       rv.Type(),
+		def:       str,
+		str:       str,
+		sensitive: sensitive,
 	}
 }
 
 type flagValue struct {
-	rv  reflect.Value
-	str string
+	typ       reflect.Type
+	def       string
+	str       string
+	sensitive bool
 }
 
 func (v *flagValue) String() string {
+	if v.sensitive && v.str != "" {
+		return Redacted
+	}
 	return v.str
 }
 
+// reset restores the default the value was created with.
+func (v *flagValue) reset() {
+	v.str = v.def
+}
+
 func (v *flagValue) Set(val string) error {
+	if _, err := parseValue(val, v.typ); err != nil {
+		return err
+	}
 	v.str = val
 	return nil
 }
 
+// Type returns the name of the flag's value type shown in help. Viper casts
+// flags of the "int" and "bool" types itself; the others reach the decoder
+// as strings.
 func (v *flagValue) Type() string {
-	return v.rv.Type().String()
+	return typeName(v.typ)
+}
+
+// viperFlag hands viper a flag's raw value, which String may redact.
+type viperFlag struct {
+	flag *pflag.Flag
+}
+
+func (f viperFlag) HasChanged() bool { return f.flag.Changed }
+
+func (f viperFlag) Name() string { return f.flag.Name }
+
+func (f viperFlag) ValueString() string {
+	if v, ok := f.flag.Value.(*flagValue); ok {
+		return v.str
+	}
+	return f.flag.Value.String()
+}
+
+func (f viperFlag) ValueType() string { return f.flag.Value.Type() }
+
+// parseValue decodes s into a new value of type t.
+func parseValue(s string, t reflect.Type) (reflect.Value, error) {
+	out := reflect.New(t)
+	dc := &mapstructure.DecoderConfig{Result: out.Interface(), WeaklyTypedInput: true}
+	decoderConfig(dc)
+	dec, err := mapstructure.NewDecoder(dc)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	if err := dec.Decode(s); err != nil {
+		// drop mapstructure's framing, which names an empty field path
+		var de *mapstructure.DecodeError
+		if errors.As(err, &de) {
+			err = de.Unwrap()
+		}
+		return reflect.Value{}, fmt.Errorf("parse %q as %s: %w", s, typeName(t), err)
+	}
+	return out.Elem(), nil
+}
+
+// formatValue formats rv in the syntax parseValue accepts.
+func formatValue(rv reflect.Value) string {
+	if !rv.IsValid() {
+		return ""
+	}
+	if tm, ok := rv.Interface().(encoding.TextMarshaler); ok {
+		if rv.Kind() == reflect.Ptr && rv.IsNil() {
+			return ""
+		}
+		if text, err := tm.MarshalText(); err == nil {
+			return string(text)
+		}
+	}
+	switch rv.Kind() {
+	case reflect.String:
+		// the value itself, not what a String method such as Secret's shows
+		return rv.String()
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return ""
+		}
+		return formatValue(rv.Elem())
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return string(rv.Bytes())
+		}
+		items := make([]string, rv.Len())
+		for i := range items {
+			items[i] = formatValue(rv.Index(i))
+		}
+		return strings.Join(items, ",")
+	case reflect.Map:
+		pairs := make([]string, 0, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			pairs = append(pairs, formatValue(iter.Key())+"="+formatValue(iter.Value()))
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ",")
+	default:
+		return fmt.Sprintf("%v", rv.Interface())
+	}
+}
+
+func typeName(t reflect.Type) string {
+	switch {
+	case t == reflect.TypeOf(time.Duration(0)):
+		return "duration"
+	case reflect.PointerTo(t).Implements(textUnmarshalerType):
+		return "string"
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeName(t.Elem())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "int"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "uint"
+	case reflect.Float32, reflect.Float64:
+		return "float"
+	case reflect.Slice, reflect.Array:
+		return typeName(t.Elem()) + "s"
+	case reflect.Map:
+		return typeName(t.Key()) + "=" + typeName(t.Elem())
+	default:
+		return t.Kind().String()
+	}
 }
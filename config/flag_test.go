@@ -0,0 +1,42 @@
+package config_test
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"time"
+
+	. "github.com/nojyerac/go-lib/config"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Flags", func() {
+	DescribeTable("parse values into the field type",
+		func(field any, typ, def, valid, invalid string) {
+			v := NewFlagValue(reflect.ValueOf(field))
+			Expect(v.Type()).To(Equal(typ))
+			Expect(v.String()).To(Equal(def))
+			Expect(v.Set(valid)).To(Succeed())
+			Expect(v.String()).To(Equal(valid))
+			Expect(v.Set(invalid)).NotTo(Succeed())
+			Expect(v.String()).To(Equal(valid))
+		},
+		Entry("int", 3, "int", "3", "42", "forty-two"),
+		Entry("bool", false, "bool", "false", "true", "maybe"),
+		Entry("duration", 5*time.Second, "duration", "5s", "1m30s", "90"),
+		Entry("float", 0.5, "float", "0.5", "1.5", "one"),
+		Entry("int slice", []int{80, 443}, "ints", "80,443", "[8080, 8443]", "80,http"),
+		Entry("string map", map[string]string{"b": "2", "a": "1"}, "string=string", "a=1,b=2", "team=core", "team"),
+		Entry("text unmarshaler", net.IPv4(10, 0, 0, 1), "string", "10.0.0.1", "::1", "not-an-ip"),
+	)
+
+	It("lists every setting in the help text", func() {
+		var out bytes.Buffer
+		c.Usage(&out)
+		Expect(out.String()).To(MatchRegexp(
+			`config_dir\s+-c, --configs\s+TEST_CONFIG_DIR\s+string\s+\./config\s+dir\s+directory of config files`))
+		Expect(out.String()).To(MatchRegexp(
+			`log_config_on_init\s+-\s+TEST_LOG_CONFIG_ON_INIT\s+bool\s+false\s+-\s+log every setting once loaded`))
+	})
+})
@@ -1,33 +1,71 @@
 package config
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"reflect"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/go-playground/validator/v10"
-	"github.com/go-viper/mapstructure/v2"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
 type Loader interface {
+	// RegisterConfig binds the fields of a pointer to struct. Each struct
+	// type may be registered once, so Subscribe can tell which one changed.
+	// The struct is a snapshot: InitAndValidate writes it, Reload never does.
 	RegisterConfig(interface{}) error
+	// InitAndValidate loads every registered struct. It writes the structs in
+	// place, so call it before handing them to the code that reads them.
 	InitAndValidate() error
+	// Reload re-reads the config directory, environment and flags into fresh
+	// copies of every registered struct. If all of them decode and validate,
+	// subscribers of the ones that changed are notified with the new values;
+	// otherwise nothing changes and the error is returned.
+	//
+	// Reload does not update the registered structs: they keep the values of
+	// the last InitAndValidate, so they can be read without synchronization.
+	// Use Subscribe to receive reloaded values.
+	Reload() error
+	// Watch calls Reload whenever the config directory changes, until ctx is
+	// done. Rejected reloads are logged and the current values kept. When a
+	// reload moves config_dir, Watch follows it to the new directory.
+	Watch(ctx context.Context) error
+	// Usage writes the --help text: every setting with its key, flag, env
+	// var, default and validation rule.
+	Usage(w io.Writer)
+	// Settings returns every loaded setting, keyed like the config files,
+	// with the values of sensitive fields replaced by Redacted.
+	Settings() map[string]any
 }
 
 func NewConfigLoader(prefix string, opts ...Option) Loader {
 	cl := &configLoader{
-		v:      viper.New(),
-		logger: logrus.New(),
+		v:        viper.New(),
+		logger:   logrus.New(),
+		prefix:   prefix,
+		debounce: 100 * time.Millisecond,
+
+		secretTimeout: 10 * time.Second,
 	}
 	for _, o := range opts {
 		o(cl)
 	}
-	cl.v.SetEnvPrefix(prefix)
+	if cl.flags == nil {
+		cl.flags = pflag.NewFlagSet(filepath.Base(os.Args[0]), pflag.ExitOnError)
+	}
+	if cl.flags.Usage == nil {
+		cl.flags.Usage = func() { cl.Usage(cl.flags.Output()) }
+	}
 	cl.c = &Configuration{
 		ConfigPath: "./config",
 	}
@@ -39,75 +77,217 @@ func NewConfigLoader(prefix string, opts ...Option) Loader {
 }
 
 type configLoader struct {
-	v       *viper.Viper
-	configs []interface{}
-	logger  *logrus.Logger
-	c       *Configuration
+	v        *viper.Viper
+	configs  []interface{}
+	logger   *logrus.Logger
+	c        *Configuration
+	prefix   string
+	debounce time.Duration
+	flags    *pflag.FlagSet
+	// args are parsed instead of os.Args[1:] when set
+	args          []string
+	secrets       SecretProvider
+	secretTimeout time.Duration
+
+	// mu guards reloads of the registered structs and the fields below
+	mu sync.Mutex
+	// defaults holds a copy of each registered struct as it was registered;
+	// reloads decode onto it so keys removed from the files fall back
+	defaults []reflect.Value
+	// current holds the latest loaded copy of each registered struct, which
+	// reloads compare against instead of the registered structs
+	current     []reflect.Value
+	bindings    []binding
+	subscribers []subscriber
+	// fromSecrets holds the keys of the latest load whose values came from a
+	// _FILE variable or a secret reference; Settings redacts them
+	fromSecrets map[string]bool
+}
+
+// binding is a config key bound to the environment and, optionally, a flag.
+type binding struct {
+	key       string
+	flag      *pflag.Flag
+	sensitive bool
+	// help text
+	env, typ, def, rule, usage string
+}
+
+type subscriber struct {
+	typ reflect.Type
+	fn  func(prev, next any)
 }
 
 func (c *configLoader) RegisterConfig(conf interface{}) error {
-	c.configs = append(c.configs, conf)
 	rv := reflect.ValueOf(conf)
 	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
 		return fmt.Errorf("expected pointer to struct, but got %t", conf)
 	}
 	rv = rv.Elem()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var bindings []binding
+	if err := c.bindStruct(rv, nil, &bindings); err != nil {
+		return err
+	}
+	// check every flag before adding any, so a rejected struct leaves the
+	// flag set unchanged
+	batch := pflag.NewFlagSet("", pflag.ContinueOnError)
+	for _, b := range bindings {
+		if b.flag == nil {
+			continue
+		}
+		name := b.flag.Name
+		if c.flags.Lookup(name) != nil || batch.Lookup(name) != nil {
+			return fmt.Errorf("register %s: flag --%s is already defined", rv.Type(), name)
+		}
+		if sh := b.flag.Shorthand; sh != "" && (c.flags.ShorthandLookup(sh) != nil || batch.ShorthandLookup(sh) != nil) {
+			return fmt.Errorf("register %s: flag shorthand -%s is already defined", rv.Type(), sh)
+		}
+		batch.AddFlag(b.flag)
+	}
+	for _, registered := range c.configs {
+		if reflect.TypeOf(registered) == reflect.TypeOf(conf) {
+			return fmt.Errorf("register %s: type is already registered", rv.Type())
+		}
+	}
+	batch.VisitAll(c.flags.AddFlag)
+	c.bindings = append(c.bindings, bindings...)
+	c.configs = append(c.configs, conf)
+	c.defaults = append(c.defaults, deepCopy(rv.Addr()))
+	c.current = append(c.current, deepCopy(rv.Addr()))
+	return nil
+}
+
+// bindStruct binds the config-tagged fields of rv, a struct value, under the
+// key segments in prefix. Untagged embedded structs and fields tagged
+// ",squash" share the parent prefix; tagged struct fields, embedded or not,
+// that have config fields of their own add their name to it.
+func (c *configLoader) bindStruct(rv reflect.Value, prefix []string, out *[]binding) error {
 	rt := rv.Type()
 	for i := 0; i < rt.NumField(); i++ {
-		c.logger.WithField("field", rt.Field(i).Name).Debug("Processing config struct field")
-		if configTag := rt.Field(i).Tag.Get("config"); configTag != "" {
-			c.logger.WithField("configTag", configTag).Debug("Binding conifig var")
-			if err := c.v.BindEnv(configTag); err != nil {
-				return err
-			}
-
-			if flagTag := rt.Field(i).Tag.Get("flag"); flagTag != "" {
-				c.logger.WithField("flagTag", flagTag).Debug("Binding flag")
-				var name, shorthand, usage string
-				flagParts := strings.Split(flagTag, ",")
-				name = flagParts[0]
-				if len(flagParts) > 1 {
-					shorthand = flagParts[1]
-				}
-				if len(flagParts) > 2 {
-					usage = flagParts[2]
-				}
-				val := NewFlagValue(rv.Field(i))
-				f := &pflag.Flag{
-					Name:      name,
-					Shorthand: shorthand,
-					Usage:     usage,
-					Value:     val,
-					DefValue:  val.String(),
+		field := rt.Field(i)
+		c.logger.WithField("field", field.Name).Debug("Processing config struct field")
+		name, squash := parseConfigTag(field.Tag.Get("config"))
+		// embedded structs of unexported types still promote their fields
+		if name == "-" || !(field.IsExported() || field.Anonymous) {
+			continue
+		}
+		if nested, ok := nestedStruct(rv.Field(i)); ok {
+			switch {
+			case squash || (field.Anonymous && name == ""):
+				if err := c.bindStruct(nested, prefix, out); err != nil {
+					return err
 				}
-				if val.Type() == "bool" {
-					f.NoOptDefVal = "true"
+				continue
+			case name != "":
+				if field.Anonymous && !field.IsExported() {
+					// decode could not reset it to its own section
+					return fmt.Errorf("embedded struct %s of unexported type cannot have a config name", field.Name)
 				}
-				pflag.CommandLine.AddFlag(f)
-				if err := c.v.BindPFlag(configTag, f); err != nil {
+				if err := c.bindStruct(nested, append(prefix[:len(prefix):len(prefix)], name), out); err != nil {
 					return err
 				}
+				continue
 			}
 		}
+		if name == "" {
+			continue
+		}
+		*out = append(*out, c.bindField(rv.Field(i), field, append(prefix[:len(prefix):len(prefix)], name)))
 	}
 	return nil
 }
 
-func (c *configLoader) InitAndValidate() (err error) {
-	pflag.Parse()
-	if err = c.unmarshal(c.c); err != nil {
-		return
+func (c *configLoader) bindField(fv reflect.Value, field reflect.StructField, path []string) binding {
+	key := strings.Join(path, ".")
+	c.logger.WithField("configTag", key).Debug("Binding conifig var")
+	b := binding{
+		key:   key,
+		env:   c.envName(key),
+		typ:   typeName(fv.Type()),
+		def:   formatValue(fv),
+		rule:  field.Tag.Get("validate"),
+		usage: field.Tag.Get("usage"),
+
+		sensitive: isSensitive(field),
+	}
+	if b.sensitive && b.def != "" {
+		b.def = Redacted
+	}
+
+	if flagTag := field.Tag.Get("flag"); flagTag != "" {
+		c.logger.WithField("flagTag", flagTag).Debug("Binding flag")
+		var name, shorthand string
+		flagParts := strings.SplitN(flagTag, ",", 3)
+		name = flagParts[0]
+		if len(flagParts) > 1 {
+			shorthand = flagParts[1]
+		}
+		if len(flagParts) > 2 && b.usage == "" {
+			b.usage = flagParts[2]
+		}
+		if len(path) > 1 {
+			// nested flags are named after their section; shorthands of
+			// structs registered more than once would collide
+			name = strings.ReplaceAll(strings.Join(path[:len(path)-1], "-"), "_", "-") + "-" + name
+			shorthand = ""
+		}
+		val := newFlagValue(fv, b.sensitive)
+		f := &pflag.Flag{
+			Name:      name,
+			Shorthand: shorthand,
+			Usage:     b.usage,
+			Value:     val,
+			DefValue:  val.String(),
+		}
+		if val.Type() == "bool" {
+			f.NoOptDefVal = "true"
+		}
+		b.flag = f
+	}
+	return b
+}
+
+// InitAndValidate parses the flags and loads every registered struct. Each
+// call starts over from the flag and struct defaults, so it may be called
+// again, e.g. by tests changing the environment.
+func (c *configLoader) InitAndValidate() error {
+	if err := c.parseFlags(); err != nil {
+		return err
 	}
-	if err = c.load(); err != nil {
-		return
+	if _, err := c.apply(false); err != nil {
+		return err
 	}
 	if c.v.GetBool("log_config_on_init") {
-		c.logger.WithField("config", c.v.AllSettings()).Info("config loaded")
+		c.logger.WithField("config", c.Settings()).Info("config loaded")
+	}
+	return nil
+}
+
+// parseFlags resets the flags set by a previous parse and parses the
+// loader's args.
+func (c *configLoader) parseFlags() error {
+	c.flags.VisitAll(func(f *pflag.Flag) {
+		if !f.Changed {
+			return
+		}
+		if v, ok := f.Value.(*flagValue); ok {
+			// DefValue may be redacted
+			v.reset()
+		} else {
+			_ = f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	})
+	args := c.args
+	if args == nil {
+		args = os.Args[1:]
 	}
-	return
+	return c.flags.Parse(args)
 }
 
-func (c *configLoader) load() error {
+func newValidator() (*validator.Validate, error) {
 	validate := validator.New()
 	validate.RegisterTagNameFunc(func(fld reflect.StructField) string {
 		name := strings.SplitN(fld.Tag.Get("config"), ",", 2)[0]
@@ -118,38 +298,220 @@ func (c *configLoader) load() error {
 	})
 	for tag, v := range customValidators {
 		if err := validate.RegisterValidation(tag, v); err != nil {
-			return err
+			return nil, err
 		}
 	}
+	return validate, nil
+}
 
-	configFiles, err := os.ReadDir(c.c.ConfigPath)
+func mergeConfigFiles(v *viper.Viper, dir string) error {
+	configFiles, err := os.ReadDir(dir)
 	if err != nil {
 		return err
 	}
 	for _, fileInfo := range configFiles {
 		if strings.Contains(fileInfo.Name(), "config.") {
-			c.v.SetConfigFile(filepath.Join(c.c.ConfigPath, fileInfo.Name()))
-			if mergeErr := c.v.MergeInConfig(); mergeErr != nil {
+			v.SetConfigFile(filepath.Join(dir, fileInfo.Name()))
+			if mergeErr := v.MergeInConfig(); mergeErr != nil {
 				return mergeErr
 			}
 		}
 	}
+	return nil
+}
 
-	for _, conf := range c.configs {
-		if err = c.unmarshal(conf); err == nil {
-			if err = validate.Struct(conf); err == nil {
-				continue
+func (c *configLoader) Reload() error {
+	notify, err := c.apply(true)
+	if err != nil {
+		return err
+	}
+	// subscribers run outside the lock so they may read the loader
+	for _, fn := range notify {
+		fn()
+	}
+	return nil
+}
+
+// apply loads a new set of values. The initial load writes them to the
+// registered structs; a reload only records them and returns the pending
+// notifications of the structs that changed.
+func (c *configLoader) apply(reload bool) ([]func(), error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	v, err := c.newViper()
+	if err != nil {
+		return nil, err
+	}
+	// the config directory itself comes from the flags and environment
+	base, _ := deepCopy(c.defaults[0]).Interface().(*Configuration)
+	if err = decode(v, base); err != nil {
+		return nil, err
+	}
+	if err = mergeConfigFiles(v, base.ConfigPath); err != nil {
+		return nil, err
+	}
+	fromSecrets, err := c.resolveSecrets(v)
+	if err != nil {
+		return nil, err
+	}
+	validate, err := newValidator()
+	if err != nil {
+		return nil, err
+	}
+	verb := "load"
+	if reload {
+		verb = "reload"
+	}
+
+	next := make([]reflect.Value, len(c.configs))
+	for i, defaults := range c.defaults {
+		candidate := deepCopy(defaults)
+		if err = decode(v, candidate.Interface()); err == nil {
+			err = validate.Struct(candidate.Interface())
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", verb, candidate.Type().Elem(), err)
+		}
+		next[i] = candidate.Elem()
+	}
+
+	var notify []func()
+	for i, conf := range c.configs {
+		prev := c.current[i].Elem().Interface()
+		c.current[i] = next[i].Addr()
+		if !reload {
+			reflect.ValueOf(conf).Elem().Set(deepCopy(next[i].Addr()).Elem())
+			continue
+		}
+		if reflect.DeepEqual(prev, next[i].Interface()) {
+			continue
+		}
+		typ := next[i].Type()
+		c.logger.WithField("config", typ.String()).Info("config reloaded")
+		for _, sub := range c.subscribers {
+			if sub.typ == typ {
+				fn, nextValue := sub.fn, next[i].Interface()
+				notify = append(notify, func() { fn(prev, nextValue) })
 			}
 		}
+	}
+	c.v, c.fromSecrets = v, fromSecrets
+	return notify, nil
+}
+
+// configDir returns the config directory of the latest load.
+func (c *configLoader) configDir() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	base, _ := c.current[0].Interface().(*Configuration)
+	return base.ConfigPath
+}
+
+// newViper returns a viper instance with the environment and flag bindings of
+// every registered struct.
+func (c *configLoader) newViper() (*viper.Viper, error) {
+	v := viper.New()
+	v.SetEnvPrefix(c.prefix)
+	v.SetEnvKeyReplacer(envKeyReplacer)
+	for _, b := range c.bindings {
+		if err := v.BindEnv(b.key); err != nil {
+			return nil, err
+		}
+		if b.flag == nil {
+			continue
+		}
+		if err := v.BindFlagValue(b.key, viperFlag{b.flag}); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+func (c *configLoader) Watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
 		return err
 	}
-	return nil
+	defer watcher.Close()
+
+	dir := c.configDir()
+	// watch the directory rather than the files so that editors replacing a
+	// file and Kubernetes swapping the ..data symlink are both seen
+	if err = watcher.Add(dir); err != nil {
+		return err
+	}
+
+	var settle <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case evt, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if evt.Has(fsnotify.Chmod) && !evt.Has(fsnotify.Write) {
+				continue
+			}
+			// editors often write a file in several steps; reload once they settle
+			settle = time.After(c.debounce)
+		case watchErr, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			c.logger.WithError(watchErr).Warn("config watch error")
+		case <-settle:
+			settle = nil
+			if reloadErr := c.Reload(); reloadErr != nil {
+				c.logger.WithError(reloadErr).Error("config reload rejected, keeping current values")
+				continue
+			}
+			dir = c.follow(watcher, dir)
+		}
+	}
+}
+
+// follow moves watcher from dir to the config directory of the latest
+// reload, if it changed, and returns the directory now watched.
+func (c *configLoader) follow(watcher *fsnotify.Watcher, dir string) string {
+	next := c.configDir()
+	if next == dir {
+		return dir
+	}
+	if err := watcher.Add(next); err != nil {
+		c.logger.WithError(err).WithField("dir", next).Error("cannot watch the new config directory")
+		return dir
+	}
+	_ = watcher.Remove(dir)
+	c.logger.WithField("dir", next).Info("watching the new config directory")
+	return next
 }
 
-func withTagName(tn string) viper.DecoderConfigOption {
-	return func(dc *mapstructure.DecoderConfig) { dc.TagName = tn }
+func (c *configLoader) subscribe(typ reflect.Type, fn func(prev, next any)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, conf := range c.configs {
+		if reflect.TypeOf(conf).Elem() == typ {
+			c.subscribers = append(c.subscribers, subscriber{typ: typ, fn: fn})
+			return nil
+		}
+	}
+	return fmt.Errorf("config %s is not registered", typ)
 }
 
-func (c *configLoader) unmarshal(dest interface{}) error {
-	return c.v.Unmarshal(dest, withTagName("config"))
+// Subscribe calls fn with the previous and new values of the registered *T
+// after every reload that changes it. This is the only way reloaded values
+// are delivered: the registered struct keeps the values of InitAndValidate. T
+// must have been registered with RegisterConfig. Callbacks run on the
+// goroutine calling Reload, in the order they were subscribed, once the whole
+// set has been validated.
+func Subscribe[T any](l Loader, fn func(prev, next T)) error {
+	cl, ok := l.(*configLoader)
+	if !ok {
+		return errors.New("loader was not created by NewConfigLoader")
+	}
+	return cl.subscribe(reflect.TypeOf((*T)(nil)).Elem(), func(prev, next any) {
+		fn(prev.(T), next.(T)) //nolint:forcetypeassert // subscribe matched the type
+	})
 }
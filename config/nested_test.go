@@ -0,0 +1,163 @@
+package config_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/nojyerac/go-lib/config"
+	"github.com/nojyerac/go-lib/log"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type nestedCommon struct {
+	Region string `config:"nested_region"`
+}
+
+type nestedDB struct {
+	MaxOpenConnections int           `config:"max_open_connections" flag:"max-open,m,maximum open connections"`
+	Hosts              []string      `config:"hosts"`
+	Timeout            time.Duration `config:"timeout"`
+}
+
+type nestedCache struct {
+	TTL time.Duration `config:"ttl"`
+}
+
+type nestedOrders struct {
+	nestedCommon
+	DB     nestedDB          `config:"db"`
+	Cache  *nestedCache      `config:"cache"`
+	Ports  []int             `config:"ports"`
+	Labels map[string]string `config:"labels"`
+}
+
+type nestedConfig struct {
+	Orders nestedOrders `config:"orders"`
+}
+
+// TaggedDB is embedded under a config name, like db.Configuration in a
+// service config.
+type TaggedDB struct {
+	MaxOpenConnections int           `config:"database_max_open_connections"`
+	Timeout            time.Duration `config:"timeout"`
+}
+
+type taggedEmbedConfig struct {
+	TaggedDB `config:"db"`
+	Timeout  time.Duration `config:"timeout"`
+}
+
+var _ = Describe("Nested config", func() {
+	var (
+		dir  string
+		c    Loader
+		conf *nestedConfig
+	)
+
+	setenv := func(key, value string) {
+		Expect(os.Setenv(key, value)).To(Succeed())
+		DeferCleanup(os.Unsetenv, key)
+	}
+
+	newLoader := func(args ...string) (Loader, *nestedConfig) {
+		l := NewConfigLoader("test", WithLogger(log.Nop()), WithArgs(append([]string{"-c", dir}, args...)...))
+		cfg := &nestedConfig{Orders: nestedOrders{
+			DB: nestedDB{MaxOpenConnections: 10, Hosts: []string{"localhost"}},
+		}}
+		Expect(l.RegisterConfig(cfg)).To(Succeed())
+		return l, cfg
+	}
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		Expect(os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(`
+orders:
+  nested_region: eu-west-1
+  db:
+    timeout: 2s
+  cache:
+    ttl: 1m
+`), 0o600)).To(Succeed())
+		c, conf = newLoader()
+		Expect(conf.Orders.Cache).NotTo(BeNil())
+	})
+
+	It("reads nested and embedded keys from the config files", func() {
+		Expect(c.InitAndValidate()).To(Succeed())
+		Expect(conf.Orders.Region).To(Equal("eu-west-1"))
+		Expect(conf.Orders.DB).To(Equal(nestedDB{
+			MaxOpenConnections: 10, Hosts: []string{"localhost"}, Timeout: 2 * time.Second,
+		}))
+		Expect(conf.Orders.Cache.TTL).To(Equal(time.Minute))
+	})
+
+	It("composes env var names from the key path", func() {
+		setenv("TEST_ORDERS_DB_MAX_OPEN_CONNECTIONS", "25")
+		setenv("TEST_ORDERS_CACHE_TTL", "30s")
+		setenv("TEST_ORDERS_NESTED_REGION", "us-east-1")
+
+		Expect(c.InitAndValidate()).To(Succeed())
+		Expect(conf.Orders.DB.MaxOpenConnections).To(Equal(25))
+		Expect(conf.Orders.Cache.TTL).To(Equal(30 * time.Second))
+		Expect(conf.Orders.Region).To(Equal("us-east-1"))
+	})
+
+	DescribeTable("decodes collections from env",
+		func(hosts, ports, labels string) {
+			setenv("TEST_ORDERS_DB_HOSTS", hosts)
+			setenv("TEST_ORDERS_PORTS", ports)
+			setenv("TEST_ORDERS_LABELS", labels)
+
+			Expect(c.InitAndValidate()).To(Succeed())
+			Expect(conf.Orders.DB.Hosts).To(Equal([]string{"db-1", "db-2"}))
+			Expect(conf.Orders.Ports).To(Equal([]int{80, 443}))
+			Expect(conf.Orders.Labels).To(Equal(map[string]string{"team": "core", "tier": "1"}))
+		},
+		Entry("as CSV", "db-1, db-2", "80,443", "team=core, tier=1"),
+		Entry("as JSON", `["db-1","db-2"]`, "[80, 443]", `{"team":"core","tier":"1"}`),
+	)
+
+	It("rejects malformed maps", func() {
+		setenv("TEST_ORDERS_LABELS", "team")
+		Expect(c.InitAndValidate()).To(MatchError(ContainSubstring(`invalid map entry "team"`)))
+	})
+
+	It("names flags of nested fields after their section", func() {
+		l, cfg := newLoader("--orders-db-max-open", "40")
+		Expect(l.InitAndValidate()).To(Succeed())
+		Expect(cfg.Orders.DB.MaxOpenConnections).To(Equal(40))
+
+		var out bytes.Buffer
+		l.Usage(&out)
+		Expect(out.String()).To(MatchRegexp(`orders\.db\.max_open_connections\s+--orders-db-max-open\s`))
+	})
+
+	Describe("tagged embedded structs", func() {
+		It("decodes them under their own section", func() {
+			Expect(os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(`
+timeout: 5s
+db:
+  timeout: 2s
+`), 0o600)).To(Succeed())
+			setenv("TEST_DB_DATABASE_MAX_OPEN_CONNECTIONS", "42")
+			l := NewConfigLoader("test", WithLogger(log.Nop()), WithArgs("-c", dir))
+			cfg := &taggedEmbedConfig{TaggedDB: TaggedDB{MaxOpenConnections: 10}}
+			Expect(l.RegisterConfig(cfg)).To(Succeed())
+
+			Expect(l.InitAndValidate()).To(Succeed())
+			Expect(cfg.TaggedDB).To(Equal(TaggedDB{MaxOpenConnections: 42, Timeout: 2 * time.Second}))
+			Expect(cfg.Timeout).To(Equal(5 * time.Second))
+		})
+
+		It("rejects embedded structs of unexported types", func() {
+			type tagged struct {
+				nestedCommon `config:"common"`
+			}
+			l := NewConfigLoader("test", WithLogger(log.Nop()), WithArgs("-c", dir))
+			Expect(l.RegisterConfig(&tagged{})).To(MatchError(ContainSubstring("nestedCommon")))
+		})
+	})
+})
@@ -0,0 +1,195 @@
+package config_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	. "github.com/nojyerac/go-lib/config"
+	"github.com/nojyerac/go-lib/log"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type limitsConfig struct {
+	LogLevel  string `config:"reload_log_level" validate:"oneof=debug info warn"`
+	RateLimit int    `config:"reload_rate_limit" validate:"gte=1"`
+}
+
+type serviceConfig struct {
+	Name string `config:"reload_service_name" validate:"required"`
+}
+
+type changes[T any] struct {
+	mu   sync.Mutex
+	seen [][2]T
+}
+
+func (c *changes[T]) record(prev, next T) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seen = append(c.seen, [2]T{prev, next})
+}
+
+func (c *changes[T]) get() [][2]T {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([][2]T(nil), c.seen...)
+}
+
+var _ = Describe("Reload", Ordered, func() {
+	var (
+		dir      string
+		c        Loader
+		limits   = &limitsConfig{LogLevel: "info", RateLimit: 10}
+		service  = &serviceConfig{Name: "orders"}
+		limitsCh *changes[limitsConfig]
+		svcCh    *changes[serviceConfig]
+	)
+
+	writeConfig := func(content string) {
+		// write and rename so a watcher never sees a partial file
+		tmp := filepath.Join(dir, ".tmp")
+		Expect(os.WriteFile(tmp, []byte(content), 0o600)).To(Succeed())
+		Expect(os.Rename(tmp, filepath.Join(dir, "config.yaml"))).To(Succeed())
+	}
+
+	BeforeAll(func() {
+		dir = GinkgoT().TempDir()
+		writeConfig("reload_log_level: info\nreload_rate_limit: 10\n")
+		c = NewConfigLoader("test", WithLogger(log.Nop()), WithArgs("-c", dir))
+		Expect(c.RegisterConfig(limits)).To(Succeed())
+		Expect(c.RegisterConfig(service)).To(Succeed())
+		limitsCh = &changes[limitsConfig]{}
+		svcCh = &changes[serviceConfig]{}
+		Expect(Subscribe(c, limitsCh.record)).To(Succeed())
+		Expect(Subscribe(c, svcCh.record)).To(Succeed())
+		Expect(c.InitAndValidate()).To(Succeed())
+	})
+
+	latest := func() limitsConfig {
+		seen := limitsCh.get()
+		return seen[len(seen)-1][1]
+	}
+
+	It("notifies subscribers of changed structs", func() {
+		writeConfig("reload_log_level: debug\nreload_rate_limit: 20\n")
+		Expect(c.Reload()).To(Succeed())
+
+		Expect(*limits).To(Equal(limitsConfig{LogLevel: "info", RateLimit: 10}), "registered structs are not written")
+		Expect(limitsCh.get()).To(Equal([][2]limitsConfig{{
+			{LogLevel: "info", RateLimit: 10},
+			{LogLevel: "debug", RateLimit: 20},
+		}}))
+		Expect(svcCh.get()).To(BeEmpty())
+	})
+
+	It("rejects the whole set when any struct is invalid", func() {
+		before := len(limitsCh.get())
+		writeConfig("reload_log_level: warn\nreload_service_name: \"\"\n")
+
+		Expect(c.Reload()).To(MatchError(ContainSubstring("reload_service_name")))
+		Expect(limitsCh.get()).To(HaveLen(before))
+		Expect(svcCh.get()).To(BeEmpty())
+	})
+
+	It("falls back to the registered defaults for removed keys", func() {
+		writeConfig("reload_log_level: warn\n")
+		Expect(c.Reload()).To(Succeed())
+		Expect(latest()).To(Equal(limitsConfig{LogLevel: "warn", RateLimit: 10}))
+	})
+
+	It("can be read while reloading", func() {
+		stop := make(chan struct{})
+		read := make(chan struct{})
+		go func() {
+			defer close(read)
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					_ = limits.LogLevel + service.Name
+					_ = c.Settings()
+				}
+			}
+		}()
+		for i := range 20 {
+			writeConfig(fmt.Sprintf("reload_log_level: warn\nreload_rate_limit: %d\n", i+1))
+			Expect(c.Reload()).To(Succeed())
+		}
+		close(stop)
+		<-read
+		Expect(latest().RateLimit).To(Equal(20))
+	})
+
+	It("reloads when the directory changes while watching", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() { done <- c.Watch(ctx) }()
+		DeferCleanup(func() {
+			cancel()
+			Eventually(done).Should(Receive(MatchError(context.Canceled)))
+		})
+
+		// the watcher is added asynchronously; keep replacing the file, more
+		// slowly than the reload debounce, until the change is seen
+		Eventually(func() limitsConfig {
+			writeConfig("reload_log_level: debug\nreload_rate_limit: 5\n")
+			return latest()
+		}).WithPolling(250 * time.Millisecond).WithTimeout(5 * time.Second).
+			Should(Equal(limitsConfig{LogLevel: "debug", RateLimit: 5}))
+	})
+
+	It("follows the config directory when a reload moves it", func() {
+		first, moved := GinkgoT().TempDir(), GinkgoT().TempDir()
+		write := func(dir, content string) {
+			tmp := filepath.Join(dir, ".tmp")
+			Expect(os.WriteFile(tmp, []byte(content), 0o600)).To(Succeed())
+			Expect(os.Rename(tmp, filepath.Join(dir, "config.yaml"))).To(Succeed())
+		}
+		write(first, "reload_service_name: first\n")
+		write(moved, "reload_service_name: moved\n")
+
+		// without a --configs flag, the directory comes from the environment
+		GinkgoT().Setenv("MOVING_CONFIG_DIR", first)
+		l := NewConfigLoader("moving", WithLogger(log.Nop()), WithArgs())
+		Expect(l.RegisterConfig(&serviceConfig{})).To(Succeed())
+		seen := &changes[serviceConfig]{}
+		Expect(Subscribe(l, seen.record)).To(Succeed())
+		Expect(l.InitAndValidate()).To(Succeed())
+		name := func() string {
+			s := seen.get()
+			if len(s) == 0 {
+				return ""
+			}
+			return s[len(s)-1][1].Name
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() { done <- l.Watch(ctx) }()
+		DeferCleanup(func() {
+			cancel()
+			Eventually(done).Should(Receive(MatchError(context.Canceled)))
+		})
+
+		GinkgoT().Setenv("MOVING_CONFIG_DIR", moved)
+		Eventually(func() string {
+			write(first, "reload_service_name: first\n")
+			return name()
+		}).WithPolling(250 * time.Millisecond).WithTimeout(5 * time.Second).Should(Equal("moved"))
+
+		Eventually(func() string {
+			write(moved, "reload_service_name: moved-again\n")
+			return name()
+		}).WithPolling(250 * time.Millisecond).WithTimeout(5 * time.Second).Should(Equal("moved-again"))
+	})
+
+	It("rejects subscriptions to unregistered structs", func() {
+		Expect(Subscribe(c, func(_, _ struct{ X int }) {})).To(MatchError(ContainSubstring("is not registered")))
+	})
+})
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// SecretScheme prefixes setting values that reference a secret, in the form
+// secret://name/key.
+const SecretScheme = "secret://"
+
+// ErrSecretNotFound is returned by a SecretProvider for an unknown secret.
+var ErrSecretNotFound = errors.New("secret not found")
+
+// SecretProvider resolves the secret references of a loader. It is called at
+// every load and reload for each setting whose value is a reference.
+type SecretProvider interface {
+	// Secret returns the value of key in the secret name.
+	Secret(ctx context.Context, name, key string) (string, error)
+}
+
+// NewFileSecretProvider returns a SecretProvider that reads secret://name/key
+// from the file dir/name/key, the layout of Kubernetes secrets mounted as
+// volumes. A trailing newline is removed.
+func NewFileSecretProvider(dir string) SecretProvider {
+	return fileSecretProvider{dir: dir}
+}
+
+type fileSecretProvider struct {
+	dir string
+}
+
+func (p fileSecretProvider) Secret(_ context.Context, name, key string) (string, error) {
+	path := filepath.Join(name, key)
+	if !filepath.IsLocal(path) || strings.ContainsRune(name, filepath.Separator) {
+		return "", fmt.Errorf("invalid secret path %q", path)
+	}
+	value, err := readSecretFile(filepath.Join(p.dir, path))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("%w: %s", ErrSecretNotFound, path)
+	}
+	return value, err
+}
+
+func readSecretFile(path string) (string, error) {
+	raw, err := os.ReadFile(path) //nolint:gosec // path comes from configuration
+	if err != nil {
+		return "", err
+	}
+	value := strings.TrimSuffix(string(raw), "\n")
+	return strings.TrimSuffix(value, "\r"), nil
+}
+
+// resolveSecrets applies the <ENV>_FILE variables of every binding to v and
+// then replaces secret references with their values. A _FILE variable has the
+// precedence of the env var it stands for, so a flag still overrides it. It
+// returns the keys set either way, which are treated as sensitive.
+func (c *configLoader) resolveSecrets(v *viper.Viper) (map[string]bool, error) {
+	resolved := make(map[string]bool)
+	for _, b := range c.bindings {
+		if path, ok := os.LookupEnv(b.env + "_FILE"); ok && (b.flag == nil || !b.flag.Changed) {
+			if _, set := os.LookupEnv(b.env); set {
+				return nil, fmt.Errorf("%s and %s_FILE are both set", b.env, b.env)
+			}
+			value, err := readSecretFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("read %s_FILE: %w", b.env, err)
+			}
+			v.Set(b.key, value)
+			resolved[b.key] = true
+		}
+
+		ref, ok := v.Get(b.key).(string)
+		if !ok || !strings.HasPrefix(ref, SecretScheme) {
+			continue
+		}
+		name, key, ok := strings.Cut(strings.TrimPrefix(ref, SecretScheme), "/")
+		if !ok || name == "" || key == "" {
+			return nil, fmt.Errorf("%s: invalid secret reference %q, expected %sname/key", b.key, ref, SecretScheme)
+		}
+		if c.secrets == nil {
+			return nil, fmt.Errorf("%s: no secret provider to resolve %q", b.key, ref)
+		}
+		value, err := c.secret(name, key)
+		if err != nil {
+			return nil, fmt.Errorf("%s: resolve %q: %w", b.key, ref, err)
+		}
+		v.Set(b.key, value)
+		resolved[b.key] = true
+	}
+	return resolved, nil
+}
+
+// secret calls the provider with a ctx bounded by the secret timeout. The
+// call is abandoned once ctx is done, even if the provider ignores ctx.
+func (c *configLoader) secret(name, key string) (string, error) {
+	ctx := context.Background()
+	if c.secretTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.secretTimeout)
+		defer cancel()
+	}
+	type result struct {
+		value string
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		value, err := c.secrets.Secret(ctx, name, key)
+		done <- result{value, err}
+	}()
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
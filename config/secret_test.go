@@ -0,0 +1,132 @@
+package config_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/nojyerac/go-lib/config"
+	"github.com/nojyerac/go-lib/log"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/types"
+	"github.com/spf13/pflag"
+)
+
+// blockingProvider never answers, whatever its ctx.
+type blockingProvider struct{}
+
+func (blockingProvider) Secret(context.Context, string, string) (string, error) {
+	select {}
+}
+
+type secretConfig struct {
+	Token string `config:"secret_token" flag:"token"`
+	DSN   string `config:"secret_dsn"`
+}
+
+var _ = Describe("Secrets", func() {
+	var (
+		configDir, secretDir string
+		opts                 []Option
+		args                 []string
+		conf                 *secretConfig
+	)
+
+	setenv := func(key, value string) {
+		Expect(os.Setenv(key, value)).To(Succeed())
+		DeferCleanup(os.Unsetenv, key)
+	}
+
+	writeFile := func(path, content string) {
+		Expect(os.MkdirAll(filepath.Dir(path), 0o700)).To(Succeed())
+		Expect(os.WriteFile(path, []byte(content), 0o600)).To(Succeed())
+	}
+
+	load := func() (Loader, error) {
+		l := NewConfigLoader("test", append([]Option{
+			WithLogger(log.Nop()),
+			WithFlagSet(pflag.NewFlagSet("test", pflag.ContinueOnError)),
+			WithArgs(append([]string{"-c", configDir}, args...)...),
+		}, opts...)...)
+		conf = &secretConfig{}
+		Expect(l.RegisterConfig(conf)).To(Succeed())
+		return l, l.InitAndValidate()
+	}
+
+	BeforeEach(func() {
+		configDir, secretDir = GinkgoT().TempDir(), GinkgoT().TempDir()
+		writeFile(filepath.Join(configDir, "config.yaml"), "secret_dsn: secret://db/dsn\n")
+		writeFile(filepath.Join(secretDir, "db", "dsn"), "postgres://orders\n")
+		opts, args = []Option{WithSecretProvider(NewFileSecretProvider(secretDir))}, nil
+	})
+
+	Describe("_FILE variables", func() {
+		BeforeEach(func() {
+			writeFile(filepath.Join(secretDir, "token"), "s3cret\n")
+			setenv("TEST_SECRET_TOKEN_FILE", filepath.Join(secretDir, "token"))
+		})
+
+		It("read the setting from the file", func() {
+			l, err := load()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(conf.Token).To(Equal("s3cret"))
+			Expect(l.Settings()).To(HaveKeyWithValue("secret_token", Redacted))
+		})
+
+		It("are overridden by flags", func() {
+			args = []string{"--token", "from-flag"}
+			_, err := load()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(conf.Token).To(Equal("from-flag"))
+		})
+
+		It("conflict with the plain env var", func() {
+			setenv("TEST_SECRET_TOKEN", "plain")
+			_, err := load()
+			Expect(err).To(MatchError("TEST_SECRET_TOKEN and TEST_SECRET_TOKEN_FILE are both set"))
+		})
+	})
+
+	It("resolves references from files and env vars", func() {
+		writeFile(filepath.Join(secretDir, "api", "token"), "t0ken")
+		setenv("TEST_SECRET_TOKEN", "secret://api/token")
+
+		l, err := load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*conf).To(Equal(secretConfig{Token: "t0ken", DSN: "postgres://orders"}))
+		Expect(l.Settings()).To(HaveKeyWithValue("secret_token", Redacted))
+		Expect(l.Settings()).To(HaveKeyWithValue("secret_dsn", Redacted))
+
+		By("resolving them again on reload")
+		var reloaded secretConfig
+		Expect(Subscribe(l, func(_, next secretConfig) { reloaded = next })).To(Succeed())
+		writeFile(filepath.Join(secretDir, "db", "dsn"), "postgres://rotated\n")
+		Expect(l.Reload()).To(Succeed())
+		Expect(reloaded.DSN).To(Equal("postgres://rotated"))
+	})
+
+	DescribeTable("rejects unresolvable references",
+		func(ref string, expected types.GomegaMatcher) {
+			setenv("TEST_SECRET_TOKEN", ref)
+			_, err := load()
+			Expect(err).To(expected)
+		},
+		Entry("missing secret", "secret://api/none", MatchError(ErrSecretNotFound)),
+		Entry("malformed", "secret://api", MatchError(ContainSubstring("invalid secret reference"))),
+		Entry("outside the directory", "secret://../token", MatchError(ContainSubstring("invalid secret path"))),
+	)
+
+	It("gives up on a provider that does not answer", func() {
+		opts = []Option{WithSecretProvider(blockingProvider{}), WithSecretTimeout(10 * time.Millisecond)}
+		_, err := load()
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+	})
+
+	It("requires a provider for references", func() {
+		opts = nil
+		_, err := load()
+		Expect(err).To(MatchError(ContainSubstring(`secret_dsn: no secret provider to resolve "secret://db/dsn"`)))
+	})
+})
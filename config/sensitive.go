@@ -0,0 +1,78 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// Redacted replaces the value of sensitive settings in dumps, logs and help.
+const Redacted = "[REDACTED]"
+
+var secretType = reflect.TypeOf(Secret(""))
+
+// Secret is a string setting that redacts itself when printed, logged or
+// marshaled to JSON. Value returns the secret itself. Fields of type Secret
+// are sensitive without a sensitive tag.
+type Secret string
+
+// Value returns the secret.
+func (s Secret) Value() string {
+	return string(s)
+}
+
+// String returns Redacted, or "" for an empty secret.
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return Redacted
+}
+
+// GoString redacts the secret from %#v.
+func (s Secret) GoString() string {
+	return `config.Secret("` + s.String() + `")`
+}
+
+// MarshalJSON encodes the redacted secret.
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+func isSensitive(field reflect.StructField) bool {
+	t := field.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t == secretType || field.Tag.Get("sensitive") == "true"
+}
+
+func (c *configLoader) Settings() map[string]any {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	settings := c.v.AllSettings()
+	for _, b := range c.bindings {
+		if b.sensitive || c.fromSecrets[b.key] {
+			redact(settings, strings.Split(b.key, "."))
+		}
+	}
+	return settings
+}
+
+// redact replaces the non-empty value at path in settings, a tree of maps as
+// returned by viper.AllSettings.
+func redact(settings map[string]any, path []string) {
+	value, ok := settings[path[0]]
+	if !ok {
+		return
+	}
+	if len(path) > 1 {
+		if nested, isMap := value.(map[string]any); isMap {
+			redact(nested, path[1:])
+		}
+		return
+	}
+	if value != nil && value != "" {
+		settings[path[0]] = Redacted
+	}
+}
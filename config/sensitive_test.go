@@ -0,0 +1,120 @@
+package config_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	. "github.com/nojyerac/go-lib/config"
+	"github.com/nojyerac/go-lib/log"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+)
+
+type sensitiveDB struct {
+	Password string `config:"password" sensitive:"true"`
+	Host     string `config:"host"`
+}
+
+type sensitiveConfig struct {
+	APIKey Secret      `config:"sensitive_api_key" flag:"api-key"`
+	Token  string      `config:"sensitive_token" sensitive:"true"`
+	DB     sensitiveDB `config:"sensitive_db"`
+}
+
+var _ = Describe("Sensitive settings", func() {
+	It("redact Secret values when printed or marshaled", func() {
+		s := Secret("hunter2")
+		Expect(s.Value()).To(Equal("hunter2"))
+		Expect(fmt.Sprintf("%v %s %#v", s, s, s)).To(Equal(`[REDACTED] [REDACTED] config.Secret("[REDACTED]")`))
+		Expect(json.Marshal(struct{ S Secret }{s})).To(MatchJSON(`{"S": "[REDACTED]"}`))
+		Expect(Secret("").String()).To(BeEmpty())
+
+		var out bytes.Buffer
+		logger := logrus.New()
+		logger.SetOutput(&out)
+		logger.SetFormatter(&logrus.JSONFormatter{})
+		logger.WithField("key", s).Info("test")
+		Expect(out.String()).To(ContainSubstring(`"key":"[REDACTED]"`))
+		Expect(out.String()).NotTo(ContainSubstring("hunter2"))
+	})
+
+	Describe("in a loader", func() {
+		var (
+			out  bytes.Buffer
+			l    Loader
+			fs   *pflag.FlagSet
+			conf *sensitiveConfig
+		)
+
+		setenv := func(key, value string) {
+			Expect(os.Setenv(key, value)).To(Succeed())
+			DeferCleanup(os.Unsetenv, key)
+		}
+
+		BeforeEach(func() {
+			out.Reset()
+			logger := logrus.New()
+			logger.SetOutput(&out)
+			fs = pflag.NewFlagSet("test", pflag.ContinueOnError)
+			l = NewConfigLoader("test", WithLogger(logger), WithArgs("-c", "./testdata"), WithFlagSet(fs))
+			conf = &sensitiveConfig{APIKey: "default-key"}
+			Expect(l.RegisterConfig(conf)).To(Succeed())
+
+			setenv("TEST_SENSITIVE_TOKEN", "t0ken")
+			setenv("TEST_SENSITIVE_DB_PASSWORD", "pa55word")
+			setenv("TEST_SENSITIVE_DB_HOST", "db.internal")
+			Expect(l.InitAndValidate()).To(Succeed())
+		})
+
+		It("loads the real values", func() {
+			Expect(conf.APIKey.Value()).To(Equal("default-key"))
+			Expect(conf.Token).To(Equal("t0ken"))
+			Expect(conf.DB.Password).To(Equal("pa55word"))
+		})
+
+		It("masks them in the settings and the init dump", func() {
+			settings := l.Settings()
+			Expect(settings).To(HaveKeyWithValue("sensitive_token", Redacted))
+			Expect(settings).To(HaveKeyWithValue("sensitive_api_key", Redacted))
+			Expect(settings).To(HaveKeyWithValue("sensitive_db", map[string]any{
+				"password": Redacted, "host": "db.internal",
+			}))
+
+			Expect(out.String()).To(ContainSubstring("config loaded"))
+			for _, secret := range []string{"default-key", "t0ken", "pa55word"} {
+				Expect(out.String()).NotTo(ContainSubstring(secret))
+			}
+		})
+
+		It("masks defaults in the help text", func() {
+			var help bytes.Buffer
+			l.Usage(&help)
+			Expect(help.String()).To(MatchRegexp(
+				`sensitive_api_key\s+--api-key\s+TEST_SENSITIVE_API_KEY\s+string\s+\[REDACTED\]`))
+			Expect(help.String()).NotTo(ContainSubstring("default-key"))
+		})
+
+		It("masks defaults in the flag set's own usage", func() {
+			Expect(fs.FlagUsages()).To(MatchRegexp(`--api-key string\s+\(default "\[REDACTED\]"\)`))
+			Expect(fs.FlagUsages()).NotTo(ContainSubstring("default-key"))
+			Expect(fs.Lookup("api-key").Value.String()).To(Equal(Redacted))
+		})
+
+		It("loads flag values unmasked and resets them on the next parse", func() {
+			Expect(fs.Set("api-key", "flag-key")).To(Succeed())
+			Expect(l.InitAndValidate()).To(Succeed())
+			Expect(conf.APIKey.Value()).To(Equal("default-key"))
+
+			l = NewConfigLoader("test", WithLogger(log.Nop()), WithArgs("-c", "./testdata", "--api-key", "flag-key"),
+				WithFlagSet(pflag.NewFlagSet("test", pflag.ContinueOnError)))
+			conf = &sensitiveConfig{APIKey: "default-key"}
+			Expect(l.RegisterConfig(conf)).To(Succeed())
+			Expect(l.InitAndValidate()).To(Succeed())
+			Expect(conf.APIKey.Value()).To(Equal("flag-key"))
+		})
+	})
+})
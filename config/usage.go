@@ -0,0 +1,52 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+func (c *configLoader) envName(key string) string {
+	name := envKeyReplacer.Replace(key)
+	if c.prefix != "" {
+		name = c.prefix + "_" + name
+	}
+	return strings.ToUpper(name)
+}
+
+func (c *configLoader) Usage(w io.Writer) {
+	c.mu.Lock()
+	bindings := append([]binding(nil), c.bindings...)
+	c.mu.Unlock()
+
+	fmt.Fprintf(w, "Usage of %s:\n\n", filepath.Base(os.Args[0]))
+	fmt.Fprintln(w, "Settings are read from flags, then env vars, then config files, then defaults.")
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tFLAG\tENV\tTYPE\tDEFAULT\tVALIDATE\tDESCRIPTION")
+	for _, b := range bindings {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			b.key, flagUsage(b), b.env, b.typ, orDash(b.def), orDash(b.rule), b.usage)
+	}
+	_ = tw.Flush()
+}
+
+func flagUsage(b binding) string {
+	if b.flag == nil {
+		return "-"
+	}
+	if b.flag.Shorthand != "" {
+		return fmt.Sprintf("-%s, --%s", b.flag.Shorthand, b.flag.Name)
+	}
+	return "--" + b.flag.Name
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
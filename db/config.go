@@ -11,7 +11,7 @@ import (
 
 type Configuration struct {
 	Driver          string        `config:"database_driver" validate:"required"`
-	DBConnStr       string        `config:"database_connection_string" validate:"required"`
+	DBConnStr       string        `config:"database_connection_string" validate:"required" sensitive:"true"`
 	MaxIdleConns    uint          `config:"database_max_idle_connections"`
 	MaxOpenConns    uint          `config:"database_max_open_connections"`
 	ConnMaxIdleTime time.Duration `config:"database_connection_max_idle_time"`
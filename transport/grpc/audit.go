@@ -0,0 +1,208 @@
+package grpc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"strings"
+
+	"github.com/nojyerac/go-lib/audit"
+	"github.com/nojyerac/go-lib/authz"
+	"github.com/nojyerac/go-lib/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// CallAuditAction is the audit action used by the audit interceptors.
+const CallAuditAction = "grpc.call"
+
+type AuditOption func(*auditOptions)
+
+type auditOptions struct {
+	operations      authz.PolicyMap
+	bodyDigestBytes int
+}
+
+// WithAuditOperations audits only RPCs matching operations instead of every
+// mutating RPC. Keys use the PolicyMap syntax, e.g. "/svc.Users/*".
+func WithAuditOperations(operations ...string) AuditOption {
+	return func(o *auditOptions) {
+		if o.operations == nil {
+			o.operations = authz.NewPolicyMap()
+		}
+		o.operations.SetAll(authz.Requirement{}, operations...)
+	}
+}
+
+// WithAuditBodyDigest records the SHA-256 of the first maxBytes of the
+// deterministically marshaled request message. Streams have no single
+// request message and are never digested.
+func WithAuditBodyDigest(maxBytes int) AuditOption {
+	return func(o *auditOptions) {
+		o.bodyDigestBytes = maxBytes
+	}
+}
+
+func newAuditOptions(opts []AuditOption) *auditOptions {
+	o := &auditOptions{}
+	for _, applyOpt := range opts {
+		applyOpt(o)
+	}
+	return o
+}
+
+// AuditServerOptions returns the audit interceptors as server options. Pass
+// them after AuthServerOptions: interceptors run in the order given, and the
+// audit interceptors read the caller from the claims the auth interceptors
+// attach.
+func AuditServerOptions(logger audit.AuditLogger, opts ...AuditOption) []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(AuditUnaryServerInterceptor(logger, opts...)),
+		grpc.ChainStreamInterceptor(AuditStreamServerInterceptor(logger, opts...)),
+	}
+}
+
+// AuditUnaryServerInterceptor emits an audit event for every mutating RPC, or
+// for the operations given with WithAuditOperations. RPCs declared with
+// idempotency_level = NO_SIDE_EFFECTS are treated as reads. The event records
+// the operation and status code, with the actor taken from the claims on ctx
+// and the caller's address from the peer.
+func AuditUnaryServerInterceptor(logger audit.AuditLogger, opts ...AuditOption) grpc.UnaryServerInterceptor {
+	o := newAuditOptions(opts)
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		details, ok := o.details(info.FullMethod)
+		if !ok {
+			return handler(ctx, req)
+		}
+		if msg, isProto := req.(proto.Message); isProto && o.bodyDigestBytes > 0 {
+			digestMessage(msg, o.bodyDigestBytes, details)
+		}
+
+		resp, err := handler(ctx, req)
+		recordCall(ctx, logger, err, details)
+		return resp, err
+	}
+}
+
+// AuditStreamServerInterceptor is the streaming counterpart of
+// AuditUnaryServerInterceptor. The event is emitted when the stream ends.
+func AuditStreamServerInterceptor(logger audit.AuditLogger, opts ...AuditOption) grpc.StreamServerInterceptor {
+	o := newAuditOptions(opts)
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		details, ok := o.details(info.FullMethod)
+		if !ok {
+			return handler(srv, ss)
+		}
+
+		err := handler(srv, ss)
+		recordCall(ss.Context(), logger, err, details)
+		return err
+	}
+}
+
+// details returns the initial event details when fullMethod should be audited.
+func (o *auditOptions) details(fullMethod string) (map[string]any, bool) {
+	operation := authz.GRPCOperation(fullMethod)
+	details := map[string]any{"operation": operation}
+	if o.operations != nil {
+		match, ok := o.operations.Match(operation)
+		if !ok {
+			return nil, false
+		}
+		details["pattern"] = match.Pattern
+		return details, true
+	}
+	return details, mutatingRPC(fullMethod)
+}
+
+// mutatingRPC reports whether fullMethod may change state. Methods missing
+// from the global proto registry are assumed to.
+func mutatingRPC(fullMethod string) bool {
+	name := strings.Replace(strings.TrimPrefix(fullMethod, "/"), "/", ".", 1)
+	desc, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return true
+	}
+	method, ok := desc.(protoreflect.MethodDescriptor)
+	if !ok {
+		return true
+	}
+	options, ok := method.Options().(*descriptorpb.MethodOptions)
+	return !ok || options.GetIdempotencyLevel() != descriptorpb.MethodOptions_NO_SIDE_EFFECTS
+}
+
+func digestMessage(msg proto.Message, maxBytes int, details map[string]any) {
+	payload, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+	if err != nil {
+		return
+	}
+	truncated := len(payload) > maxBytes
+	if truncated {
+		payload = payload[:maxBytes]
+	}
+	sum := sha256.Sum256(payload)
+	details["body_sha256"] = hex.EncodeToString(sum[:])
+	details["body_bytes"] = len(payload)
+	details["body_truncated"] = truncated
+}
+
+// auditContext returns ctx with the caller's address and user agent attached
+// for audit events, and an anonymous actor for callers without claims.
+func auditContext(ctx context.Context) context.Context {
+	ctx = audit.WithAnonymousFallback(ctx)
+	var ip, userAgent string
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		addr := p.Addr.String()
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			addr = host
+		}
+		ip = addr
+	}
+	if values := metadata.ValueFromIncomingContext(ctx, "user-agent"); len(values) > 0 {
+		userAgent = values[0]
+	}
+	if ip == "" && userAgent == "" {
+		return ctx
+	}
+	return audit.WithActorAddress(ctx, ip, userAgent)
+}
+
+func recordCall(ctx context.Context, logger audit.AuditLogger, err error, details map[string]any) {
+	code := status.Code(err)
+	details["code"] = code.String()
+	ctx = audit.WithOutcome(auditContext(ctx), callOutcome(code))
+	// an empty actor is filled from the claims on ctx, or is anonymous
+	if logErr := logger.Log(ctx, "", CallAuditAction, details); logErr != nil {
+		log.FromContext(ctx).WithError(logErr).WithField("operation", details["operation"]).
+			Warn("failed to audit RPC")
+	}
+}
+
+func callOutcome(code codes.Code) string {
+	switch code {
+	case codes.OK:
+		return audit.OutcomeSuccess
+	case codes.Unauthenticated, codes.PermissionDenied:
+		return audit.OutcomeDenied
+	default:
+		return audit.OutcomeFailure
+	}
+}
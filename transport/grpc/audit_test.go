@@ -0,0 +1,203 @@
+package grpc_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+
+	"github.com/google/uuid"
+	"github.com/nojyerac/go-lib/audit"
+	"github.com/nojyerac/go-lib/auth"
+	. "github.com/nojyerac/go-lib/transport/grpc"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	pb "google.golang.org/grpc/examples/features/proto/echo"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// registerReadOnlyService registers audit.test.Widgets, whose Get method is
+// declared with idempotency_level = NO_SIDE_EFFECTS.
+func registerReadOnlyService() {
+	if _, err := protoregistry.GlobalFiles.FindFileByPath("audit_test.proto"); err == nil {
+		return
+	}
+	file, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("audit_test.proto"),
+		Package: proto.String("audit.test"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("Empty")},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Widgets"),
+			Method: []*descriptorpb.MethodDescriptorProto{{
+				Name:       proto.String("Get"),
+				InputType:  proto.String(".audit.test.Empty"),
+				OutputType: proto.String(".audit.test.Empty"),
+				Options: &descriptorpb.MethodOptions{
+					IdempotencyLevel: descriptorpb.MethodOptions_NO_SIDE_EFFECTS.Enum(),
+				},
+			}},
+		}},
+	}, protoregistry.GlobalFiles)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(protoregistry.GlobalFiles.RegisterFile(file)).To(Succeed())
+}
+
+var _ = Describe("Audit interceptors", func() {
+	var (
+		out     bytes.Buffer
+		logger  audit.AuditLogger
+		ctx     context.Context
+		subject string
+	)
+
+	events := func() []audit.Event {
+		var evts []audit.Event
+		dec := json.NewDecoder(bytes.NewReader(out.Bytes()))
+		for dec.More() {
+			var evt audit.Event
+			Expect(dec.Decode(&evt)).To(Succeed())
+			evts = append(evts, evt)
+		}
+		return evts
+	}
+
+	ok := func(context.Context, any) (any, error) { return nil, nil }
+
+	BeforeEach(func() {
+		registerReadOnlyService()
+		out.Reset()
+		subject = uuid.NewString()
+		ctx = auth.WithClaims(context.Background(), &auth.Claims{Subject: subject})
+
+		cfg := audit.NewConfiguration()
+		cfg.AuditLoggerType = "stdout"
+		var err error
+		logger, err = audit.NewAuditLogger(cfg, audit.WithOutput(&out))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	Describe("AuditServerOptions", func() {
+		It("returns unary and stream options", func() {
+			Expect(AuditServerOptions(logger)).To(HaveLen(2))
+		})
+	})
+
+	Describe("AuditUnaryServerInterceptor", func() {
+		It("audits mutating RPCs with the caller as actor", func() {
+			interceptor := AuditUnaryServerInterceptor(logger)
+
+			_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/svc.Example/Write"}, ok)
+			Expect(err).NotTo(HaveOccurred())
+
+			evts := events()
+			Expect(evts).To(HaveLen(1))
+			Expect(evts[0].Action).To(Equal(CallAuditAction))
+			Expect(evts[0].ActorID).To(Equal(subject))
+			Expect(evts[0].Outcome).To(Equal(audit.OutcomeSuccess))
+			Expect(evts[0].Details).To(HaveKeyWithValue("operation", "/svc.Example/Write"))
+			Expect(evts[0].Details).To(HaveKeyWithValue("code", "OK"))
+		})
+
+		It("records the caller's address and user agent", func() {
+			ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 7), Port: 50051}})
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("user-agent", "grpc-go/1.60"))
+			interceptor := AuditUnaryServerInterceptor(logger)
+
+			_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/svc.Example/Write"}, ok)
+			Expect(err).NotTo(HaveOccurred())
+
+			evts := events()
+			Expect(evts).To(HaveLen(1))
+			Expect(*evts[0].Actor).To(Equal(audit.Actor{
+				Type: audit.ActorUser, ID: subject, IP: "10.0.0.7", UserAgent: "grpc-go/1.60",
+			}))
+		})
+
+		It("skips RPCs without side effects", func() {
+			interceptor := AuditUnaryServerInterceptor(logger)
+
+			_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/audit.test.Widgets/Get"}, ok)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(events()).To(BeEmpty())
+		})
+
+		It("records the status code of failed RPCs", func() {
+			interceptor := AuditUnaryServerInterceptor(logger)
+
+			_, err := interceptor(
+				ctx,
+				nil,
+				&grpc.UnaryServerInfo{FullMethod: "/svc.Example/Write"},
+				func(context.Context, any) (any, error) {
+					return nil, status.Error(codes.PermissionDenied, "nope")
+				},
+			)
+			Expect(status.Code(err)).To(Equal(codes.PermissionDenied))
+
+			evts := events()
+			Expect(evts).To(HaveLen(1))
+			Expect(evts[0].Outcome).To(Equal(audit.OutcomeDenied))
+			Expect(evts[0].Details).To(HaveKeyWithValue("code", "PermissionDenied"))
+		})
+
+		It("audits only configured operations", func() {
+			interceptor := AuditUnaryServerInterceptor(logger, WithAuditOperations("/audit.test.Widgets/*"))
+
+			_, _ = interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/audit.test.Widgets/Get"}, ok)
+			_, _ = interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/svc.Example/Write"}, ok)
+
+			evts := events()
+			Expect(evts).To(HaveLen(1))
+			Expect(evts[0].Details).To(HaveKeyWithValue("pattern", "/audit.test.Widgets/*"))
+		})
+
+		It("digests a bounded prefix of the request message", func() {
+			req := &pb.EchoRequest{Message: "hello world"}
+			payload, err := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+			Expect(err).NotTo(HaveOccurred())
+			sum := sha256.Sum256(payload[:4])
+			interceptor := AuditUnaryServerInterceptor(logger, WithAuditBodyDigest(4))
+
+			_, err = interceptor(ctx, req, &grpc.UnaryServerInfo{FullMethod: "/svc.Example/Write"}, ok)
+			Expect(err).NotTo(HaveOccurred())
+
+			evts := events()
+			Expect(evts).To(HaveLen(1))
+			Expect(evts[0].Details).To(HaveKeyWithValue("body_sha256", hex.EncodeToString(sum[:])))
+			Expect(evts[0].Details).To(HaveKeyWithValue("body_truncated", true))
+		})
+	})
+
+	Describe("AuditStreamServerInterceptor", func() {
+		It("audits the stream when it ends", func() {
+			interceptor := AuditStreamServerInterceptor(logger)
+
+			err := interceptor(
+				nil,
+				&streamStub{ctx: ctx},
+				&grpc.StreamServerInfo{FullMethod: "/svc.Example/Upload"},
+				func(any, grpc.ServerStream) error { return status.Error(codes.Internal, "boom") },
+			)
+			Expect(status.Code(err)).To(Equal(codes.Internal))
+
+			evts := events()
+			Expect(evts).To(HaveLen(1))
+			Expect(evts[0].ActorID).To(Equal(subject))
+			Expect(evts[0].Outcome).To(Equal(audit.OutcomeFailure))
+			Expect(evts[0].Details).To(HaveKeyWithValue("code", "Internal"))
+		})
+	})
+})
@@ -2,70 +2,171 @@ package grpc
 
 import (
 	"context"
+	"errors"
 
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"github.com/nojyerac/go-lib/audit"
 	"github.com/nojyerac/go-lib/auth"
 	"github.com/nojyerac/go-lib/authz"
+	"github.com/nojyerac/go-lib/log"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
-func AuthServerOptions(validator auth.Validator, policies authz.PolicyMap) []grpc.ServerOption {
+type AuthOption func(*authOptions)
+
+type authOptions struct {
+	shadow    bool
+	relations authz.RelationChecker
+	auditor   *authz.DecisionAuditor
+}
+
+// WithAuthShadowMode evaluates policies without enforcing them. Would-be
+// denials are logged and counted, and the RPC is passed through.
+func WithAuthShadowMode() AuthOption {
+	return func(o *authOptions) {
+		o.shadow = true
+	}
+}
+
+// WithRelationChecker evaluates relationship requirements (see
+// authz.RequireRelation) with checker. Object IDs are read from the request
+// message field named by the requirement's ObjectParam, falling back to
+// incoming metadata with that key. Streams only consult metadata.
+func WithRelationChecker(checker authz.RelationChecker) AuthOption {
+	return func(o *authOptions) {
+		o.relations = checker
+	}
+}
+
+// WithDecisionAudit sends authorization decisions to logger: every denial,
+// and allows for RPCs matching sensitiveOperations.
+func WithDecisionAudit(logger audit.AuditLogger, sensitiveOperations ...string) AuthOption {
+	return func(o *authOptions) {
+		o.auditor = authz.NewDecisionAuditor(logger, sensitiveOperations...)
+	}
+}
+
+func newAuthOptions(opts []AuthOption) *authOptions {
+	o := &authOptions{}
+	for _, applyOpt := range opts {
+		applyOpt(o)
+	}
+	return o
+}
+
+func AuthServerOptions(validator auth.Validator, policies authz.PolicyMap, opts ...AuthOption) []grpc.ServerOption {
 	return []grpc.ServerOption{
-		grpc.ChainUnaryInterceptor(AuthUnaryServerInterceptor(validator, policies)),
-		grpc.ChainStreamInterceptor(AuthStreamServerInterceptor(validator, policies)),
+		grpc.ChainUnaryInterceptor(AuthUnaryServerInterceptor(validator, policies, opts...)),
+		grpc.ChainStreamInterceptor(AuthStreamServerInterceptor(validator, policies, opts...)),
 	}
 }
 
-func AuthUnaryServerInterceptor(validator auth.Validator, policies authz.PolicyMap) grpc.UnaryServerInterceptor {
+func AuthUnaryServerInterceptor(
+	validator auth.Validator,
+	policies authz.PolicyMap,
+	opts ...AuthOption,
+) grpc.UnaryServerInterceptor {
+	o := newAuthOptions(opts)
 	return func(
 		ctx context.Context,
 		req interface{},
 		info *grpc.UnaryServerInfo,
 		handler grpc.UnaryHandler,
 	) (interface{}, error) {
-		requirement, ok := policies.Requirement(authz.GRPCOperation(info.FullMethod))
-		if !ok {
-			return handler(ctx, req)
-		}
-
-		claims, err := authenticateClaims(ctx, validator)
+		ctx, err := authorizeRPC(ctx, info.FullMethod, req, validator, policies, o)
 		if err != nil {
-			return nil, grpcAuthError(err)
+			return nil, err
 		}
-		if err := authz.Authorize(claims, requirement); err != nil {
-			return nil, grpcAuthError(err)
-		}
-
-		return handler(auth.WithClaims(ctx, claims), req)
+		return handler(ctx, req)
 	}
 }
 
-func AuthStreamServerInterceptor(validator auth.Validator, policies authz.PolicyMap) grpc.StreamServerInterceptor {
+func AuthStreamServerInterceptor(
+	validator auth.Validator,
+	policies authz.PolicyMap,
+	opts ...AuthOption,
+) grpc.StreamServerInterceptor {
+	o := newAuthOptions(opts)
 	return func(
 		srv interface{},
 		ss grpc.ServerStream,
 		info *grpc.StreamServerInfo,
 		handler grpc.StreamHandler,
 	) error {
-		requirement, ok := policies.Requirement(authz.GRPCOperation(info.FullMethod))
-		if !ok {
-			return handler(srv, ss)
+		ctx, err := authorizeRPC(ss.Context(), info.FullMethod, nil, validator, policies, o)
+		if err != nil {
+			return err
 		}
+		wrapped := grpc_middleware.WrapServerStream(ss)
+		wrapped.WrappedContext = ctx
+		return handler(srv, wrapped)
+	}
+}
 
-		claims, err := authenticateClaims(ss.Context(), validator)
-		if err != nil {
-			return grpcAuthError(err)
+// authorizeRPC enforces the policy for fullMethod and returns ctx with the
+// caller's claims attached when they could be validated. req is nil for
+// streams.
+func authorizeRPC(
+	ctx context.Context,
+	fullMethod string,
+	req interface{},
+	validator auth.Validator,
+	policies authz.PolicyMap,
+	o *authOptions,
+) (context.Context, error) {
+	operation := authz.GRPCOperation(fullMethod)
+	match, ok := policies.Match(operation)
+	if !ok {
+		return ctx, nil
+	}
+
+	claims, err := authenticateClaims(ctx, validator)
+	if err == nil {
+		params := relationParams(ctx, req, match.Requirement.Relation)
+		err = authz.AuthorizeContext(ctx, o.relations, claims, match.Requirement, params)
+	}
+	o.auditor.Record(auditContext(ctx), authz.Decision{Match: match, Claims: claims, Err: err, Shadow: o.shadow})
+	if err != nil {
+		if !o.shadow {
+			return ctx, grpcAuthError(ctx, err)
 		}
-		if err := authz.Authorize(claims, requirement); err != nil {
-			return grpcAuthError(err)
+		authz.RecordShadowDenial(ctx, policies.Explain(operation, claims), err)
+	}
+
+	if claims != nil {
+		ctx = auth.WithClaims(ctx, claims)
+	}
+	return ctx, nil
+}
+
+// relationParams reads the object ID for a relationship requirement from the
+// request message or, failing that, from incoming metadata.
+func relationParams(ctx context.Context, req interface{}, relation *authz.RelationRequirement) map[string]string {
+	if relation == nil || relation.ObjectParam == "" {
+		return nil
+	}
+
+	if msg, ok := req.(proto.Message); ok {
+		reflected := msg.ProtoReflect()
+		field := reflected.Descriptor().Fields().ByName(protoreflect.Name(relation.ObjectParam))
+		if field != nil && field.Kind() == protoreflect.StringKind && field.Cardinality() != protoreflect.Repeated {
+			if id := reflected.Get(field).String(); id != "" {
+				return map[string]string{relation.ObjectParam: id}
+			}
 		}
+	}
 
-		wrapped := grpc_middleware.WrapServerStream(ss)
-		wrapped.WrappedContext = auth.WithClaims(ss.Context(), claims)
-		return handler(srv, wrapped)
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(relation.ObjectParam); len(values) > 0 {
+			return map[string]string{relation.ObjectParam: values[0]}
+		}
 	}
+	return nil
 }
 
 func authenticateClaims(ctx context.Context, validator auth.Validator) (*auth.Claims, error) {
@@ -88,6 +189,16 @@ func bearerTokenFromIncomingMetadata(ctx context.Context) (string, error) {
 	return auth.BearerToken(header[0])
 }
 
-func grpcAuthError(err error) error {
-	return status.Error(auth.GRPCCode(err), err.Error())
+// grpcAuthError returns the status for an auth failure. Its message is fixed
+// so that validator and relation store errors are only logged server-side.
+func grpcAuthError(ctx context.Context, err error) error {
+	if errors.Is(err, authz.ErrRelationCheck) {
+		log.FromContext(ctx).WithError(err).Error("authorization check failed")
+		return status.Error(codes.Unavailable, "authorization unavailable")
+	}
+	code := auth.GRPCCode(err)
+	if code == codes.PermissionDenied {
+		return status.Error(code, "permission denied")
+	}
+	return status.Error(code, "unauthenticated")
 }
@@ -2,14 +2,17 @@ package grpc_test
 
 import (
 	"context"
+	"errors"
 
 	"github.com/nojyerac/go-lib/auth"
 	"github.com/nojyerac/go-lib/authz"
+	"github.com/nojyerac/go-lib/authz/rebac"
 	. "github.com/nojyerac/go-lib/transport/grpc"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	pb "google.golang.org/grpc/examples/features/proto/echo"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
@@ -103,6 +106,7 @@ var _ = Describe("Auth interceptors", func() {
 			)
 
 			Expect(status.Code(err)).To(Equal(codes.Unauthenticated))
+			Expect(status.Convert(err).Message()).To(Equal("unauthenticated"))
 		})
 
 		It("returns permission denied for insufficient roles", func() {
@@ -175,4 +179,140 @@ var _ = Describe("Auth interceptors", func() {
 			Expect(status.Code(err)).To(Equal(codes.Unauthenticated))
 		})
 	})
+
+	Describe("WithAuthShadowMode", func() {
+		It("passes would-be denied unary calls through with claims", func() {
+			validator.claims = &auth.Claims{Subject: "user-1", Roles: []string{"viewer"}}
+			interceptor := AuthUnaryServerInterceptor(validator, policies, WithAuthShadowMode())
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer token"))
+			called := false
+
+			_, err := interceptor(
+				ctx,
+				nil,
+				&grpc.UnaryServerInfo{FullMethod: "/svc.Example/Read"},
+				func(handlerCtx context.Context, _ any) (any, error) {
+					called = true
+					claims, ok := auth.FromContext(handlerCtx)
+					Expect(ok).To(BeTrue())
+					Expect(claims.Subject).To(Equal("user-1"))
+					return nil, nil
+				},
+			)
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(called).To(BeTrue())
+		})
+
+		It("passes would-be unauthenticated streams through without claims", func() {
+			interceptor := AuthStreamServerInterceptor(validator, policies, WithAuthShadowMode())
+			stream := &streamStub{ctx: context.Background()}
+
+			err := interceptor(
+				nil,
+				stream,
+				&grpc.StreamServerInfo{FullMethod: "/svc.Example/Read"},
+				func(_ any, wrapped grpc.ServerStream) error {
+					_, ok := auth.FromContext(wrapped.Context())
+					Expect(ok).To(BeFalse())
+					return nil
+				},
+			)
+
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Describe("WithRelationChecker", func() {
+		var checker *rebac.Engine
+
+		BeforeEach(func() {
+			store := rebac.NewMemoryStore()
+			Expect(store.Write(context.Background(), rebac.MustParseTuple("channel:general#speaker@user:user-1"))).To(Succeed())
+			checker = rebac.NewEngine(store, rebac.Schema{})
+			policies.Set(authz.GRPCOperation("/svc.Example/*"), authz.RequireRelation("channel", "message", "speaker"))
+		})
+
+		callUnary := func(ctx context.Context, req any) error {
+			interceptor := AuthUnaryServerInterceptor(validator, policies, WithRelationChecker(checker))
+			_, err := interceptor(
+				ctx,
+				req,
+				&grpc.UnaryServerInfo{FullMethod: "/svc.Example/Speak"},
+				func(context.Context, any) (any, error) { return nil, nil },
+			)
+			return err
+		}
+
+		It("reads the object ID from the request message", func() {
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer token"))
+
+			Expect(callUnary(ctx, &pb.EchoRequest{Message: "general"})).To(Succeed())
+			Expect(status.Code(callUnary(ctx, &pb.EchoRequest{Message: "random"}))).To(Equal(codes.PermissionDenied))
+		})
+
+		It("falls back to incoming metadata", func() {
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+				"authorization", "Bearer token",
+				"message", "general",
+			))
+
+			Expect(callUnary(ctx, nil)).To(Succeed())
+		})
+
+		It("answers relation store failures as unavailable without the cause", func() {
+			interceptor := AuthUnaryServerInterceptor(validator, policies, WithRelationChecker(failingChecker{}))
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer token"))
+
+			_, err := interceptor(
+				ctx,
+				&pb.EchoRequest{Message: "general"},
+				&grpc.UnaryServerInfo{FullMethod: "/svc.Example/Speak"},
+				func(context.Context, any) (any, error) { return nil, nil },
+			)
+
+			Expect(status.Code(err)).To(Equal(codes.Unavailable))
+			Expect(status.Convert(err).Message()).NotTo(ContainSubstring("db-1"))
+		})
+	})
+
+	Describe("WithDecisionAudit", func() {
+		It("records denied RPCs", func() {
+			logger := &auditLoggerStub{}
+			validator.claims = &auth.Claims{Subject: "user-1", Roles: []string{"viewer"}}
+			interceptor := AuthUnaryServerInterceptor(validator, policies, WithDecisionAudit(logger))
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer token"))
+
+			_, err := interceptor(
+				ctx,
+				nil,
+				&grpc.UnaryServerInfo{FullMethod: "/svc.Example/Read"},
+				func(context.Context, any) (any, error) { return nil, nil },
+			)
+
+			Expect(status.Code(err)).To(Equal(codes.PermissionDenied))
+			Expect(logger.details).To(HaveLen(1))
+			Expect(logger.details[0]).To(HaveKeyWithValue("operation", "/svc.Example/Read"))
+			Expect(logger.details[0]).To(HaveKeyWithValue("outcome", authz.OutcomeDeny))
+		})
+	})
 })
+
+type failingChecker struct{}
+
+func (failingChecker) Check(context.Context, string, string, string) (bool, error) {
+	return false, errors.New("dial tcp db-1:5432: connection refused")
+}
+
+type auditLoggerStub struct {
+	details []map[string]any
+}
+
+func (a *auditLoggerStub) LogChange(ctx context.Context, actorID, action string, _, _ any) error {
+	return a.Log(ctx, actorID, action, nil)
+}
+
+func (a *auditLoggerStub) Log(_ context.Context, _, _ string, details map[string]any) error {
+	a.details = append(a.details, details)
+	return nil
+}
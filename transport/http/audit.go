@@ -0,0 +1,169 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/nojyerac/go-lib/audit"
+	"github.com/nojyerac/go-lib/authz"
+	"github.com/nojyerac/go-lib/log"
+)
+
+// RequestAuditAction is the audit action used by the audit middleware.
+const RequestAuditAction = "http.request"
+
+type AuditOption func(*auditOptions)
+
+type auditOptions struct {
+	operations      authz.PolicyMap
+	bodyDigestBytes int64
+}
+
+// WithAuditOperations audits only requests matching operations instead of
+// every mutating request. Keys use the PolicyMap syntax, e.g.
+// "GET /api/users/{id}", so reads can be audited too.
+func WithAuditOperations(operations ...string) AuditOption {
+	return func(o *auditOptions) {
+		if o.operations == nil {
+			o.operations = authz.NewPolicyMap()
+		}
+		o.operations.SetAll(authz.Requirement{}, operations...)
+	}
+}
+
+// WithAuditBodyDigest records the SHA-256 of the first maxBytes of the request
+// body. The body itself is never recorded and is passed on unchanged.
+func WithAuditBodyDigest(maxBytes int64) AuditOption {
+	return func(o *auditOptions) {
+		o.bodyDigestBytes = maxBytes
+	}
+}
+
+// WithAuditMiddleware emits an audit event for every request that changes
+// state (any method but GET, HEAD, OPTIONS, and TRACE), or for the operations
+// given with WithAuditOperations. The actor is the subject of the claims set
+// by the auth middleware, or anonymous, with the caller's address and user
+// agent, and the event records the operation and response status.
+//
+// The audit middleware always runs inside the other middleware, whatever the
+// option order, so it sees the caller's claims. Requests rejected by the auth
+// middleware never reach it; use WithDecisionAudit to record those.
+func WithAuditMiddleware(logger audit.AuditLogger, opts ...AuditOption) Option {
+	o := &auditOptions{}
+	for _, applyOpt := range opts {
+		applyOpt(o)
+	}
+	mw := auditMiddleware(logger, o)
+	return func(s *server) {
+		// middleware earlier in the list wraps the handler first
+		s.middleware = append([]func(http.Handler) http.Handler{mw}, s.middleware...)
+	}
+}
+
+func auditMiddleware(logger audit.AuditLogger, o *auditOptions) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			operation := authz.HTTPOperation(r.Method, r.URL.Path)
+			details, ok := o.details(r.Method, operation)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if o.bodyDigestBytes > 0 && r.Body != nil {
+				digestBody(r, o.bodyDigestBytes, details)
+			}
+
+			lrw := &loggingResponseWriter{ResponseWriter: w, StatusCode: http.StatusOK}
+			defer func() {
+				// record handler panics as server errors before passing them on
+				p := recover()
+				if p != nil {
+					lrw.StatusCode = http.StatusInternalServerError
+				}
+				recordRequest(r, logger, lrw.StatusCode, details)
+				if p != nil {
+					panic(p)
+				}
+			}()
+			next.ServeHTTP(lrw, r)
+		})
+	}
+}
+
+// details returns the initial event details when operation should be audited.
+func (o *auditOptions) details(method, operation string) (map[string]any, bool) {
+	details := map[string]any{"operation": operation}
+	if o.operations != nil {
+		match, ok := o.operations.Match(operation)
+		if !ok {
+			return nil, false
+		}
+		details["pattern"] = match.Pattern
+		return details, true
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return nil, false
+	}
+	return details, true
+}
+
+// digestBody hashes up to maxBytes of the request body and restores the body
+// so the handler reads it in full.
+func digestBody(r *http.Request, maxBytes int64, details map[string]any) {
+	head, err := io.ReadAll(io.LimitReader(r.Body, maxBytes+1))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), r.Body), r.Body}
+	if err != nil {
+		return
+	}
+
+	truncated := int64(len(head)) > maxBytes
+	if truncated {
+		head = head[:maxBytes]
+	}
+	sum := sha256.Sum256(head)
+	details["body_sha256"] = hex.EncodeToString(sum[:])
+	details["body_bytes"] = len(head)
+	details["body_truncated"] = truncated
+}
+
+// auditContext returns the request context with the caller's address and
+// user agent attached for audit events, and an anonymous actor for callers
+// without claims. Forwarding headers are ignored since the caller controls
+// them.
+func auditContext(r *http.Request) context.Context {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return audit.WithAnonymousFallback(audit.WithActorAddress(r.Context(), ip, r.UserAgent()))
+}
+
+func recordRequest(r *http.Request, logger audit.AuditLogger, status int, details map[string]any) {
+	details["status_code"] = status
+	ctx := audit.WithOutcome(auditContext(r), requestOutcome(status))
+	// an empty actor is filled from the claims on ctx, or is anonymous
+	if err := logger.Log(ctx, "", RequestAuditAction, details); err != nil {
+		log.FromContext(ctx).WithError(err).WithField("operation", details["operation"]).
+			Warn("failed to audit request")
+	}
+}
+
+func requestOutcome(status int) string {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return audit.OutcomeDenied
+	case status >= http.StatusBadRequest:
+		return audit.OutcomeFailure
+	default:
+		return audit.OutcomeSuccess
+	}
+}
@@ -0,0 +1,178 @@
+package http_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/nojyerac/go-lib/audit"
+	"github.com/nojyerac/go-lib/auth"
+	"github.com/nojyerac/go-lib/authz"
+	"github.com/nojyerac/go-lib/log"
+	. "github.com/nojyerac/go-lib/transport/http"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Audit middleware", func() {
+	var (
+		s       Server
+		out     bytes.Buffer
+		logger  audit.AuditLogger
+		subject string
+		opts    []AuditOption
+		body    []byte
+	)
+
+	events := func() []audit.Event {
+		var evts []audit.Event
+		dec := json.NewDecoder(bytes.NewReader(out.Bytes()))
+		for dec.More() {
+			var evt audit.Event
+			Expect(dec.Decode(&evt)).To(Succeed())
+			evts = append(evts, evt)
+		}
+		return evts
+	}
+
+	serve := func(method, path, payload string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(payload))
+		req.Header.Set("Authorization", "Bearer token")
+		req.Header.Set("User-Agent", "widgets-cli/1.0")
+		s.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	BeforeEach(func() {
+		out.Reset()
+		opts = nil
+		body = nil
+		subject = uuid.NewString()
+
+		cfg := audit.NewConfiguration()
+		cfg.AuditLoggerType = "stdout"
+		var err error
+		logger, err = audit.NewAuditLogger(cfg, audit.WithOutput(&out))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	JustBeforeEach(func() {
+		validator := &validatorStub{claims: &auth.Claims{Subject: subject, Roles: []string{"writer"}}}
+		policies := authz.NewPolicyMap()
+		policies.SetAll(authz.RequireAny("writer"),
+			"GET /api/widgets", "POST /api/widgets", "PUT /api/widgets", "DELETE /api/widgets", "POST /api/panic")
+
+		// the audit middleware is given last but still runs inside auth
+		s = NewServer(
+			&Configuration{},
+			WithLogger(log.NewLogger(log.TestConfig)),
+			WithAuthMiddleware(validator, policies),
+			WithAuditMiddleware(logger, opts...),
+		)
+		s.HandleFunc("/widgets", func(w http.ResponseWriter, r *http.Request) {
+			var err error
+			body, err = io.ReadAll(r.Body)
+			Expect(err).NotTo(HaveOccurred())
+			if r.URL.Query().Has("fail") {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+		})
+		s.HandleFunc("/panic", func(http.ResponseWriter, *http.Request) {
+			panic("boom")
+		})
+		s.HandleFunc("/public", func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})
+	})
+
+	It("audits mutating requests with the caller as actor", func() {
+		Expect(serve(http.MethodPost, "/api/widgets", `{"name":"a"}`)).To(Equal(http.StatusCreated))
+
+		evts := events()
+		Expect(evts).To(HaveLen(1))
+		Expect(evts[0].Action).To(Equal(RequestAuditAction))
+		Expect(evts[0].ActorID).To(Equal(subject))
+		Expect(evts[0].Outcome).To(Equal(audit.OutcomeSuccess))
+		Expect(evts[0].Details).To(HaveKeyWithValue("operation", "POST /api/widgets"))
+		Expect(evts[0].Details).To(HaveKeyWithValue("status_code", BeEquivalentTo(http.StatusCreated)))
+		Expect(evts[0].Details).NotTo(HaveKey("body_sha256"))
+		Expect(*evts[0].Actor).To(Equal(audit.Actor{
+			Type: audit.ActorUser, ID: subject, IP: "192.0.2.1", UserAgent: "widgets-cli/1.0",
+		}))
+	})
+
+	It("audits unauthenticated requests as anonymous", func() {
+		Expect(serve(http.MethodPost, "/api/public", "")).To(Equal(http.StatusNoContent))
+
+		evts := events()
+		Expect(evts).To(HaveLen(1))
+		Expect(evts[0].ActorID).To(BeEmpty())
+		Expect(evts[0].Actor.Type).To(Equal(audit.ActorAnonymous))
+	})
+
+	It("skips reads", func() {
+		Expect(serve(http.MethodGet, "/api/widgets", "")).To(Equal(http.StatusCreated))
+		Expect(events()).To(BeEmpty())
+	})
+
+	It("records failures", func() {
+		Expect(serve(http.MethodDelete, "/api/widgets?fail", "")).To(Equal(http.StatusConflict))
+
+		evts := events()
+		Expect(evts).To(HaveLen(1))
+		Expect(evts[0].Outcome).To(Equal(audit.OutcomeFailure))
+		Expect(evts[0].Details).To(HaveKeyWithValue("status_code", BeEquivalentTo(http.StatusConflict)))
+	})
+
+	It("records panics as server errors", func() {
+		Expect(serve(http.MethodPost, "/api/panic", "")).To(Equal(http.StatusInternalServerError))
+
+		evts := events()
+		Expect(evts).To(HaveLen(1))
+		Expect(evts[0].Outcome).To(Equal(audit.OutcomeFailure))
+		Expect(evts[0].Details).To(HaveKeyWithValue("status_code", BeEquivalentTo(http.StatusInternalServerError)))
+	})
+
+	Context("with configured operations", func() {
+		BeforeEach(func() {
+			opts = append(opts, WithAuditOperations("GET /api/widgets"))
+		})
+
+		It("audits only matching requests", func() {
+			serve(http.MethodGet, "/api/widgets", "")
+			serve(http.MethodPost, "/api/widgets", "")
+
+			evts := events()
+			Expect(evts).To(HaveLen(1))
+			Expect(evts[0].Details).To(HaveKeyWithValue("operation", "GET /api/widgets"))
+			Expect(evts[0].Details).To(HaveKeyWithValue("pattern", "GET /api/widgets"))
+		})
+	})
+
+	Context("with a body digest", func() {
+		BeforeEach(func() {
+			opts = append(opts, WithAuditBodyDigest(4))
+		})
+
+		It("hashes a bounded prefix and leaves the body intact", func() {
+			serve(http.MethodPut, "/api/widgets", "abcdefgh")
+
+			sum := sha256.Sum256([]byte("abcd"))
+			evts := events()
+			Expect(evts).To(HaveLen(1))
+			Expect(evts[0].Details).To(HaveKeyWithValue("body_sha256", hex.EncodeToString(sum[:])))
+			Expect(evts[0].Details).To(HaveKeyWithValue("body_bytes", BeEquivalentTo(4)))
+			Expect(evts[0].Details).To(HaveKeyWithValue("body_truncated", true))
+			Expect(string(body)).To(Equal("abcdefgh"))
+		})
+	})
+})
@@ -1,50 +1,164 @@
 package http
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
+	"strings"
 
+	"github.com/nojyerac/go-lib/audit"
 	"github.com/nojyerac/go-lib/auth"
 	"github.com/nojyerac/go-lib/authz"
+	"github.com/nojyerac/go-lib/log"
 )
 
-func WithAuthMiddleware(validator auth.Validator, policies authz.PolicyMap) Option {
-	return WithMiddleware(authMiddleware(validator, policies))
+const authzExplainPath = "/debug/authz/explain"
+
+type AuthOption func(*authOptions)
+
+type authOptions struct {
+	shadow    bool
+	relations authz.RelationChecker
+	auditor   *authz.DecisionAuditor
+}
+
+// WithAuthShadowMode evaluates policies without enforcing them. Would-be
+// denials are logged and counted, and the request is passed through.
+func WithAuthShadowMode() AuthOption {
+	return func(o *authOptions) {
+		o.shadow = true
+	}
+}
+
+// WithRelationChecker evaluates relationship requirements (see
+// authz.RequireRelation) with checker. Object IDs are read from the path
+// parameters of the matched policy.
+func WithRelationChecker(checker authz.RelationChecker) AuthOption {
+	return func(o *authOptions) {
+		o.relations = checker
+	}
+}
+
+// WithDecisionAudit sends authorization decisions to logger: every denial,
+// and allows for operations matching sensitiveOperations.
+func WithDecisionAudit(logger audit.AuditLogger, sensitiveOperations ...string) AuthOption {
+	return func(o *authOptions) {
+		o.auditor = authz.NewDecisionAuditor(logger, sensitiveOperations...)
+	}
+}
+
+func WithAuthMiddleware(validator auth.Validator, policies authz.PolicyMap, opts ...AuthOption) Option {
+	o := &authOptions{}
+	for _, applyOpt := range opts {
+		applyOpt(o)
+	}
+	return WithMiddleware(authMiddleware(validator, policies, o))
+}
+
+// WithAuthzExplainHandler mounts a debug endpoint at /debug/authz/explain that
+// reports how policies resolve an operation for a given set of roles. The
+// endpoint discloses the whole policy map, so it is only served to callers
+// with a bearer token that validator accepts and whose claims satisfy access;
+// an empty access requirement admits any authenticated caller.
+func WithAuthzExplainHandler(policies authz.PolicyMap, validator auth.Validator, access authz.Requirement) Option {
+	return func(s *server) {
+		s.explain = guardHandler(validator, access, explainHandler(policies))
+	}
 }
 
-func authMiddleware(validator auth.Validator, policies authz.PolicyMap) func(http.Handler) http.Handler {
+// guardHandler serves next only to authenticated callers satisfying access.
+func guardHandler(validator auth.Validator, access authz.Requirement, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := authenticateRequest(r, validator)
+		if err == nil {
+			err = authz.Authorize(claims, access)
+		}
+		if err != nil {
+			writeAuthError(w, r, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(auth.WithClaims(r.Context(), claims)))
+	})
+}
+
+func authMiddleware(
+	validator auth.Validator,
+	policies authz.PolicyMap,
+	o *authOptions,
+) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			requirement, ok := policies.Requirement(authz.HTTPOperation(r.Method, r.URL.Path))
+			operation := authz.HTTPOperation(r.Method, r.URL.Path)
+			match, ok := policies.Match(operation)
 			if !ok {
 				next.ServeHTTP(w, r)
 				return
 			}
 
-			token, err := auth.BearerToken(r.Header.Get("Authorization"))
+			claims, err := authenticateRequest(r, validator)
+			if err == nil {
+				err = authz.AuthorizeContext(r.Context(), o.relations, claims, match.Requirement, match.Params)
+			}
+			o.auditor.Record(auditContext(r), authz.Decision{Match: match, Claims: claims, Err: err, Shadow: o.shadow})
 			if err != nil {
-				writeAuthError(w, err)
-				return
+				if !o.shadow {
+					writeAuthError(w, r, err)
+					return
+				}
+				authz.RecordShadowDenial(r.Context(), policies.Explain(operation, claims), err)
 			}
 
-			claims, err := validator.Validate(r.Context(), token)
-			if err != nil {
-				writeAuthError(w, err)
-				return
+			if claims != nil {
+				r = r.WithContext(auth.WithClaims(r.Context(), claims))
 			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
 
-			if err := authz.Authorize(claims, requirement); err != nil {
-				writeAuthError(w, err)
-				return
+func authenticateRequest(r *http.Request, validator auth.Validator) (*auth.Claims, error) {
+	token, err := auth.BearerToken(r.Header.Get("Authorization"))
+	if err != nil {
+		return nil, err
+	}
+	return validator.Validate(r.Context(), token)
+}
+
+func explainHandler(policies authz.PolicyMap) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		operation := query.Get("operation")
+		if operation == "" {
+			operation = authz.HTTPOperation(query.Get("method"), query.Get("path"))
+		}
+		if operation == "" {
+			http.Error(w, "operation or method and path are required", http.StatusBadRequest)
+			return
+		}
+
+		claims := &auth.Claims{Subject: query.Get("subject")}
+		for _, roles := range query["roles"] {
+			for _, role := range strings.Split(roles, ",") {
+				if role = strings.TrimSpace(role); role != "" {
+					claims.Roles = append(claims.Roles, role)
+				}
 			}
+		}
 
-			ctx := auth.WithClaims(r.Context(), claims)
-			next.ServeHTTP(w, r.WithContext(ctx))
-		})
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(policies.Explain(operation, claims))
 	}
 }
 
-func writeAuthError(w http.ResponseWriter, err error) {
+// writeAuthError answers an auth failure with its status text only; relation
+// store errors are logged and answered with 503.
+func writeAuthError(w http.ResponseWriter, r *http.Request, err error) {
 	status := auth.HTTPStatus(err)
+	if errors.Is(err, authz.ErrRelationCheck) {
+		log.FromContext(r.Context()).WithError(err).Error("authorization check failed")
+		status = http.StatusServiceUnavailable
+	}
 	w.WriteHeader(status)
 	//nolint:gosec // G705: writing standard HTTP status text, not user input
 	_, _ = w.Write([]byte(http.StatusText(status)))
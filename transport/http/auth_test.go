@@ -2,12 +2,14 @@ package http_test
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
 
 	"github.com/nojyerac/go-lib/auth"
 	"github.com/nojyerac/go-lib/authz"
+	"github.com/nojyerac/go-lib/authz/rebac"
 	"github.com/nojyerac/go-lib/log"
 	. "github.com/nojyerac/go-lib/transport/http"
 	. "github.com/onsi/ginkgo/v2"
@@ -114,3 +116,256 @@ var _ = Describe("Auth middleware", func() {
 		Expect(body).To(Equal("Unauthorized"))
 	})
 })
+
+var _ = Describe("Auth middleware shadow mode", func() {
+	var (
+		s       Server
+		stubVal *validatorStub
+	)
+
+	BeforeEach(func() {
+		stubVal = &validatorStub{claims: &auth.Claims{Subject: "user-1", Roles: []string{"viewer"}}}
+		policies := authz.NewPolicyMap()
+		policies.Set(authz.HTTPOperation(http.MethodGet, "/api/protected"), authz.RequireAny("reader"))
+
+		s = NewServer(
+			&Configuration{},
+			WithAuthMiddleware(stubVal, policies, WithAuthShadowMode()),
+			WithLogger(log.NewLogger(log.TestConfig)),
+		)
+		s.HandleFunc("GET /protected", func(w http.ResponseWriter, r *http.Request) {
+			subject := "anonymous"
+			if claims, ok := auth.FromContext(r.Context()); ok {
+				subject = claims.Subject
+			}
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte(subject))
+		})
+	})
+
+	It("passes would-be forbidden requests through with claims", func() {
+		req := httptest.NewRequest(http.MethodGet, "/api/protected", http.NoBody)
+		req.Header.Set("Authorization", "Bearer mock-token")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(w.Body.String()).To(Equal("user-1"))
+	})
+
+	It("passes would-be unauthenticated requests through without claims", func() {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/protected", http.NoBody))
+
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(w.Body.String()).To(Equal("anonymous"))
+	})
+})
+
+var _ = Describe("Authz explain handler", func() {
+	var (
+		s       Server
+		stubVal *validatorStub
+	)
+
+	BeforeEach(func() {
+		stubVal = &validatorStub{claims: &auth.Claims{Subject: "op-1", Roles: []string{"authz-admin"}}}
+		policies := authz.NewPolicyMap()
+		policies.Set(authz.HTTPOperation(http.MethodGet, "/api/orders/{id}"), authz.RequireAll("reader", "billing"))
+		s = NewServer(
+			&Configuration{},
+			WithAuthzExplainHandler(policies, stubVal, authz.RequireAny("authz-admin")),
+			WithLogger(log.NewLogger(log.TestConfig)),
+		)
+	})
+
+	explain := func(target string, authorized bool) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, target, http.NoBody)
+		if authorized {
+			req.Header.Set("Authorization", "Bearer token")
+		}
+		s.ServeHTTP(w, req)
+		return w
+	}
+
+	It("rejects unauthenticated callers", func() {
+		w := explain("/debug/authz/explain?method=GET&path=/api/orders/42", false)
+		Expect(w.Code).To(Equal(http.StatusUnauthorized))
+		Expect(w.Body.String()).NotTo(ContainSubstring("orders"))
+	})
+
+	It("rejects callers without the access requirement", func() {
+		stubVal.claims = &auth.Claims{Subject: "user-1", Roles: []string{"reader"}}
+		w := explain("/debug/authz/explain?method=GET&path=/api/orders/42", true)
+		Expect(w.Code).To(Equal(http.StatusForbidden))
+	})
+
+	It("explains a denial for the given roles", func() {
+		w := explain("/debug/authz/explain?method=GET&path=/api/orders/42&roles=reader", true)
+
+		Expect(w.Code).To(Equal(http.StatusOK))
+		var explanation authz.Explanation
+		Expect(json.Unmarshal(w.Body.Bytes(), &explanation)).To(Succeed())
+		Expect(explanation.Pattern).To(Equal("GET /api/orders/{id}"))
+		Expect(explanation.Allowed).To(BeFalse())
+		Expect(explanation.MissingAllOf).To(Equal([]string{"billing"}))
+	})
+
+	It("accepts a raw operation", func() {
+		w := explain("/debug/authz/explain?operation=GET+/api/orders/42&roles=reader,billing", true)
+
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(w.Body.String()).To(ContainSubstring(`"allowed":true`))
+	})
+
+	It("rejects requests without an operation", func() {
+		w := explain("/debug/authz/explain", true)
+
+		Expect(w.Code).To(Equal(http.StatusBadRequest))
+	})
+})
+
+var _ = Describe("Auth middleware relation requirements", func() {
+	var (
+		s      Server
+		engine *rebac.Engine
+	)
+
+	BeforeEach(func() {
+		store := rebac.NewMemoryStore()
+		Expect(store.Write(context.Background(),
+			rebac.MustParseTuple("group:y#member@user:bob"),
+			rebac.MustParseTuple("document:x#editor@group:y#member"),
+		)).To(Succeed())
+		engine = rebac.NewEngine(store, rebac.Schema{})
+
+		policies := authz.NewPolicyMap()
+		policies.Set(
+			authz.HTTPOperation(http.MethodPut, "/api/documents/{id}"),
+			authz.RequireRelation("document", "id", "editor"),
+		)
+
+		s = NewServer(
+			&Configuration{},
+			WithAuthMiddleware(
+				&validatorStub{claims: &auth.Claims{Subject: "bob"}},
+				policies,
+				WithRelationChecker(engine),
+			),
+		)
+		s.HandleFunc("PUT /documents/{id}", func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})
+	})
+
+	put := func(path string) int {
+		req := httptest.NewRequest(http.MethodPut, path, http.NoBody)
+		req.Header.Set("Authorization", "Bearer mock-token")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	It("allows callers holding the relation", func() {
+		Expect(put("/api/documents/x")).To(Equal(http.StatusNoContent))
+	})
+
+	It("forbids callers without the relation", func() {
+		Expect(put("/api/documents/other")).To(Equal(http.StatusForbidden))
+	})
+
+	It("answers relation store failures with 503 and no details", func() {
+		policies := authz.NewPolicyMap()
+		policies.Set(
+			authz.HTTPOperation(http.MethodPut, "/api/documents/{id}"),
+			authz.RequireRelation("document", "id", "editor"),
+		)
+		s = NewServer(&Configuration{}, WithAuthMiddleware(
+			&validatorStub{claims: &auth.Claims{Subject: "bob"}},
+			policies,
+			WithRelationChecker(failingChecker{}),
+		))
+		s.HandleFunc("PUT /documents/{id}", func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})
+
+		req := httptest.NewRequest(http.MethodPut, "/api/documents/x", http.NoBody)
+		req.Header.Set("Authorization", "Bearer mock-token")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		Expect(w.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(w.Body.String()).NotTo(ContainSubstring("db-1"))
+	})
+})
+
+type failingChecker struct{}
+
+func (failingChecker) Check(context.Context, string, string, string) (bool, error) {
+	return false, errors.New("dial tcp db-1:5432: connection refused")
+}
+
+type auditLoggerStub struct {
+	actions  []string
+	outcomes []any
+}
+
+func (a *auditLoggerStub) LogChange(ctx context.Context, actorID, action string, _, _ any) error {
+	return a.Log(ctx, actorID, action, nil)
+}
+
+func (a *auditLoggerStub) Log(_ context.Context, _, action string, details map[string]any) error {
+	a.actions = append(a.actions, action)
+	a.outcomes = append(a.outcomes, details["outcome"])
+	return nil
+}
+
+var _ = Describe("Auth middleware decision audit", func() {
+	var (
+		s       Server
+		stubVal *validatorStub
+		logger  *auditLoggerStub
+	)
+
+	BeforeEach(func() {
+		stubVal = &validatorStub{claims: &auth.Claims{Subject: "user-1", Roles: []string{"reader"}}}
+		logger = &auditLoggerStub{}
+		policies := authz.NewPolicyMap()
+		policies.Set(authz.HTTPOperation(http.MethodGet, "/api/protected"), authz.RequireAny("reader"))
+		policies.Set(authz.HTTPOperation(http.MethodDelete, "/api/protected"), authz.RequireAny("reader"))
+
+		s = NewServer(
+			&Configuration{},
+			WithAuthMiddleware(stubVal, policies, WithDecisionAudit(
+				logger,
+				authz.HTTPOperation(http.MethodDelete, "/api/protected"),
+			)),
+		)
+		s.HandleFunc("/protected", func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+	})
+
+	do := func(method string) int {
+		req := httptest.NewRequest(method, "/api/protected", http.NoBody)
+		req.Header.Set("Authorization", "Bearer mock-token")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	It("records denials", func() {
+		stubVal.claims.Roles = nil
+		Expect(do(http.MethodGet)).To(Equal(http.StatusForbidden))
+		Expect(logger.actions).To(Equal([]string{authz.DecisionAuditAction}))
+		Expect(logger.outcomes).To(Equal([]any{authz.OutcomeDeny}))
+	})
+
+	It("records allows for sensitive operations only", func() {
+		Expect(do(http.MethodGet)).To(Equal(http.StatusOK))
+		Expect(logger.actions).To(BeEmpty())
+
+		Expect(do(http.MethodDelete)).To(Equal(http.StatusOK))
+		Expect(logger.outcomes).To(Equal([]any{authz.OutcomeAllow}))
+	})
+})
@@ -39,6 +39,7 @@ type server struct {
 	apiPrefix      string
 	mux            *http.ServeMux
 	h              health.Checker
+	explain        http.Handler
 }
 
 func (s *server) Handle(pattern string, handler http.Handler) {
@@ -107,6 +108,9 @@ func NewServer(c *Configuration, opts ...Option) Server {
 	if s.h != nil {
 		s.mux.HandleFunc("/healthz", healthCheck(s.h))
 	}
+	if s.explain != nil {
+		s.mux.Handle(authzExplainPath, s.applyMiddleware(s.explain))
+	}
 	return s
 }
 